@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/AshutoshPatole/ssm/internal/security"
 	"github.com/AshutoshPatole/ssm/internal/ssh"
 	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
@@ -13,13 +12,15 @@ import (
 )
 
 var (
-	username                 string
-	group                    string
-	alias                    string
-	environment              string
-	setupDotFiles            bool
-	allowedEnvironmentValues = []string{"dev", "staging", "prod"}
-	rdpConnectionString      bool
+	username            string
+	group               string
+	alias               string
+	environment         string
+	setupDotFiles       bool
+	rdpConnectionString bool
+	serverTags          []string
+	serverLabels        []string
+	serverCredential    string
 )
 
 // addCmd represents the add command
@@ -33,7 +34,10 @@ You can specify the hostname, username, group, environment, and other optional s
 Example usage:
 		ssm add example.com -u myuser -g mygroup -a myalias -e prod -d
 
-This will add a server with hostname example.com, username myuser, group mygroup, alias myalias, environment prod, and setup dotfiles.`,
+This will add a server with hostname example.com, username myuser, group mygroup, alias myalias, environment prod, and setup dotfiles.
+
+Servers can be tagged and labelled so they can be targeted with selectors across groups:
+		ssm add db1.example.com -g payments -a pg1 -e prod -t postgres -t primary --label role=db --label region=us`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			logrus.Debug("No hostname provided")
@@ -43,46 +47,103 @@ This will add a server with hostname example.com, username myuser, group mygroup
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		validEnvironment := false
-		for _, env := range allowedEnvironmentValues {
-			if env == environment {
-				validEnvironment = true
-				break
-			}
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
 		}
-		if !validEnvironment {
+		if err := config.CheckEnvironment(environment); err != nil {
 			logrus.Debugf("Invalid environment value: %s", environment)
-			logrus.Fatalf("Invalid environment value. Allowed values are: %v", allowedEnvironmentValues)
+			logrus.Fatal(err)
+		}
+		tags, err := store.ParseTags(serverTags)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		labels, err := store.ParseLabels(serverLabels)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		server := store.Server{
+			HostName:   args[0],
+			Alias:      alias,
+			User:       username,
+			IsRDP:      rdpConnectionString,
+			Tags:       tags,
+			Labels:     labels,
+			Credential: serverCredential,
+		}
+		if _, _, err := server.CredentialRef(store.ServerLocation{Group: group, Environment: environment}); err != nil {
+			logrus.Fatal(err)
+		}
+		// Refuse duplicates before asking for a password, storing credentials or installing keys
+		if err := config.CheckAdd(store.ServerLocation{Group: group, Environment: environment}, server); err != nil {
+			logrus.Fatal(err)
 		}
 		logrus.Debugf("Adding server with hostname: %s", args[0])
-		addServer(args[0])
+		addServer(server)
 	},
 }
 
-func addServer(host string) {
+func addServer(server store.Server) {
+	host := server.HostName
+	at := store.ServerLocation{Group: group, Environment: environment}
 	logrus.Debugf("Attempting to add server: %s", host)
-	fmt.Println("Please enter the password for the server:")
-	password, err := ssh.AskPassword()
+	// Resolved here rather than when saving, so that the credential expands as it will on connect
+	server.IP = store.ResolveIP(host)
+	ref, ok, err := server.CredentialRef(at)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	// A command given here is trusted on this machine, it was typed by its user
+	if ok && ref.Scheme == store.CredentialCommand {
+		if err := store.TrustCommand(ref.Key); err != nil {
+			logrus.Fatalf("Failed to trust the credential command: %v", err)
+		}
+	}
+	if store.DryRun {
+		if rdpConnectionString && server.Credential == "" {
+			ref, err := newCredentialRef(at, host)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			server.Credential = ref.String()
+		}
+		if err := inventory.Add(at, server); err != nil {
+			logrus.Fatalf("Failed to save server: %v", err)
+		}
+		fmt.Println("Dry-run: no credentials stored and no keys installed on the server.")
+		return
+	}
+	password, err := serverPassword(at, server, "Please enter the password for the server:")
 	if err != nil {
 		logrus.Debugf("Error reading password: %v", err)
-		logrus.Fatal("Error reading password. Please try again.")
+		logrus.Fatal("Error reading password: " + err.Error())
 	}
 
 	if rdpConnectionString {
 		logrus.Debug("RDP connection string detected")
-		credentialKey := fmt.Sprintf("%s_%s_%s", group, environment, host)
-		logrus.Debugf("Generated credential key: %s", credentialKey)
-		err = security.StoreCredentials(credentialKey, password)
-		if err != nil {
-			logrus.Debugf("Error storing credential: %v", err)
-			logrus.Fatalln("Error storing credential: " + err.Error())
+		if server.Credential == "" {
+			ref, err := newCredentialRef(at, host)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			logrus.Debugf("Generated credential: %s", ref)
+			if err := setCredential(ref, password); err != nil {
+				logrus.Debugf("Error storing credential: %v", err)
+				logrus.Fatalln("Error storing credential: " + err.Error())
+			}
+			server.Credential = ref.String()
 		}
 		logrus.Debug("Saving RDP connection details")
-		store.Save(group, environment, host, username, alias, credentialKey, true)
+		if err := inventory.Add(at, server); err != nil {
+			logrus.Fatalf("Failed to save server: %v", err)
+		}
 		fmt.Println("RDP connection details saved successfully!")
 	} else {
 		logrus.Debug("Saving SSH connection details")
-		store.Save(group, environment, host, username, alias, "", false)
+		if err := inventory.Add(at, server); err != nil {
+			logrus.Fatalf("Failed to save server: %v", err)
+		}
 		logrus.Debug("Initializing SSH connection")
 		ssh.InitSSHConnection(username, password, host, group, environment, alias, setupDotFiles)
 		fmt.Println("SSH connection details saved and initialized successfully!")
@@ -90,15 +151,32 @@ func addServer(host string) {
 	fmt.Printf("Server %s added to group %s with alias %s in %s environment.\n", host, group, alias, environment)
 }
 
+// serverPassword returns the password of a server being added: the one its credential names, or one
+// read from the terminal after printing prompt
+func serverPassword(at store.ServerLocation, server store.Server, prompt string) (string, error) {
+	ref, ok, err := server.CredentialRef(at)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return getCredential(ref)
+	}
+	fmt.Println(prompt)
+	return ssh.AskPassword()
+}
+
 func init() {
 	logrus.Debug("Initializing add command")
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().StringVarP(&username, "username", "u", "root", "Username to use for the connection")
 	addCmd.Flags().StringVarP(&group, "group", "g", "", "Group to categorize the server")
 	addCmd.Flags().StringVarP(&alias, "alias", "a", "", "Alias for easy reference to the server")
-	addCmd.Flags().StringVarP(&environment, "environment", "e", "dev", "Environment of the server (dev/staging/prod)")
+	addCmd.Flags().StringVarP(&environment, "environment", "e", "dev", "Environment of the server, one of the environments declared in .ssm.yaml")
 	addCmd.Flags().BoolVarP(&setupDotFiles, "dotfiles", "d", false, "Configure the dotfiles on the server")
 	addCmd.Flags().BoolVarP(&rdpConnectionString, "rdp", "r", false, "Flag to indicate it's an RDP connection instead of SSH")
+	addCmd.Flags().StringSliceVarP(&serverTags, "tag", "t", nil, "Tag to attach to the server (repeatable)")
+	addCmd.Flags().StringSliceVar(&serverLabels, "label", nil, "Label to attach to the server as key=value (repeatable)")
+	addCmd.Flags().StringVar(&serverCredential, "credential", "", "Read the password from here instead of asking, e.g. env:RDP_PASSWORD or 'cmd:pass show ssm/{{.Alias}}'")
 	_ = addCmd.MarkFlagRequired("group")
 	_ = addCmd.MarkFlagRequired("alias")
 }
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AshutoshPatole/ssm/internal/diff"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Inspect snapshots of your configuration",
+	Long: `SSM takes a snapshot of .ssm.yaml before every change and of all local files before 'ssm sync pull'.
+Snapshots are stored under ~/.ssm/backups and can be listed, compared with the current files and restored with 'ssm restore'.`,
+}
+
+// backupListCmd represents the backup list command
+var backupListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List configuration snapshots",
+	Aliases: []string{"ls"},
+	Run: func(cmd *cobra.Command, args []string) {
+		backups, err := store.ListBackups()
+		if err != nil {
+			logrus.Fatalf("Failed to list backups: %v", err)
+		}
+		if len(backups) == 0 {
+			fmt.Println("No backups found")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ID\tCREATED\tREASON\tFILES")
+		for i := len(backups) - 1; i >= 0; i-- {
+			b := backups[i]
+			var files []string
+			for _, f := range b.Files {
+				files = append(files, displayPath(f.Path))
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.ID, b.CreatedAt.Local().Format("2006-01-02 15:04:05"), b.Reason, strings.Join(files, ", "))
+		}
+		_ = w.Flush()
+	},
+}
+
+// backupDiffCmd represents the backup diff command
+var backupDiffCmd = &cobra.Command{
+	Use:   "diff <id>",
+	Short: "Show what restoring a snapshot would change",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := store.FindBackup(args[0])
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		printBackupDiff(b)
+	},
+}
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Restore files from a configuration snapshot",
+	Long: `Restore .ssm.yaml and any other files captured in a snapshot (see 'ssm backup list').
+The current files are snapshotted before they are overwritten, so a restore can itself be undone.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := store.FindBackup(args[0])
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+
+		printBackupDiff(b)
+		if store.DryRun {
+			return
+		}
+		ok, err := confirm(fmt.Sprintf("Restore %d file(s) from backup %s?", len(b.Files), b.ID))
+		if err != nil {
+			logrus.Fatalf("Error reading input: %v", err)
+		}
+		if !ok {
+			fmt.Println("Restore aborted.")
+			return
+		}
+
+		previous, err := store.Restore(b)
+		if err != nil {
+			logrus.Fatalf("Failed to restore backup %s: %v", b.ID, err)
+		}
+		fmt.Printf("Restored backup %s\n", b.ID)
+		if previous != nil {
+			fmt.Printf("Previous files saved as backup %s\n", previous.ID)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+	backupCmd.AddCommand(backupListCmd)
+	backupCmd.AddCommand(backupDiffCmd)
+}
+
+// printBackupDiff prints a diff between the current files and the contents of the backup.
+// Private keys are only reported as changed, never printed.
+func printBackupDiff(b *store.Backup) {
+	for _, f := range b.Files {
+		backedUp, err := b.ReadFile(f)
+		if err != nil {
+			logrus.Errorln(err)
+			continue
+		}
+		current, err := os.ReadFile(f.Path)
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Errorf("Failed to read %s: %v", f.Path, err)
+			continue
+		}
+
+		name := displayPath(f.Path)
+		if f.Mode.Perm()&0077 == 0 && strings.HasPrefix(filepath.Base(f.Path), "id_") {
+			if string(current) == string(backedUp) {
+				fmt.Printf("No changes to %s\n", name)
+			} else {
+				fmt.Printf("%s differs (contents hidden)\n", name)
+			}
+			continue
+		}
+
+		d := diff.Unified(name+" (current)", name+" (backup "+b.ID+")", current, backedUp)
+		if d == "" {
+			fmt.Printf("No changes to %s\n", name)
+			continue
+		}
+		fmt.Print(d)
+	}
+}
+
+// displayPath shortens paths inside the home directory to ~/...
+func displayPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	changePasswordEmail string
+)
+
+// changePasswordCmd represents the change-password command
+var changePasswordCmd = &cobra.Command{
+	Use:   "change-password",
+	Short: "Change the password of your user",
+	Long: `Changes the password of your SSM cloud account. The files synchronised to the SSM cloud are encrypted
+with the account password, so the key encrypting them is wrapped under the new password in the same step
+and pushed as a new revision. Other machines need the new password from the next push or pull on.
+
+Nothing is re-encrypted when sync.passphrase is set in .ssm.yaml, as the files are encrypted with a
+passphrase of their own then, see 'ssm sync rekey'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Enter your current password.")
+		password, err := ssh.AskPassword()
+		if err != nil {
+			logrus.Errorf("Failed to read password: %v", err)
+			return
+		}
+		uid, err := fetchUID(changePasswordEmail, password)
+		if err != nil {
+			logrus.Errorf("Authentication failed: %v", err)
+			return
+		}
+		newPassword, err := askNewSecret("password")
+		if err != nil {
+			logrus.Errorf("Failed to read the new password: %v", err)
+			return
+		}
+
+		var (
+			backend         store.SyncBackend
+			remote, rekeyed store.Payload
+		)
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Errorf("Failed to load configuration: %v", err)
+			return
+		}
+		if !config.SyncSettings().Passphrase {
+			backend, err = store.OpenSync(store.SyncConfig{Backend: store.SyncFirestore}, uid)
+			if err != nil {
+				logrus.Errorf("Failed to open sync backend: %v", err)
+				return
+			}
+			remote, err = backend.Get("")
+			if errors.Is(err, store.ErrNoSyncData) {
+				backend = nil
+			} else if err != nil {
+				logrus.Errorf("Error reading the latest revision: %v", err)
+				return
+			} else if rekeyed, err = rekeyPayload(remote, password, newPassword); err != nil {
+				logrus.Errorf("Password not changed, the synchronised files could not be encrypted for it: %v", err)
+				return
+			}
+		}
+
+		if err := store.ChangePassword(uid, newPassword); err != nil {
+			logrus.Errorf("Failed to change password: %v", err)
+			return
+		}
+		if backend == nil {
+			logrus.Infof("Password changed")
+			return
+		}
+		if _, err := pushRekeyed(backend, remote, rekeyed); err != nil {
+			// Keep the password and the key of the synchronised files together
+			if revertErr := store.ChangePassword(uid, password); revertErr != nil {
+				logrus.Errorf("Failed to push the new key (%v) and to restore the old password (%v): the synchronised files are still encrypted with the old password, set sync.passphrase in .ssm.yaml and run 'ssm sync rekey' with the old password as current passphrase", err, revertErr)
+				return
+			}
+			logrus.Errorf("Password not changed, failed to push the new key: %v", err)
+			return
+		}
+		logrus.Infof("Password changed and synchronised files encrypted for it, use it on your other machines from now on")
+	},
+}
+
+func init() {
+	authCmd.AddCommand(changePasswordCmd)
+	changePasswordCmd.Flags().StringVarP(&changePasswordEmail, "email", "e", "", "Email address of the user")
+	_ = changePasswordCmd.MarkFlagRequired("email")
+}
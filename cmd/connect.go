@@ -5,13 +5,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/AshutoshPatole/ssm/internal/facts"
 	"github.com/AshutoshPatole/ssm/internal/ssh"
 	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // serverOption represents a single server option with its attributes
@@ -23,9 +24,13 @@ type serverOption struct {
 	IP            string
 	IsRDP         bool
 	CredentialKey string
+	Target        serverTarget
 }
 
-var filterEnvironment string
+var (
+	filterEnvironment string
+	connectSelector   string
+)
 
 // connectCmd represents the connect command for initiating server connections
 var connectCmd = &cobra.Command{
@@ -36,44 +41,54 @@ Connect to servers using the following syntax:
 ssm connect group-name
 
 You can also specify which environments to list:
-ssm connect group-name -e ppd
+ssm connect group-name -f ppd
+
+Or pick from the servers matching a selector, across all groups:
+ssm connect -l role=db,env=prod
 	`,
 	Aliases: []string{"c", "con"},
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) < 1 || len(args) > 1 {
-			fmt.Println("Usage: ssm connect group-name\nYou can also pass environment using -e (optional)")
+		if len(args) > 1 || (len(args) == 0 && connectSelector == "") {
+			fmt.Println("Usage: ssm connect group-name\nYou can also pass environment using -f or a selector using -l (optional)")
 			os.Exit(1)
 		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		logrus.Debugf("Executing connect command with args: %v", args)
-		user, host, credentialKey, isRDP, err := ListToConnectServers(args[0], filterEnvironment)
+		groupName := ""
+		if len(args) == 1 {
+			groupName = args[0]
+		}
+		target, err := ListToConnectServers(groupName, filterEnvironment, mustParseSelector(connectSelector))
 		if err != nil {
 			logrus.Fatalf("Error listing servers: %v", err)
 		}
-		if isRDP {
+		if !guardProtected("connect", "", []serverTarget{target}) {
+			return
+		}
+		if target.Server.IsRDP {
 			logrus.Debug("Connecting to RDP server")
-			ConnectToServerRDP(user, host, credentialKey)
+			connectRDP(target)
 			return
 		}
 		logrus.Debug("Connecting to SSH server")
-		ConnectToServer(user, host)
+		ConnectToServer(target)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(connectCmd)
 	connectCmd.Flags().StringVarP(&filterEnvironment, "filter", "f", "", "Filter server list by environment")
+	connectCmd.Flags().StringVarP(&connectSelector, "selector", "l", "", "Filter server list by selector (e.g. role=db,region!=eu)")
 }
 
-// ListToConnectServers retrieves and displays a list of servers for connection
-func ListToConnectServers(group, environment string) (string, string, string, bool, error) {
+// ListToConnectServers retrieves and displays a list of servers for connection and returns the selected one
+func ListToConnectServers(group, environment string, selector store.Selector) (serverTarget, error) {
 	logrus.Debugf("Listing servers for group: %s, environment: %s", group, environment)
-	var config store.Config
-
-	if err := viper.Unmarshal(&config); err != nil {
-		return "", "", "", false, fmt.Errorf("failed to unmarshal configuration: %w", err)
+	config, err := inventory.Load()
+	if err != nil {
+		return serverTarget{}, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
 	selectedEnvName := ""
@@ -83,47 +98,28 @@ func ListToConnectServers(group, environment string) (string, string, string, bo
 	var serverOptions []serverOption
 	user := ""
 	isRDP := false
-	credentialKey := ""
-
-	// Populate server options based on group and environment filters
-	for _, grp := range config.Groups {
-		if grp.Name == group {
-			for _, env := range grp.Environment {
-				if environment != "" {
-					if environment == env.Name {
-						for _, server := range env.Servers {
-							serverOption := serverOption{
-								Label:         fmt.Sprintf("%s (%s)", server.Alias, env.Name),
-								Environment:   env.Name,
-								HostName:      server.HostName,
-								IP:            server.IP,
-								User:          server.User,
-								IsRDP:         server.IsRDP,
-								CredentialKey: server.Password,
-							}
-							serverOptions = append(serverOptions, serverOption)
-						}
-					}
-				} else {
-					for _, server := range env.Servers {
-						serverOption := serverOption{
-							Label:         fmt.Sprintf("%s (%s)", server.Alias, env.Name),
-							Environment:   env.Name,
-							HostName:      server.HostName,
-							IP:            server.IP,
-							User:          server.User,
-							IsRDP:         server.IsRDP,
-							CredentialKey: server.Password,
-						}
-						serverOptions = append(serverOptions, serverOption)
-					}
-				}
-			}
+	var selected serverTarget
+
+	// Populate server options based on group, environment and selector filters
+	for _, target := range collectServers(config, group, environment, selector) {
+		label := fmt.Sprintf("%s (%s)", target.Server.Alias, target.Environment)
+		if group == "" {
+			label = fmt.Sprintf("%s (%s/%s)", target.Server.Alias, target.Group, target.Environment)
 		}
+		serverOptions = append(serverOptions, serverOption{
+			Label:         label,
+			Environment:   target.Environment,
+			HostName:      target.Server.HostName,
+			IP:            target.Server.IP,
+			User:          target.Server.User,
+			IsRDP:         target.Server.IsRDP,
+			CredentialKey: target.Server.Password,
+			Target:        target,
+		})
 	}
 
 	if len(serverOptions) == 0 {
-		return "", "", "", false, fmt.Errorf("no servers found in group '%s' (filter: '%s')", group, environment)
+		return serverTarget{}, fmt.Errorf("no servers found in group '%s' (filter: '%s', selector: '%s')", group, environment, selector)
 	}
 
 	labels := make([]string, len(serverOptions))
@@ -136,11 +132,14 @@ func ListToConnectServers(group, environment string) (string, string, string, bo
 	prompt := &survey.Select{
 		Message: "Select server",
 		Options: labels,
+		Description: func(value string, index int) string {
+			return serverPreview(serverOptions[index])
+		},
 	}
-	err := survey.AskOne(prompt, &selectedHostName)
+	err = survey.AskOne(prompt, &selectedHostName)
 	if err != nil {
 		logrus.Errorf("Failed to select server: %v", err)
-		return "", "", "", false, err
+		return serverTarget{}, err
 	}
 
 	// Extract server details from the selected option
@@ -151,7 +150,7 @@ func ListToConnectServers(group, environment string) (string, string, string, bo
 			selectedHostIP = serverOption.IP
 			user = serverOption.User
 			isRDP = serverOption.IsRDP
-			credentialKey = serverOption.CredentialKey
+			selected = serverOption.Target
 			break
 		}
 	}
@@ -161,7 +160,7 @@ func ListToConnectServers(group, environment string) (string, string, string, bo
 		fmt.Printf("%-*s: %*s\n", longestLabelLength, "Host", colonWidth, selectedHostName)
 		fmt.Printf("%-*s: %*s\n", longestLabelLength, "IP Address", colonWidth, selectedHostIP)
 		fmt.Printf("%-*s: %*s\n", longestLabelLength, "User", colonWidth, user)
-		fmt.Printf("%-*s: %*s\n", longestLabelLength, "Environment", colonWidth, selectedEnvName)
+		fmt.Printf("%-*s: %*s\n", longestLabelLength, "Environment", colonWidth, environmentLabel(config, selectedEnvName))
 		rdpStatus := "No"
 		if isRDP {
 			rdpStatus = "Yes"
@@ -169,16 +168,31 @@ func ListToConnectServers(group, environment string) (string, string, string, bo
 		fmt.Printf("%-*s: %*s\n", longestLabelLength, "RDP", colonWidth, rdpStatus)
 		//ssh.Connect(user, selectedHostIP)
 		logrus.Debugf("Selected server: %s (%s)", selectedHostName, selectedHostIP)
-		return user, selectedHostIP, credentialKey, isRDP, nil
+		return selected, nil
 	} else {
 		fmt.Println("Aborted! Bad Request")
 		logrus.Error("Failed to select a valid server")
-		return "", "", "", false, fmt.Errorf("invalid server selection")
+		return serverTarget{}, fmt.Errorf("invalid server selection")
+	}
+}
+
+// serverPreview describes the cached facts of a server for the picker
+func serverPreview(option serverOption) string {
+	if option.IsRDP {
+		return "RDP, facts unsupported"
+	}
+	f := facts.Cached(option.HostName)
+	if f == nil {
+		return ""
 	}
+	return fmt.Sprintf("%s (%s ago)", f.Summary(), formatAge(time.Since(f.CollectedAt)))
 }
 
-// ConnectToServer initiates an SSH connection to the specified server
-func ConnectToServer(user, host string) {
-	logrus.Debugf("Connecting to server: %s@%s", user, host)
-	ssh.Connect(user, host)
+// ConnectToServer initiates an SSH connection to the specified server, marking the terminal while
+// connected to a protected environment
+func ConnectToServer(target serverTarget) {
+	logrus.Debugf("Connecting to server: %s@%s", target.Server.User, target.Server.IP)
+	restore := protectedTerminal(target)
+	defer restore()
+	ssh.Connect(target.Server.User, target.Server.IP)
 }
@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// resolveCredential returns ref with the scheme of its provider. Credentials of servers added by earlier
+// versions of ssm have no scheme: they are read from the vault when it holds them and from the OS
+// keyring otherwise.
+func resolveCredential(ref store.CredentialRef) store.CredentialRef {
+	if ref.Scheme == "" {
+		ref.Scheme = store.CredentialKeyring
+		if vault, err := store.LoadVault(); err == nil && vault.Has(ref.Key) {
+			ref.Scheme = store.CredentialVault
+		}
+	}
+	return ref
+}
+
+// storedCredential reports whether ref is kept by ssm itself, in the keyring or the vault, rather than
+// read from elsewhere
+func storedCredential(ref store.CredentialRef) bool {
+	scheme := resolveCredential(ref).Scheme
+	return scheme == store.CredentialKeyring || scheme == store.CredentialVault
+}
+
+// credentialProvider returns the provider of ref
+func credentialProvider(ref store.CredentialRef) (store.CredentialProvider, error) {
+	return store.OpenCredentialProvider(resolveCredential(ref).Scheme, unlockVault, trustCommand)
+}
+
+// trustCommand lets a cmd: credential run once it is trusted on this machine. An untrusted command is
+// shown and confirmed on the terminal, even with --yes, since it may come from a synchronised or shared
+// configuration written by someone else.
+func trustCommand(command string) error {
+	settings, err := store.LoadLocalSettings()
+	if err != nil {
+		return err
+	}
+	if settings.Trusts(command) {
+		return nil
+	}
+	hint := "add it to trustedCommands in ~/.ssm/local.yaml to run it"
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("the credential command %q is not trusted on this machine, %s", command, hint)
+	}
+	fmt.Printf("The credential command\n\n    %s\n\nhas not been run on this machine yet. Run it and trust it from now on? (y/n): ", command)
+	response, err := stdinReader.ReadString('\n')
+	if err != nil {
+		fmt.Println()
+		return err
+	}
+	if response = strings.TrimSpace(strings.ToLower(response)); response != "y" && response != "yes" {
+		return fmt.Errorf("the credential command %q was not trusted, %s", command, hint)
+	}
+	return store.TrustCommand(command)
+}
+
+// getCredential returns the secret ref names
+func getCredential(ref store.CredentialRef) (string, error) {
+	provider, err := credentialProvider(ref)
+	if err != nil {
+		return "", err
+	}
+	return provider.Get(ref.Key)
+}
+
+// setCredential stores value as the secret ref names
+func setCredential(ref store.CredentialRef, value string) error {
+	provider, err := credentialProvider(ref)
+	if err != nil {
+		return err
+	}
+	return provider.Set(ref.Key, value)
+}
+
+// deleteCredential removes the secret ref names
+func deleteCredential(ref store.CredentialRef) error {
+	provider, err := credentialProvider(ref)
+	if err != nil {
+		return err
+	}
+	return provider.Delete(ref.Key)
+}
+
+// newCredentialRef returns the credential of a server added on this machine: its default key, in the
+// credential store of this machine
+func newCredentialRef(at store.ServerLocation, hostName string) (store.CredentialRef, error) {
+	settings, err := store.LoadLocalSettings()
+	if err != nil {
+		return store.CredentialRef{}, err
+	}
+	return store.CredentialRef{Scheme: settings.Store(), Key: store.CredentialKey(at, hostName)}, nil
+}
+
+// credential returns the credential of the target, false when it has none
+func (t serverTarget) credential() (store.CredentialRef, bool, error) {
+	return t.Server.CredentialRef(store.ServerLocation{Group: t.Group, Environment: t.Environment})
+}
+
+// credentialUsers returns the aliases of the servers of config using ref, other than except
+func credentialUsers(config *store.Config, ref store.CredentialRef, except store.Entry) []string {
+	ref = resolveCredential(ref)
+	var aliases []string
+	for _, t := range collectServers(config, "", "", store.Selector{}) {
+		if t.entry().ServerLocation == except.ServerLocation && t.Server.Alias == except.Server.Alias {
+			continue
+		}
+		if other, ok, err := t.credential(); err == nil && ok && resolveCredential(other) == ref {
+			aliases = append(aliases, t.Server.Alias)
+		}
+	}
+	return aliases
+}
+
+// forgetCredentials deletes the stored passwords of deleted servers, unless a remaining server uses them
+func forgetCredentials(deleted []store.Entry) {
+	if store.DryRun || len(deleted) == 0 {
+		return
+	}
+	config, err := inventory.Load()
+	if err != nil {
+		logrus.Warnf("Failed to load configuration, stored credentials were kept: %v", err)
+		return
+	}
+	for _, e := range deleted {
+		ref, ok, err := e.Server.CredentialRef(e.ServerLocation)
+		if err != nil || !ok || !storedCredential(ref) || len(credentialUsers(config, ref, store.Entry{})) > 0 {
+			continue
+		}
+		if err := deleteCredential(ref); err != nil {
+			logrus.Warnf("Failed to delete the credential of %s: %v", e.Server.Alias, err)
+			continue
+		}
+		logrus.Debugf("Deleted credential %s of %s", resolveCredential(ref), e.Server.Alias)
+	}
+}
+
+// followCredential makes the credential of a server follow it when it is changed into changed at to.
+// A credential named by the default key of the server, group_environment_host, is renamed to its new
+// default key. It returns a function that moves the stored password once the change is saved.
+func followCredential(server store.Server, from store.ServerLocation, changed *store.Server, to store.ServerLocation) func() {
+	ref, ok, err := server.CredentialRef(from)
+	if err != nil || !ok {
+		return func() {}
+	}
+	// The key of a credential is compared before it is expanded, so that a template such as {{.Key}}
+	// is kept
+	key := server.Password
+	if parsed, err := store.ParseCredential(server.Credential); err == nil {
+		key = parsed.Key
+	}
+	if key == store.CredentialKey(from, server.HostName) && storedCredential(ref) {
+		moved := resolveCredential(ref)
+		moved.Key = store.CredentialKey(to, changed.HostName)
+		changed.Credential, changed.Password = moved.String(), ""
+	}
+	return func() {
+		moved, ok, err := changed.CredentialRef(to)
+		if err != nil || !ok || resolveCredential(moved) == resolveCredential(ref) || store.DryRun || !storedCredential(ref) {
+			return
+		}
+		if err := moveCredential(ref, moved); err != nil {
+			logrus.Warnf("Failed to move the credential of %s: %v. Store it again with 'ssm creds set %s'", changed.Alias, err, changed.Alias)
+		}
+	}
+}
+
+// moveCredential moves the password stored as from to to. from is kept when another server uses it.
+func moveCredential(from, to store.CredentialRef) error {
+	value, err := getCredential(from)
+	if err != nil {
+		return err
+	}
+	if err := setCredential(to, value); err != nil {
+		return err
+	}
+	config, err := inventory.Load()
+	if err != nil {
+		return err
+	}
+	if len(credentialUsers(config, from, store.Entry{})) > 0 {
+		return nil
+	}
+	return deleteCredential(from)
+}
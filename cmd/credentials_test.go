@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+)
+
+func TestFollowCredential(t *testing.T) {
+	// No vault, so credentials without a scheme are in the keyring
+	t.Setenv("HOME", t.TempDir())
+	from := store.ServerLocation{Group: "web", Environment: "dev"}
+	to := store.ServerLocation{Group: "win", Environment: "prod"}
+
+	for _, c := range []struct {
+		name   string
+		server store.Server
+		want   string
+	}{
+		{"default key", store.Server{HostName: "h1", Credential: "vault:web_dev_h1"}, "vault:win_prod_h2"},
+		{"earlier version", store.Server{HostName: "h1", Password: "web_dev_h1"}, "keyring:win_prod_h2"},
+		{"template", store.Server{HostName: "h1", Credential: "keyring:{{.Key}}"}, "keyring:{{.Key}}"},
+		{"own key", store.Server{HostName: "h1", Credential: "vault:shared-admin"}, "vault:shared-admin"},
+		{"read only", store.Server{HostName: "h1", Credential: "env:web_dev_h1"}, "env:web_dev_h1"},
+		{"no credential", store.Server{HostName: "h1"}, ""},
+	} {
+		changed := c.server
+		changed.HostName = "h2"
+		followCredential(c.server, from, &changed, to)
+		if changed.Credential != c.want || changed.Password != "" && changed.Credential != "" {
+			t.Errorf("%s: expected credential %q, got %q with password %q", c.name, c.want, changed.Credential, changed.Password)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	credsGroup       string
+	credsEnvironment string
+	credsSelector    string
+)
+
+// credsCmd represents the creds command
+var credsCmd = &cobra.Command{
+	Use:     "creds",
+	Aliases: []string{"credentials"},
+	Short:   "List, change, remove and test the passwords of RDP servers",
+	Long: `The creds commands manage the passwords of RDP servers. A server's password is named by its credential,
+by default the key group_environment_host in the credential store of the machine it was added on.
+Passwords read from an environment variable (env:) or a command (cmd:) are only read, never changed.
+
+Stored passwords follow their server: they are deleted with it, and moved when it is moved to another
+group or environment or its hostname changes.
+
+Examples:
+		ssm creds list
+		ssm creds set win1
+		ssm creds test win1
+		ssm creds rm win1`,
+}
+
+// credsListCmd represents the creds list command
+var credsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the credentials of the servers and whether they are stored",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "ALIAS\tGROUP\tENVIRONMENT\tCREDENTIAL\tSTATUS")
+		for _, t := range collectServers(config, credsGroup, credsEnvironment, mustParseSelector(credsSelector)) {
+			ref, ok, err := t.credential()
+			if err != nil {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n", t.Server.Alias, t.Group, t.Environment, t.Server.Credential, err)
+				continue
+			}
+			if !ok {
+				if t.Server.IsRDP {
+					_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t-\tnone, asked for on connect\n", t.Server.Alias, t.Group, t.Environment)
+				}
+				continue
+			}
+			ref = resolveCredential(ref)
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Server.Alias, t.Group, t.Environment, ref, credentialStatus(ref))
+		}
+		_ = w.Flush()
+	},
+}
+
+// credsSetCmd represents the creds set command
+var credsSetCmd = &cobra.Command{
+	Use:   "set <alias>",
+	Short: "Store or change the password of a server",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := credsTarget(args[0])
+		ref, ok, err := t.credential()
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		if !ok && !t.Server.IsRDP {
+			logrus.Fatalf("%s is not an RDP server, it is connected to with your SSH key", t.Server.Alias)
+		}
+		if !ok {
+			if ref, err = newCredentialRef(t.entry().ServerLocation, t.Server.HostName); err != nil {
+				logrus.Fatalln(err)
+			}
+		}
+		if !storedCredential(ref) {
+			logrus.Fatalf("The password of %s is read from %s, change it there", t.Server.Alias, ref)
+		}
+		password, err := askNewSecret(fmt.Sprintf("password of %s", t.Server.Alias))
+		if err != nil {
+			logrus.Fatalf("Failed to read the password: %v", err)
+		}
+		if store.DryRun {
+			fmt.Printf("Dry-run: the password of %s would be stored as %s.\n", t.Server.Alias, resolveCredential(ref))
+			return
+		}
+		if err := setCredential(ref, password); err != nil {
+			logrus.Fatalf("Failed to store the password: %v", err)
+		}
+		if !ok {
+			server := t.Server
+			server.Credential = ref.String()
+			if err := inventory.Move(server.Alias, t.entry().ServerLocation, t.entry().ServerLocation, server); err != nil {
+				logrus.Fatalf("Failed to save server: %v", err)
+			}
+		}
+		fmt.Printf("Password of %s stored as %s\n", t.Server.Alias, resolveCredential(ref))
+	},
+}
+
+// credsRmCmd represents the creds rm command
+var credsRmCmd = &cobra.Command{
+	Use:     "rm <alias>",
+	Aliases: []string{"remove"},
+	Short:   "Remove the stored password of a server",
+	Long: `The rm command removes the stored password of a server. The server keeps its credential, so its password
+is asked for and stored again on the next connection.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := credsTarget(args[0])
+		ref, ok, err := t.credential()
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		if !ok {
+			fmt.Printf("%s has no credential\n", t.Server.Alias)
+			return
+		}
+		ref = resolveCredential(ref)
+		if !storedCredential(ref) {
+			logrus.Fatalf("The password of %s is read from %s, remove it there", t.Server.Alias, ref)
+		}
+		question := fmt.Sprintf("Remove the password of %s stored as %s?", t.Server.Alias, ref)
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		if users := credentialUsers(config, ref, t.entry()); len(users) > 0 {
+			question = fmt.Sprintf("Remove the password of %s stored as %s, also used by %s?", t.Server.Alias, ref, strings.Join(users, ", "))
+		}
+		ok, err = confirm(question)
+		if err != nil {
+			logrus.Fatalf("Error reading input: %v", err)
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return
+		}
+		if store.DryRun {
+			return
+		}
+		if err := deleteCredential(ref); err != nil {
+			logrus.Fatalf("Failed to remove the password: %v", err)
+		}
+		fmt.Printf("Password of %s removed\n", t.Server.Alias)
+	},
+}
+
+// credsTestCmd represents the creds test command
+var credsTestCmd = &cobra.Command{
+	Use:   "test <alias>",
+	Short: "Check that the password of a server can be read and is accepted",
+	Long: `The test command reads the password of a server and, when xfreerdp is installed, logs in to the server
+with it without opening a session. It exits non-zero when either fails.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		t := credsTarget(args[0])
+		ref, ok, err := t.credential()
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		if !ok {
+			logrus.Fatalf("%s has no credential, store one with 'ssm creds set %s'", t.Server.Alias, t.Server.Alias)
+		}
+		ref = resolveCredential(ref)
+		password, err := getCredential(ref)
+		if err != nil {
+			logrus.Fatalf("Failed to read the password of %s: %v", t.Server.Alias, err)
+		}
+		fmt.Printf("Password of %s read from %s\n", t.Server.Alias, ref)
+
+		if _, err := exec.LookPath("xfreerdp"); err != nil {
+			fmt.Println("xfreerdp is not installed, the password was not tried on the server")
+			return
+		}
+		// +auth-only logs in and disconnects without opening a window. The password is written to stdin
+		// rather than passed as /p:, where any user of the machine could read it from the process list.
+		c := exec.Command("xfreerdp", "+auth-only", "/cert:ignore", "/from-stdin:force",
+			fmt.Sprintf("/u:%s", t.Server.User), fmt.Sprintf("/v:%s", t.Server.IP))
+		c.Stdin = rdpCredentials(t.Server.User, password)
+		if verbose {
+			c.Stdout, c.Stderr = os.Stdout, os.Stderr
+		}
+		if err := c.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				logrus.Fatalf("%s@%s did not accept the password (xfreerdp exited with %d)", t.Server.User, t.Server.IP, exitErr.ExitCode())
+			}
+			logrus.Fatalf("Failed to run xfreerdp: %v", err)
+		}
+		fmt.Printf("%s@%s accepted the password\n", t.Server.User, t.Server.IP)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(credsCmd)
+	credsCmd.AddCommand(credsListCmd, credsSetCmd, credsRmCmd, credsTestCmd)
+	credsCmd.PersistentFlags().StringVarP(&credsGroup, "group", "g", "", "Group of the server, when the alias is used more than once")
+	credsCmd.PersistentFlags().StringVarP(&credsEnvironment, "environment", "e", "", "Environment of the server, when the alias is used more than once")
+	credsListCmd.Flags().StringVarP(&credsSelector, "selector", "l", "", "List only servers matching this selector (e.g. role=db,region!=eu)")
+}
+
+// credsTarget returns the server with the given alias, narrowed down by --group and --environment
+func credsTarget(alias string) serverTarget {
+	config, err := inventory.Load()
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
+	}
+	entry, err := inventory.Get(alias, store.ServerLocation{Group: credsGroup, Environment: credsEnvironment})
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	def, _ := config.EnvironmentDef(entry.Environment)
+	return serverTarget{Group: entry.Group, Environment: entry.Environment, EnvDef: def, Server: entry.Server}
+}
+
+// credentialStatus tells whether the password ref names is there, without unlocking the vault or
+// running commands
+func credentialStatus(ref store.CredentialRef) string {
+	switch ref.Scheme {
+	case store.CredentialKeyring:
+		if _, err := getCredential(ref); err != nil {
+			return "missing"
+		}
+		return "stored"
+	case store.CredentialVault:
+		if vault, err := store.LoadVault(); err == nil && vault.Has(ref.Key) {
+			return "stored"
+		}
+		return "missing"
+	case store.CredentialEnv:
+		if os.Getenv(ref.Key) == "" {
+			return "unset"
+		}
+		return "set"
+	}
+	return "read on connect"
+}
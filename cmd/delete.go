@@ -2,7 +2,6 @@
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"net"
 	"os"
@@ -13,13 +12,13 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"golang.org/x/term"
 )
 
 var (
 	serverToDelete string
 	cleanConfig    bool
+	deleteSelector string
 )
 
 // deleteCmd represents the delete command
@@ -29,9 +28,13 @@ var deleteCmd = &cobra.Command{
 	Long: `Delete a server from the configuration. This command will remove a server by its IP address
 and can optionally clean up empty groups and environments.
 
+Servers can also be chosen with a selector, optionally combined with --server; all matches are listed
+and deleted after a single confirmation:
+		ssm delete -l env=staging,deprecated
+
 If no flags are provided, an interactive UI will be launched to select and delete servers.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if serverToDelete != "" {
+		if serverToDelete != "" || deleteSelector != "" {
 			deleteServerNonInteractive()
 		} else {
 			runInteractiveDelete()
@@ -42,6 +45,7 @@ If no flags are provided, an interactive UI will be launched to select and delet
 func init() {
 	rootCmd.AddCommand(deleteCmd)
 	deleteCmd.Flags().StringVarP(&serverToDelete, "server", "s", "", "server to delete (hostname or IP)")
+	deleteCmd.Flags().StringVarP(&deleteSelector, "selector", "l", "", "delete all servers matching this selector (e.g. role=db,region!=eu)")
 	deleteCmd.Flags().BoolVarP(&cleanConfig, "clean-config", "c", false, "Clean unused groups")
 }
 
@@ -55,6 +59,7 @@ type ServerItem struct {
 	Env         string
 	Name        string
 	IP          string
+	Target      serverTarget
 }
 
 type deleteModel struct {
@@ -67,12 +72,16 @@ type deleteModel struct {
 	config       *store.Config
 	scrollOffset int
 	windowHeight int
+	// guarded is set when the selection touches protected environments and the deletion has to be
+	// confirmed by typing once the interface has closed
+	guarded bool
 }
 
 func initialDeleteModel(config *store.Config) deleteModel {
 	var items []ServerItem
 	for gi, group := range config.Groups {
 		for ei, env := range group.Environment {
+			def, _ := config.EnvironmentDef(env.Name)
 			for si, server := range env.Servers {
 				items = append(items, ServerItem{
 					GroupIndex:  gi,
@@ -82,6 +91,7 @@ func initialDeleteModel(config *store.Config) deleteModel {
 					Env:         env.Name,
 					Name:        server.HostName,
 					IP:          server.IP,
+					Target:      serverTarget{Group: group.Name, Environment: env.Name, EnvDef: def, Server: server},
 				})
 			}
 		}
@@ -111,7 +121,7 @@ func (m deleteModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.confirming {
 			switch msg.String() {
 			case "y", "Y":
-				return m, deleteSelectedServers(m)
+				return m.deleteOrGuard()
 			case "n", "N", "esc", "q":
 				m.confirming = false
 				m.status = "Deletion cancelled"
@@ -148,9 +158,15 @@ func (m deleteModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 		case "d":
+			if len(m.selected) > 0 && assumeYes {
+				return m.deleteOrGuard()
+			}
 			if len(m.selected) > 0 {
 				m.confirming = true
 				m.status = fmt.Sprintf("Delete %d selected servers? (y/n)", len(m.selected))
+				if n := len(protectedSelection(m.selectedTargets())); n > 0 {
+					m.status += fmt.Sprintf(" %d in protected environments will need a typed confirmation.", n)
+				}
 			} else {
 				m.status = "No servers selected"
 			}
@@ -159,6 +175,26 @@ func (m deleteModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// deleteOrGuard deletes the selection straight away, or closes the interface so that a selection touching
+// protected environments can be confirmed by typing
+func (m deleteModel) deleteOrGuard() (tea.Model, tea.Cmd) {
+	if len(protectedSelection(m.selectedTargets())) > 0 {
+		m.guarded = true
+		m.quitting = true
+		return m, tea.Quit
+	}
+	return m, deleteSelectedServers(m)
+}
+
+// selectedTargets returns the selected servers
+func (m deleteModel) selectedTargets() []serverTarget {
+	var targets []serverTarget
+	for idx := range m.selected {
+		targets = append(targets, m.items[idx].Target)
+	}
+	return targets
+}
+
 func (m deleteModel) getViewportHeight() int {
 	reservedLines := 5 // Header + Status + Instructions
 	return max(m.windowHeight-reservedLines, 1)
@@ -187,12 +223,14 @@ func (m deleteModel) View() string {
 		}
 
 		// Format: > [x] Group / Env / Name (IP)
-		line := fmt.Sprintf("%s %s %s / %s / %s (%s)\n", cursor, checkbox, item.Group, item.Env, item.Name, item.IP)
+		line := fmt.Sprintf("%s %s %s / %s / %s (%s)", cursor, checkbox, item.Group, item.Env, item.Name, item.IP)
 		if m.cursor == i {
-			s += lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Render(line)
-		} else {
-			s += line
+			line = lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Render(line)
+		}
+		if item.Target.EnvDef.Protected {
+			line += " " + lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render("[protected]")
 		}
+		s += line + "\n"
 	}
 
 	s += "\n"
@@ -215,56 +253,36 @@ func (m deleteModel) View() string {
 // Logic to delete servers
 
 func deleteSelectedServers(m deleteModel) tea.Cmd {
-	keysToDelete := make(map[string]struct{})
-	for idx := range m.selected {
-		item := m.items[idx]
-		itemKey := fmt.Sprintf("%s|%s|%s|%s", item.Group, item.Env, item.Name, item.IP)
-		keysToDelete[itemKey] = struct{}{}
+	var entries []store.Entry
+	for _, t := range m.selectedTargets() {
+		entries = append(entries, t.entry())
 	}
-
-	var newGroups []store.Group
-
-	for _, grp := range m.config.Groups {
-		var newEnv []store.Env
-		for _, env := range grp.Environment {
-			var newServers []store.Server
-			for _, srv := range env.Servers {
-				itemKey := fmt.Sprintf("%s|%s|%s|%s", grp.Name, env.Name, srv.HostName, srv.IP)
-				if _, deleteIt := keysToDelete[itemKey]; !deleteIt {
-					newServers = append(newServers, srv)
-				}
-			}
-			env.Servers = newServers
-			if len(env.Servers) > 0 {
-				newEnv = append(newEnv, env)
-			}
-		}
-		grp.Environment = newEnv
-		if len(grp.Environment) > 0 {
-			newGroups = append(newGroups, grp)
-		}
-	}
-
-	m.config.Groups = newGroups
-	viper.Set("groups", m.config.Groups)
-
-	if err := viper.WriteConfig(); err != nil {
+	if err := inventory.Delete(entries...); err != nil {
 		logrus.Error("Failed to write config:", err)
+		return tea.Quit
 	}
+	forgetCredentials(entries)
 
 	return tea.Quit
 }
 
 func runInteractiveDelete() {
-	var config store.Config
-	if err := viper.Unmarshal(&config); err != nil {
+	config, err := inventory.Load()
+	if err != nil {
 		fmt.Printf("Error: Failed to load configuration: %v\n", err)
 		return
 	}
 
-	p := tea.NewProgram(initialDeleteModel(&config))
-	if _, err := p.Run(); err != nil {
+	p := tea.NewProgram(initialDeleteModel(config))
+	final, err := p.Run()
+	if err != nil {
 		fmt.Printf("Error running interactive delete: %v\n", err)
+		return
+	}
+	if m, ok := final.(deleteModel); ok && m.guarded {
+		if store.DryRun || guardProtected("delete", "", m.selectedTargets()) {
+			deleteSelectedServers(m)
+		}
 	}
 }
 
@@ -272,81 +290,106 @@ func runInteractiveDelete() {
 
 func deleteServerNonInteractive() {
 	target := strings.TrimSpace(serverToDelete)
-	if target == "" {
+	if target == "" && deleteSelector == "" {
 		fmt.Println("Error: Please provide a server alias, hostname, or IP address to delete")
 		return
 	}
-	resolvedIP := resolveIP(target)
+	selector, err := store.ParseSelector(deleteSelector)
+	if err != nil {
+		fmt.Printf("Error: Invalid selector: %v\n", err)
+		return
+	}
+	resolvedIP := ""
+	if target != "" {
+		resolvedIP = resolveIP(target)
+	}
 
-	var config store.Config
-	if err := viper.Unmarshal(&config); err != nil {
+	config, err := inventory.Load()
+	if err != nil {
 		fmt.Printf("Error: Failed to load configuration: %v\n", err)
 		return
 	}
 
-	serverFound := false
-	for gi := range config.Groups {
-		for ei := range config.Groups[gi].Environment {
-			env := &config.Groups[gi].Environment[ei]
-			for si := 0; si < len(env.Servers); si++ {
-				srv := env.Servers[si]
-				matches := srv.Alias == target || srv.HostName == target || srv.IP == target || (resolvedIP != "" && srv.IP == resolvedIP)
-				if matches {
-					fmt.Printf("Server '%s' (%s, IP: %s) found in environment '%s' of group '%s'\n", srv.Alias, srv.HostName, srv.IP, env.Name, config.Groups[gi].Name)
-					reader := bufio.NewReader(os.Stdin)
-					fmt.Print("Are you sure you want to delete this server? (y/n): ")
-					response, err := reader.ReadString('\n')
-					if err != nil {
-						fmt.Printf("Error reading input: %v\n", err)
-						return
-					}
-					serverFound = true
-					response = strings.TrimSpace(strings.ToLower(response))
-					if response == "y" || response == "yes" {
-						env.Servers = append(env.Servers[:si], env.Servers[si+1:]...)
-						fmt.Println("Server deleted successfully!")
-						si-- // Adjust index after deletion
-					} else {
-						fmt.Println("Server deletion aborted.")
-					}
-				}
-			}
+	var matches []serverTarget
+	for _, t := range collectServers(config, "", "", selector) {
+		srv := t.Server
+		if target == "" || srv.Alias == target || srv.HostName == target || srv.IP == target || (resolvedIP != "" && srv.IP == resolvedIP) {
+			matches = append(matches, t)
 		}
 	}
 
-	if !serverFound {
-		fmt.Printf("Server matching '%s' was not found in the configuration\n", serverToDelete)
+	if len(matches) == 0 {
+		fmt.Printf("No server matching '%s' (selector: '%s') was found in the configuration\n", serverToDelete, deleteSelector)
 		return
 	}
 
-	if cleanConfig {
-		fmt.Println("Cleaning configuration...")
-		cleanConfiguration(&config)
+	var toDelete []store.Entry
+	if deleteSelector != "" {
+		// Selectors may match many servers, so list them all and confirm once
+		fmt.Printf("%d server(s) match:\n", len(matches))
+		for _, t := range matches {
+			fmt.Printf("  %s/%s/%s (%s, IP: %s)\n", t.Group, t.Environment, t.Server.Alias, t.Server.HostName, t.Server.IP)
+		}
+		if !store.DryRun && !guardProtected("delete", "", matches) {
+			return
+		}
+		ok, err := confirm(fmt.Sprintf("Are you sure you want to delete %d server(s)?", len(matches)))
+		if err != nil {
+			fmt.Printf("Error reading input: %v\n", err)
+			return
+		}
+		if !ok {
+			fmt.Println("Server deletion aborted.")
+			return
+		}
+		for _, t := range matches {
+			toDelete = append(toDelete, t.entry())
+		}
+	} else {
+		for _, t := range matches {
+			srv := t.Server
+			fmt.Printf("Server '%s' (%s, IP: %s) found in environment '%s' of group '%s'\n", srv.Alias, srv.HostName, srv.IP, t.Environment, t.Group)
+			if !store.DryRun && !guardProtected("delete", "", []serverTarget{t}) {
+				continue
+			}
+			ok, err := confirm("Are you sure you want to delete this server?")
+			if err != nil {
+				fmt.Printf("Error reading input: %v\n", err)
+				return
+			}
+			if ok {
+				toDelete = append(toDelete, t.entry())
+			} else {
+				fmt.Println("Server deletion aborted.")
+			}
+		}
 	}
 
-	viper.Set("groups", config.Groups)
-	if err := viper.WriteConfig(); err != nil {
-		fmt.Printf("Error: Failed to write configuration: %v\n", err)
-		return
+	if len(toDelete) > 0 {
+		if err := inventory.Delete(toDelete...); err != nil {
+			fmt.Printf("Error: Failed to write configuration: %v\n", err)
+			return
+		}
+		forgetCredentials(toDelete)
+		if !store.DryRun {
+			fmt.Printf("%d server(s) deleted successfully!\n", len(toDelete))
+		}
 	}
-	fmt.Println("Configuration updated successfully")
-}
 
-func cleanConfiguration(config *store.Config) {
-	for gi := len(config.Groups) - 1; gi >= 0; gi-- {
-		group := &config.Groups[gi]
-		for ei := len(group.Environment) - 1; ei >= 0; ei-- {
-			env := &group.Environment[ei]
-			if len(env.Servers) == 0 {
-				group.Environment = append(group.Environment[:ei], group.Environment[ei+1:]...)
-				fmt.Printf("Removed empty environment: %s\n", env.Name)
-			}
+	if cleanConfig {
+		fmt.Println("Cleaning configuration...")
+		removed, err := inventory.Prune()
+		if err != nil {
+			fmt.Printf("Error: Failed to write configuration: %v\n", err)
+			return
 		}
-		if len(group.Environment) == 0 {
-			config.Groups = append(config.Groups[:gi], config.Groups[gi+1:]...)
-			fmt.Printf("Removed empty group: %s\n", group.Name)
+		for _, name := range removed {
+			fmt.Printf("Removed empty %s\n", name)
 		}
 	}
+	if !store.DryRun && (len(toDelete) > 0 || cleanConfig) {
+		fmt.Println("Configuration updated successfully")
+	}
 }
 
 func resolveIP(input string) string {
@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+	"github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorJSON    bool
+	doctorOffline bool
+)
+
+// maxParallelChecks bounds the number of concurrent network checks
+const maxParallelChecks = 8
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+// checkResult is a single line of the doctor report
+type checkResult struct {
+	Check   string      `json:"check"`
+	Target  string      `json:"target,omitempty"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message"`
+	Hint    string      `json:"hint,omitempty"`
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:     "doctor",
+	Short:   "Check your configuration, keys, tools and servers for problems",
+	Aliases: []string{"validate"},
+	Long: `The doctor command runs a health check of the whole setup:
+
+  - .ssm.yaml parses and passes schema validation
+  - no alias is used twice across groups
+  - hostnames resolve and match the stored IP addresses
+  - the Ed25519 key pair exists with safe permissions (0600 key, 0700 ~/.ssh)
+  - ssh and xfreerdp are available on PATH
+  - the OS keyring is reachable
+  - every SSH server accepts your key
+
+Each check reports pass, warn or fail together with a hint on how to fix it.
+Use --offline to skip DNS and SSH checks, and --json for machine readable output.
+The command exits with a non-zero status if any check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		results := runDoctor()
+		if doctorJSON {
+			data, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				logrus.Fatalf("Failed to render report: %v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			printDoctorReport(results)
+		}
+		for _, r := range results {
+			if r.Status == checkFail {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().BoolVar(&doctorJSON, "json", false, "Print the report as JSON")
+	doctorCmd.Flags().BoolVar(&doctorOffline, "offline", false, "Skip DNS resolution and SSH authentication checks")
+}
+
+func runDoctor() []checkResult {
+	var results []checkResult
+
+	config, err := inventory.Load()
+	if err != nil {
+		results = append(results, checkResult{
+			Check:   "config",
+			Status:  checkFail,
+			Message: err.Error(),
+			Hint:    "Fix the reported line with 'ssm edit' or restore a snapshot with 'ssm backup list' and 'ssm restore'",
+		})
+		config = &store.Config{}
+	} else if err := store.Validate(config); err != nil {
+		results = append(results, checkResult{
+			Check:   "config",
+			Status:  checkFail,
+			Message: strings.ReplaceAll(err.Error(), "\n", "; "),
+			Hint:    "Fix the listed entries with 'ssm edit'",
+		})
+	} else {
+		path, _ := store.ConfigPath()
+		results = append(results, checkResult{Check: "config", Status: checkPass, Message: fmt.Sprintf("%s is valid (version %d, %s storage)", displayPath(path), config.Version, config.Storage())})
+	}
+
+	results = append(results, checkDuplicateAliases(config)...)
+	results = append(results, checkKeyPair()...)
+	results = append(results, checkBinaries(config)...)
+	results = append(results, checkKeyring())
+	if !doctorOffline {
+		results = append(results, checkServers(config)...)
+	}
+	return results
+}
+
+func checkDuplicateAliases(config *store.Config) []checkResult {
+	duplicates := store.DuplicateAliases(config)
+	if len(duplicates) == 0 {
+		return []checkResult{{Check: "aliases", Status: checkPass, Message: "all aliases are unique"}}
+	}
+
+	aliases := make([]string, 0, len(duplicates))
+	for alias := range duplicates {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	var results []checkResult
+	for _, alias := range aliases {
+		results = append(results, checkResult{
+			Check:   "aliases",
+			Target:  alias,
+			Status:  checkFail,
+			Message: fmt.Sprintf("alias is used by %s", strings.Join(duplicates[alias], ", ")),
+			Hint:    "Give each server a unique alias with 'ssm edit'",
+		})
+	}
+	return results
+}
+
+func checkKeyPair() []checkResult {
+	privateKey, err := ssh.DefaultKeyPath()
+	if err != nil {
+		return []checkResult{{Check: "ssh-key", Status: checkFail, Message: err.Error()}}
+	}
+	sshDir := filepath.Dir(privateKey)
+	var results []checkResult
+
+	info, err := os.Stat(privateKey)
+	if err != nil {
+		results = append(results, checkResult{
+			Check:   "ssh-key",
+			Target:  displayPath(privateKey),
+			Status:  checkFail,
+			Message: "private key not found",
+			Hint:    "Create one with 'ssh-keygen -t ed25519' or fetch it with 'ssm sync pull'",
+		})
+	} else if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		results = append(results, checkResult{
+			Check:   "ssh-key",
+			Target:  displayPath(privateKey),
+			Status:  checkFail,
+			Message: fmt.Sprintf("private key has permissions %04o", info.Mode().Perm()),
+			Hint:    fmt.Sprintf("chmod 600 %s", privateKey),
+		})
+	} else {
+		results = append(results, checkResult{Check: "ssh-key", Target: displayPath(privateKey), Status: checkPass, Message: "private key present"})
+	}
+
+	if _, err := os.Stat(privateKey + ".pub"); err != nil {
+		results = append(results, checkResult{
+			Check:   "ssh-key",
+			Target:  displayPath(privateKey + ".pub"),
+			Status:  checkFail,
+			Message: "public key not found",
+			Hint:    fmt.Sprintf("ssh-keygen -y -f %s > %s.pub", privateKey, privateKey),
+		})
+	} else {
+		results = append(results, checkResult{Check: "ssh-key", Target: displayPath(privateKey + ".pub"), Status: checkPass, Message: "public key present"})
+	}
+
+	if info, err := os.Stat(sshDir); err == nil && runtime.GOOS != "windows" && info.Mode().Perm() != 0700 {
+		results = append(results, checkResult{
+			Check:   "ssh-key",
+			Target:  displayPath(sshDir),
+			Status:  checkWarn,
+			Message: fmt.Sprintf("directory has permissions %04o", info.Mode().Perm()),
+			Hint:    fmt.Sprintf("chmod 700 %s", sshDir),
+		})
+	}
+	return results
+}
+
+func checkBinaries(config *store.Config) []checkResult {
+	var results []checkResult
+	if path, err := exec.LookPath("ssh"); err != nil {
+		results = append(results, checkResult{Check: "binaries", Target: "ssh", Status: checkFail, Message: "ssh not found on PATH", Hint: "Install an OpenSSH client"})
+	} else {
+		results = append(results, checkResult{Check: "binaries", Target: "ssh", Status: checkPass, Message: path})
+	}
+
+	hasRDP := false
+	for _, g := range config.Groups {
+		for _, env := range g.Environment {
+			for _, s := range env.Servers {
+				hasRDP = hasRDP || s.IsRDP
+			}
+		}
+	}
+	if path, err := exec.LookPath("xfreerdp"); err != nil {
+		status := checkPass
+		message := "xfreerdp not found on PATH, not needed as no RDP servers are configured"
+		if hasRDP {
+			status = checkWarn
+			message = "xfreerdp not found on PATH, RDP servers cannot be connected"
+		}
+		results = append(results, checkResult{Check: "binaries", Target: "xfreerdp", Status: status, Message: message, Hint: "Install FreeRDP to connect to RDP servers"})
+	} else {
+		results = append(results, checkResult{Check: "binaries", Target: "xfreerdp", Status: checkPass, Message: path})
+	}
+	return results
+}
+
+func checkKeyring() checkResult {
+	if settings, err := store.LoadLocalSettings(); err != nil {
+		return checkResult{Check: "keyring", Status: checkFail, Message: err.Error(), Hint: "Fix or remove ~/.ssm/local.yaml"}
+	} else if settings.Store() == store.CredentialVault {
+		if _, err := store.LoadVault(); err != nil {
+			return checkResult{Check: "keyring", Status: checkFail, Message: fmt.Sprintf("credentials are stored in the vault: %v", err), Hint: "Create it with 'ssm vault init', or use the OS keyring with 'ssm vault use keyring'"}
+		}
+		return checkResult{Check: "keyring", Status: checkPass, Message: "credentials are stored in the vault"}
+	}
+	if err := security.KeyringAvailable(); err != nil {
+		return checkResult{
+			Check:   "keyring",
+			Status:  checkWarn,
+			Message: fmt.Sprintf("OS keyring is not reachable: %v", err),
+			Hint:    "RDP passwords cannot be stored; start a Secret Service provider such as gnome-keyring, or use the vault with 'ssm vault init'",
+		}
+	}
+	return checkResult{Check: "keyring", Status: checkPass, Message: "OS keyring is reachable"}
+}
+
+// checkServers resolves every hostname and, for SSH servers, verifies that key authentication succeeds
+func checkServers(config *store.Config) []checkResult {
+	type target struct {
+		group, env string
+		server     store.Server
+	}
+	var targets []target
+	for _, g := range config.Groups {
+		for _, env := range g.Environment {
+			for _, s := range env.Servers {
+				targets = append(targets, target{g.Name, env.Name, s})
+			}
+		}
+	}
+
+	results := make([][]checkResult, len(targets))
+	sem := make(chan struct{}, maxParallelChecks)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			name := fmt.Sprintf("%s/%s/%s", t.group, t.env, t.server.Alias)
+			results[i] = append(results[i], checkResolution(name, t.server))
+			if !t.server.IsRDP {
+				results[i] = append(results[i], checkKeyAuth(name, t.server))
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	var flat []checkResult
+	for _, r := range results {
+		flat = append(flat, r...)
+	}
+	return flat
+}
+
+func checkResolution(name string, server store.Server) checkResult {
+	addrs, err := net.LookupHost(server.HostName)
+	if err != nil {
+		if net.ParseIP(server.IP) != nil && server.IP != server.HostName {
+			return checkResult{Check: "dns", Target: name, Status: checkWarn, Message: fmt.Sprintf("%s does not resolve, the stored IP %s will be used", server.HostName, server.IP)}
+		}
+		return checkResult{Check: "dns", Target: name, Status: checkFail, Message: fmt.Sprintf("%s does not resolve: %v", server.HostName, err), Hint: "Check the hostname or your DNS settings"}
+	}
+	for _, addr := range addrs {
+		if addr == server.IP {
+			return checkResult{Check: "dns", Target: name, Status: checkPass, Message: fmt.Sprintf("%s resolves to %s", server.HostName, server.IP)}
+		}
+	}
+	return checkResult{
+		Check:   "dns",
+		Target:  name,
+		Status:  checkWarn,
+		Message: fmt.Sprintf("%s resolves to %s but the stored IP is %s", server.HostName, strings.Join(addrs, ", "), server.IP),
+		Hint:    "Update the ip field with 'ssm edit'",
+	}
+}
+
+func checkKeyAuth(name string, server store.Server) checkResult {
+	client, err := ssh.NewSSHClient(server.User, server.HostName)
+	if err != nil {
+		return checkResult{
+			Check:   "ssh-auth",
+			Target:  name,
+			Status:  checkFail,
+			Message: err.Error(),
+			Hint:    fmt.Sprintf("Install your public key with 'ssm add %s -g <group> -a %s'", server.HostName, server.Alias),
+		}
+	}
+	_ = client.Close()
+	return checkResult{Check: "ssh-auth", Target: name, Status: checkPass, Message: fmt.Sprintf("%s@%s accepts your key", server.User, server.HostName)}
+}
+
+func printDoctorReport(results []checkResult) {
+	styles := map[checkStatus]lipgloss.Style{
+		checkPass: lipgloss.NewStyle().Foreground(lipgloss.Color("42")).Bold(true),
+		checkWarn: lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Bold(true),
+		checkFail: lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Bold(true),
+	}
+	hintStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+
+	counts := make(map[checkStatus]int)
+	for _, r := range results {
+		counts[r.Status]++
+		label := styles[r.Status].Render(fmt.Sprintf("%-4s", strings.ToUpper(string(r.Status))))
+		target := r.Check
+		if r.Target != "" {
+			target += " " + r.Target
+		}
+		fmt.Printf("%s  %-40s %s\n", label, target, r.Message)
+		if r.Hint != "" && r.Status != checkPass {
+			fmt.Println(hintStyle.Render("      hint: " + r.Hint))
+		}
+	}
+	fmt.Printf("\n%d passed, %d warnings, %d failed\n", counts[checkPass], counts[checkWarn], counts[checkFail])
+}
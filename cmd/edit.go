@@ -1,13 +1,15 @@
 package cmd
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
 
+	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // editCmd represents the edit command
@@ -16,25 +18,91 @@ var editCmd = &cobra.Command{
 	Short: "Open the SSM configuration file in a text editor",
 	Long: `The edit command opens the SSM configuration file in your preferred text editor.
 On Linux/macOS it tries nvim, then vi, then nano.
-On Windows it opens the file in notepad.`,
+On Windows it opens the file in notepad.
+
+The changes are only saved once the file parses and passes validation, including the check that every
+environment is declared under 'environments:'. Otherwise you can re-open the editor or discard the changes.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		configFile := viper.ConfigFileUsed()
-		if configFile == "" {
+		configFile, err := store.ConfigPath()
+		if err != nil {
 			logrus.Fatal("No configuration file found")
 		}
+		if err := editConfig(configFile); err != nil {
+			logrus.Fatal(err)
+		}
+	},
+}
 
-		editor, editorArgs := findEditor()
-		editorArgs = append(editorArgs, configFile)
+// editConfig lets the user edit a copy of the configuration and only replaces the file once the copy
+// parses and validates, offering to re-open the editor otherwise
+func editConfig(configFile string) error {
+	original, err := os.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
 
+	tmp, err := os.CreateTemp("", "ssm-edit-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(original); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	editor, editorArgs := findEditor()
+	editorArgs = append(editorArgs, tmp.Name())
+	for {
 		proc := exec.Command(editor, editorArgs...)
 		proc.Stdin = os.Stdin
 		proc.Stdout = os.Stdout
 		proc.Stderr = os.Stderr
-
 		if err := proc.Run(); err != nil {
-			logrus.Fatalf("Failed to open editor: %s", err.Error())
+			return fmt.Errorf("failed to open editor: %w", err)
 		}
-	},
+
+		edited, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read edited configuration: %w", err)
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Println("No changes made.")
+			return nil
+		}
+
+		config, _, err := store.Parse(edited)
+		if err == nil {
+			err = store.Validate(config)
+		}
+		if err == nil {
+			if store.DryRun {
+				store.PrintDiff(configFile, original, edited)
+				return nil
+			}
+			if _, err := store.Snapshot("edit", configFile); err != nil {
+				return fmt.Errorf("failed to back up configuration: %w", err)
+			}
+			if err := store.Replace(edited); err != nil {
+				return fmt.Errorf("failed to save configuration: %w", err)
+			}
+			fmt.Println("Configuration updated successfully")
+			return nil
+		}
+
+		fmt.Printf("The edited configuration is invalid:\n%v\n", err)
+		reopen, err := confirm("Re-open the editor to fix it?")
+		if err != nil {
+			return err
+		}
+		if !reopen {
+			fmt.Println("Changes discarded, the configuration was not modified.")
+			return nil
+		}
+	}
 }
 
 func findEditor() (string, []string) {
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	execEnvironment string
+	execSelector    string
+	execConcurrency int
+)
+
+// execCmd represents the exec command
+var execCmd = &cobra.Command{
+	Use:   "exec [group] -- command",
+	Short: "Run a command on several servers at once",
+	Long: `The exec command runs a shell command over SSH on every server of a group, or on every server
+matching a selector across all groups, in parallel. The output of each server is printed as soon as it finishes.
+
+RDP servers are skipped. Running a command in a protected environment requires typing the environment name
+(or the alias for a single server) first. The command exits with a non-zero status if the command failed on any server.
+
+Examples:
+		ssm exec production -e prod -- uptime
+		ssm exec -l postgres,primary,env=prod -- 'systemctl status postgresql'`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		dash := cmd.ArgsLenAtDash()
+		if dash == -1 || dash == len(args) {
+			return errors.New("requires a command after --, e.g. ssm exec mygroup -- uptime")
+		}
+		if dash > 1 {
+			return errors.New("accepts at most one group before --")
+		}
+		if dash == 0 && execSelector == "" {
+			return errors.New("requires a group or a selector (-l) to choose the servers")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		dash := cmd.ArgsLenAtDash()
+		groupFilter := ""
+		if dash == 1 {
+			groupFilter = args[0]
+		}
+		command := strings.Join(args[dash:], " ")
+
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		targets := collectServers(config, groupFilter, execEnvironment, mustParseSelector(execSelector))
+		if len(targets) == 0 {
+			logrus.Fatalf("No servers found (group: '%s', environment: '%s', selector: '%s')", groupFilter, execEnvironment, execSelector)
+		}
+
+		if !guardProtected("exec", command, targets) {
+			os.Exit(1)
+		}
+		if !runOnServers(targets, command) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().StringVarP(&execEnvironment, "environment", "e", "", "Only run on servers in this environment")
+	execCmd.Flags().StringVarP(&execSelector, "selector", "l", "", "Only run on servers matching this selector (e.g. role=db,region!=eu)")
+	execCmd.Flags().IntVar(&execConcurrency, "concurrency", 8, "Number of servers the command runs on in parallel")
+}
+
+// runOnServers runs command on every SSH target and prints each result as it completes.
+// It reports whether the command succeeded everywhere.
+func runOnServers(targets []serverTarget, command string) bool {
+	okStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("42"))
+	failStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("196"))
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		succeeded = true
+	)
+	sem := make(chan struct{}, max(execConcurrency, 1))
+	for _, t := range targets {
+		if t.Server.IsRDP {
+			fmt.Println(dim.Render(fmt.Sprintf("==> %s (%s) skipped: RDP servers are not supported", t.Server.Alias, t.Server.HostName)))
+			continue
+		}
+		wg.Add(1)
+		go func(t serverTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			output, status, err := runOnServer(t, command)
+
+			mu.Lock()
+			defer mu.Unlock()
+			header := fmt.Sprintf("==> %s (%s) exit %d", t.Server.Alias, t.Server.HostName, status)
+			if err != nil {
+				header = fmt.Sprintf("==> %s (%s) failed: %v", t.Server.Alias, t.Server.HostName, err)
+			}
+			if err != nil || status != 0 {
+				succeeded = false
+				fmt.Println(failStyle.Render(header))
+			} else {
+				fmt.Println(okStyle.Render(header))
+			}
+			if len(output) > 0 {
+				fmt.Print(string(output))
+				if output[len(output)-1] != '\n' {
+					fmt.Println()
+				}
+			}
+		}(t)
+	}
+	wg.Wait()
+	return succeeded
+}
+
+func runOnServer(t serverTarget, command string) ([]byte, int, error) {
+	client, err := ssh.NewSSHClient(t.Server.User, t.Server.HostName)
+	if err != nil {
+		return nil, -1, err
+	}
+	defer client.Close()
+	return ssh.RunCommand(client, command)
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/AshutoshPatole/ssm/internal/facts"
+	"github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	factsEnvironment string
+	factsSelector    string
+	factsJSON        bool
+	factsConcurrency int
+)
+
+// factsCmd represents the facts command
+var factsCmd = &cobra.Command{
+	Use:   "facts [group]",
+	Short: "Collect OS, uptime and resource usage from servers",
+	Long: `The facts command connects to every server, or the servers of one group, over SSH in parallel and
+collects the operating system, kernel, uptime, CPU count and load, memory and root disk usage.
+
+Results are cached per server under ~/.ssm/cache/facts and shown by 'ssm list' and in the connect picker.
+Windows/RDP servers are marked as unsupported.
+
+Examples:
+		ssm facts
+		ssm facts production -e prod
+		ssm facts -l role=db
+		ssm facts --json`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		groupFilter := ""
+		if len(args) == 1 {
+			groupFilter = args[0]
+		}
+		targets := collectServers(config, groupFilter, factsEnvironment, mustParseSelector(factsSelector))
+		if len(targets) == 0 {
+			logrus.Fatalf("No servers found (group: '%s', environment: '%s', selector: '%s')", groupFilter, factsEnvironment, factsSelector)
+		}
+
+		rows := gatherFacts(targets)
+		if factsJSON {
+			data, err := json.MarshalIndent(rows, "", "  ")
+			if err != nil {
+				logrus.Fatalf("Failed to render results: %v", err)
+			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Println(renderFactsTable(rows))
+		}
+
+		for _, r := range rows {
+			if r.Status == factsFailed {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(factsCmd)
+	factsCmd.Flags().StringVarP(&factsEnvironment, "environment", "e", "", "Only collect facts from servers in this environment")
+	factsCmd.Flags().StringVarP(&factsSelector, "selector", "l", "", "Only collect facts from servers matching this selector (e.g. role=db,region!=eu)")
+	factsCmd.Flags().BoolVar(&factsJSON, "json", false, "Print results as JSON")
+	factsCmd.Flags().IntVar(&factsConcurrency, "concurrency", 16, "Number of servers queried in parallel")
+}
+
+const (
+	factsOK          = "ok"
+	factsUnsupported = "unsupported"
+	factsFailed      = "failed"
+)
+
+// factsRow is one server in the facts report
+type factsRow struct {
+	Group       string       `json:"group"`
+	Environment string       `json:"environment"`
+	Alias       string       `json:"alias"`
+	Host        string       `json:"host"`
+	Status      string       `json:"status"`
+	Facts       *facts.Facts `json:"facts,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// gatherFacts collects facts from all SSH targets with bounded concurrency and caches the results
+func gatherFacts(targets []serverTarget) []factsRow {
+	rows := make([]factsRow, len(targets))
+	sem := make(chan struct{}, max(factsConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		rows[i] = factsRow{Group: t.Group, Environment: t.Environment, Alias: t.Server.Alias, Host: t.Server.HostName}
+		if t.Server.IsRDP {
+			rows[i].Status = factsUnsupported
+			continue
+		}
+		wg.Add(1)
+		go func(i int, s store.Server) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			f, err := collectFacts(s)
+			if err != nil {
+				rows[i].Status = factsFailed
+				rows[i].Error = err.Error()
+				return
+			}
+			rows[i].Status = factsOK
+			rows[i].Facts = f
+			if err := facts.Save(s.HostName, f); err != nil {
+				logrus.Warnf("Failed to cache facts for %s: %v", s.HostName, err)
+			}
+		}(i, t.Server)
+	}
+	wg.Wait()
+	return rows
+}
+
+func collectFacts(s store.Server) (*facts.Facts, error) {
+	client, err := ssh.NewSSHClient(s.User, s.HostName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return facts.Collect(client)
+}
+
+func renderFactsTable(rows []factsRow) string {
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	failStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(dim).
+		Headers("GROUP", "ENV", "ALIAS", "HOST", "OS", "KERNEL", "UPTIME", "CPU", "MEM", "DISK")
+
+	for _, r := range rows {
+		cells := []string{r.Group, r.Environment, r.Alias, r.Host}
+		switch r.Status {
+		case factsOK:
+			cells = append(cells, factsCells(r.Facts)...)
+		case factsUnsupported:
+			cells = append(cells, dim.Render("unsupported (RDP)"), "", "", "", "", "")
+		default:
+			cells = append(cells, failStyle.Render(r.Error), "", "", "", "", "")
+		}
+		t.Row(cells...)
+	}
+	return t.Render()
+}
+
+// factsCells formats the OS, kernel, uptime, CPU, memory and disk columns
+func factsCells(f *facts.Facts) []string {
+	if f == nil {
+		return []string{"-", "-", "-", "-", "-", "-"}
+	}
+	percent := func(v float64) string {
+		if v < 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f%%", v)
+	}
+	cpu := "-"
+	if f.CPUs > 0 {
+		cpu = fmt.Sprintf("%d (%.2f)", f.CPUs, f.Load1)
+	}
+	return []string{f.OS, f.Kernel, f.Uptime(), cpu, percent(f.MemoryUsage()), percent(f.DiskUsage())}
+}
@@ -2,6 +2,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -9,7 +10,6 @@ import (
 	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -44,10 +44,13 @@ func readFile() {
 		logrus.Errorf("Error reading file %s: %v", filePath, err)
 		return
 	}
-	var config store.Config
-	err = yaml.Unmarshal(yamlFile, &config)
+	config, _, err := store.Parse(yamlFile)
 	if err != nil {
-		logrus.Errorf("Error parsing YAML config: %v", err)
+		logrus.Errorf("Error parsing YAML config %s: %v", filePath, err)
+		return
+	}
+	if err := store.Validate(config); err != nil {
+		logrus.Errorf("Invalid configuration in %s:\n%v", filePath, err)
 		return
 	}
 
@@ -74,17 +77,61 @@ func readFile() {
 		}
 	}
 
+	// Imported servers must use environments declared in the local configuration, as with ssm add
+	localConfig, err := inventory.Load()
+	if err != nil {
+		logrus.Errorf("Failed to load configuration: %v", err)
+		return
+	}
+	var envErrs []error
+	for _, group := range groupsToImport {
+		for _, environment := range group.Environment {
+			if err := localConfig.CheckEnvironment(environment.Name); err != nil {
+				envErrs = append(envErrs, fmt.Errorf("group %q: %w", group.Name, err))
+			}
+		}
+	}
+	if len(envErrs) > 0 {
+		logrus.Errorf("Cannot import %s:\n%v", filePath, errors.Join(envErrs...))
+		return
+	}
+
 	for _, group := range groupsToImport {
 		fmt.Println("Importing group:", group.Name)
 		for _, environment := range group.Environment {
+			at := store.ServerLocation{Group: group.Name, Environment: environment.Name}
 			for _, host := range environment.Servers {
-				fmt.Printf("Enter password for server %s (%s@%s):\n", host.Alias, host.User, host.HostName)
-				newPassword, err := ssh.AskPassword()
+				if err := localConfig.CheckAdd(at, importedServer(host)); err != nil {
+					logrus.Errorf("Skipping server %s: %v", host.HostName, err)
+					continue
+				}
+				if store.DryRun {
+					if err := inventory.Add(at, importedServer(host)); err != nil {
+						logrus.Errorf("Skipping server %s: %v", host.HostName, err)
+					}
+					continue
+				}
+				server := importedServer(host)
+				newPassword, err := serverPassword(at, server, fmt.Sprintf("Enter password for server %s (%s@%s):", host.Alias, host.User, host.HostName))
 				if err != nil {
 					logrus.Errorf("Skipping server %s: %v", host.HostName, err)
 					continue
 				}
-				store.Save(group.Name, environment.Name, host.HostName, host.User, host.Alias, "", host.IsRDP)
+				if server.IsRDP && server.Credential == "" {
+					ref, err := newCredentialRef(at, server.HostName)
+					if err == nil {
+						err = setCredential(ref, newPassword)
+					}
+					if err != nil {
+						logrus.Errorf("Skipping server %s: error storing credential: %v", host.HostName, err)
+						continue
+					}
+					server.Credential = ref.String()
+				}
+				if err := inventory.Add(at, server); err != nil {
+					logrus.Errorf("Skipping server %s: %v", host.HostName, err)
+					continue
+				}
 				if !host.IsRDP {
 					ssh.InitSSHConnection(host.User, newPassword, host.HostName, group.Name, environment.Name, host.Alias, setupDotFile)
 				}
@@ -92,3 +139,21 @@ func readFile() {
 		}
 	}
 }
+
+// importedServer keeps the fields of an imported server that describe it, dropping local state such as
+// keyring and vault keys and the key rotation time. Credentials read from the environment or a command
+// are kept, they do not depend on the machine.
+func importedServer(s store.Server) store.Server {
+	imported := store.Server{
+		HostName: s.HostName,
+		Alias:    s.Alias,
+		User:     s.User,
+		IsRDP:    s.IsRDP,
+		Tags:     s.Tags,
+		Labels:   s.Labels,
+	}
+	if ref, err := store.ParseCredential(s.Credential); err == nil && (ref.Scheme == store.CredentialEnv || ref.Scheme == store.CredentialCommand) {
+		imported.Credential = s.Credential
+	}
+	return imported
+}
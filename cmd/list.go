@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/facts"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listEnvironment string
+	listSelector    string
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list [group]",
+	Short: "List servers together with their cached facts",
+	Long: `The list command prints every server, or the servers of one group, in a table.
+
+Facts gathered by 'ssm facts' are shown from the local cache together with their age; no connection
+is made to the servers.
+
+Examples:
+		ssm list
+		ssm list production -e prod
+		ssm list -l postgres,primary,env=prod`,
+	Aliases: []string{"ls"},
+	Args:    cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		groupFilter := ""
+		if len(args) == 1 {
+			groupFilter = args[0]
+		}
+		targets := collectServers(config, groupFilter, listEnvironment, mustParseSelector(listSelector))
+		if len(targets) == 0 {
+			logrus.Fatalf("No servers found (group: '%s', environment: '%s', selector: '%s')", groupFilter, listEnvironment, listSelector)
+		}
+		fmt.Println(renderServerList(config, targets))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVarP(&listEnvironment, "environment", "e", "", "Only list servers in this environment")
+	listCmd.Flags().StringVarP(&listSelector, "selector", "l", "", "Only list servers matching this selector (e.g. role=db,region!=eu)")
+}
+
+func renderServerList(config *store.Config, targets []serverTarget) string {
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+	headers := []string{"GROUP", "ENV", "ALIAS", "HOST", "IP", "USER", "TYPE", "TAGS", "OS", "KERNEL", "UPTIME", "CPU", "MEM", "DISK", "FACTS AGE"}
+	// The source column is only shown when servers come from inventory layers
+	layered := slices.ContainsFunc(targets, func(t serverTarget) bool { return t.Server.Source != "" })
+	if layered {
+		headers = append(headers, "SOURCE")
+	}
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(dim).
+		Headers(headers...)
+
+	for _, target := range targets {
+		s := target.Server
+		cells := []string{target.Group, environmentLabel(config, target.Environment), s.Alias, s.HostName, s.IP, s.User}
+		if s.IsRDP {
+			cells = append(cells, "rdp", formatTags(s), dim.Render("unsupported"), "", "", "", "", "", "")
+		} else if f := facts.Cached(s.HostName); f != nil {
+			cells = append(cells, "ssh", formatTags(s))
+			cells = append(cells, factsCells(f)...)
+			cells = append(cells, formatAge(time.Since(f.CollectedAt)))
+		} else {
+			cells = append(cells, "ssh", formatTags(s), "-", "-", "-", "-", "-", "-", dim.Render("never"))
+		}
+		if layered {
+			cells = append(cells, sourceLabel(s))
+		}
+		t.Row(cells...)
+	}
+	return t.Render()
+}
+
+// sourceLabel renders the inventory layer a server was read from
+func sourceLabel(s store.Server) string {
+	if s.Source == "" {
+		return "personal"
+	}
+	return displayPath(s.Source)
+}
+
+// formatTags renders the tags of a server followed by its labels in key order
+func formatTags(s store.Server) string {
+	parts := slices.Clone(s.Tags)
+	for _, key := range slices.Sorted(maps.Keys(s.Labels)) {
+		parts = append(parts, key+"="+s.Labels[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatAge renders a duration such as the age of cached facts in its largest unit
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours())/24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return "<1m"
+	}
+}
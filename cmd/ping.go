@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/ssh"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	pingEnvironment string
+	pingSelector    string
+	pingJSON        bool
+	pingTimeout     time.Duration
+	pingConcurrency int
+)
+
+// pingCmd represents the ping command
+var pingCmd = &cobra.Command{
+	Use:   "ping [group]",
+	Short: "Check which servers are reachable",
+	Long: `The ping command checks every server, or the servers of one group, concurrently.
+
+For SSH servers it checks TCP reachability on port 22, performs the SSH handshake (verifying the host key
+against ~/.ssh/known_hosts when the host is listed there) and authenticates with your key.
+For RDP servers it checks TCP reachability on port 3389.
+
+Failures are reported as dns-failure, refused, timeout, unreachable, handshake-failed, host-key-mismatch
+or auth-failed. The command exits with a non-zero status if any server is not ok.
+
+Examples:
+		ssm ping
+		ssm ping production -e prod
+		ssm ping -l role=db,env=prod
+		ssm ping --json`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		groupFilter := ""
+		if len(args) == 1 {
+			groupFilter = args[0]
+		}
+		targets := collectServers(config, groupFilter, pingEnvironment, mustParseSelector(pingSelector))
+		if len(targets) == 0 {
+			logrus.Fatalf("No servers found (group: '%s', environment: '%s', selector: '%s')", groupFilter, pingEnvironment, pingSelector)
+		}
+
+		rows := make([]pingRow, len(targets))
+		for i, t := range targets {
+			rows[i] = newPingRow(t)
+		}
+
+		if pingJSON || !term.IsTerminal(int(os.Stdout.Fd())) {
+			runPings(rows, nil)
+			if pingJSON {
+				data, err := json.MarshalIndent(rows, "", "  ")
+				if err != nil {
+					logrus.Fatalf("Failed to render results: %v", err)
+				}
+				fmt.Println(string(data))
+			} else {
+				fmt.Println(renderPingTable(rows))
+			}
+		} else {
+			final, err := tea.NewProgram(pingModel{rows: rows, pending: len(rows)}).Run()
+			if err != nil {
+				logrus.Fatalf("Error running ping interface: %v", err)
+			}
+			rows = final.(pingModel).rows
+		}
+
+		for _, r := range rows {
+			if r.Status != ssh.ProbeOK {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pingCmd)
+	pingCmd.Flags().StringVarP(&pingEnvironment, "environment", "e", "", "Only check servers in this environment")
+	pingCmd.Flags().StringVarP(&pingSelector, "selector", "l", "", "Only check servers matching this selector (e.g. role=db,region!=eu)")
+	pingCmd.Flags().BoolVar(&pingJSON, "json", false, "Print results as JSON")
+	pingCmd.Flags().DurationVar(&pingTimeout, "timeout", 5*time.Second, "Timeout for each check")
+	pingCmd.Flags().IntVar(&pingConcurrency, "concurrency", 16, "Number of servers checked in parallel")
+}
+
+// pingRow is one server in the ping report
+type pingRow struct {
+	Group       string          `json:"group"`
+	Environment string          `json:"environment"`
+	Alias       string          `json:"alias"`
+	Host        string          `json:"host"`
+	Protocol    string          `json:"protocol"`
+	Status      ssh.ProbeStatus `json:"status"`
+	ConnectMs   int64           `json:"connectMs"`
+	HandshakeMs int64           `json:"handshakeMs,omitempty"`
+	Error       string          `json:"error,omitempty"`
+
+	user string
+}
+
+func newPingRow(t serverTarget) pingRow {
+	protocol := "ssh"
+	if t.Server.IsRDP {
+		protocol = "rdp"
+	}
+	return pingRow{
+		Group:       t.Group,
+		Environment: t.Environment,
+		Alias:       t.Server.Alias,
+		Host:        t.Server.HostName,
+		Protocol:    protocol,
+		user:        t.Server.User,
+	}
+}
+
+// probe runs the checks for the row's server and records the outcome
+func (r pingRow) probe() pingRow {
+	var result ssh.ProbeResult
+	if r.Protocol == "rdp" {
+		result = ssh.ProbeTCP(context.Background(), r.Host, ssh.RDPPort, pingTimeout)
+	} else {
+		result = ssh.ProbeSSH(context.Background(), r.user, r.Host, pingTimeout)
+	}
+	r.Status = result.Status
+	r.ConnectMs = result.Connect.Milliseconds()
+	r.HandshakeMs = result.Handshake.Milliseconds()
+	if result.Err != nil {
+		r.Error = result.Err.Error()
+	}
+	return r
+}
+
+// runPings probes all rows with bounded concurrency, reporting each finished row to done when set
+func runPings(rows []pingRow, done func(int, pingRow)) {
+	sem := make(chan struct{}, max(pingConcurrency, 1))
+	var wg sync.WaitGroup
+	for i := range rows {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			rows[i] = rows[i].probe()
+			if done != nil {
+				done(i, rows[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// pingResultMsg delivers a finished probe to the live table
+type pingResultMsg struct {
+	index int
+	row   pingRow
+}
+
+type pingModel struct {
+	rows    []pingRow
+	pending int
+}
+
+func (m pingModel) Init() tea.Cmd {
+	sem := make(chan struct{}, max(pingConcurrency, 1))
+	cmds := make([]tea.Cmd, len(m.rows))
+	for i, row := range m.rows {
+		cmds[i] = func() tea.Msg {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			return pingResultMsg{index: i, row: row.probe()}
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m pingModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case pingResultMsg:
+		m.rows[msg.index] = msg.row
+		m.pending--
+		if m.pending == 0 {
+			return m, tea.Quit
+		}
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" || msg.String() == "q" {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m pingModel) View() string {
+	status := fmt.Sprintf("Checking %d servers, %d remaining...", len(m.rows), m.pending)
+	if m.pending == 0 {
+		status = fmt.Sprintf("Checked %d servers", len(m.rows))
+	}
+	return renderPingTable(m.rows) + "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render(status) + "\n"
+}
+
+func renderPingTable(rows []pingRow) string {
+	statusStyles := map[ssh.ProbeStatus]lipgloss.Style{
+		ssh.ProbeOK:      lipgloss.NewStyle().Foreground(lipgloss.Color("42")),
+		ssh.ProbeTimeout: lipgloss.NewStyle().Foreground(lipgloss.Color("214")),
+		"":               lipgloss.NewStyle().Foreground(lipgloss.Color("240")),
+	}
+	failStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("240"))).
+		Headers("GROUP", "ENV", "ALIAS", "HOST", "PROTO", "STATUS", "CONNECT", "HANDSHAKE")
+
+	for _, r := range rows {
+		status, connect, handshake := "checking", "", ""
+		style, ok := statusStyles[r.Status]
+		if !ok {
+			style = failStyle
+		}
+		if r.Status != "" {
+			status = string(r.Status)
+			connect = fmt.Sprintf("%dms", r.ConnectMs)
+			if r.HandshakeMs > 0 {
+				handshake = fmt.Sprintf("%dms", r.HandshakeMs)
+			}
+		}
+		t.Row(r.Group, r.Environment, r.Alias, r.Host, r.Protocol, style.Render(status), connect, handshake)
+	}
+	return t.Render()
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/AshutoshPatole/ssm/internal/audit"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// protectedSelection returns the targets that belong to protected environments
+func protectedSelection(targets []serverTarget) []serverTarget {
+	var protected []serverTarget
+	for _, t := range targets {
+		if t.EnvDef.Protected {
+			protected = append(protected, t)
+		}
+	}
+	return protected
+}
+
+// guardProtected asks for a typed confirmation before action is performed on servers in protected
+// environments and records the decision in the audit log. Unlike confirm, it is not bypassed by --yes.
+// It reports whether the action may go ahead; targets outside protected environments pass unchecked.
+func guardProtected(action, detail string, targets []serverTarget) bool {
+	protected := protectedSelection(targets)
+	if len(protected) == 0 {
+		return true
+	}
+
+	fmt.Println(protectedBanner(action, protected))
+
+	// A single server is confirmed by its alias, batches by the names of the protected environments
+	expected := protected[0].Server.Alias
+	if expected == "" {
+		expected = protected[0].Server.HostName
+	}
+	if len(protected) > 1 {
+		var envs []string
+		for _, t := range protected {
+			if !slices.Contains(envs, t.Environment) {
+				envs = append(envs, t.Environment)
+			}
+		}
+		expected = strings.Join(envs, ",")
+	}
+
+	fmt.Printf("Type %q to %s, anything else aborts: ", expected, action)
+	response, err := stdinReader.ReadString('\n')
+	confirmed := err == nil && strings.TrimSpace(response) == expected
+	if err != nil {
+		fmt.Println()
+	}
+
+	outcome := "aborted"
+	if confirmed {
+		outcome = "confirmed"
+	}
+	for _, t := range protected {
+		err := audit.Record(audit.Entry{
+			Action:      action,
+			Detail:      detail,
+			Group:       t.Group,
+			Environment: t.Environment,
+			Alias:       t.Server.Alias,
+			Host:        t.Server.HostName,
+			Outcome:     outcome,
+		})
+		if err != nil {
+			logrus.Warnf("Failed to write audit log: %v", err)
+		}
+	}
+
+	if !confirmed {
+		fmt.Println("Aborted.")
+	}
+	return confirmed
+}
+
+// protectedBanner renders the red warning shown before acting on protected environments
+func protectedBanner(action string, protected []serverTarget) string {
+	title := fmt.Sprintf("PROTECTED ENVIRONMENT: %s %s", action, describeTargets(protected))
+	return lipgloss.NewStyle().
+		Bold(true).
+		Foreground(lipgloss.Color("231")).
+		Background(lipgloss.Color("196")).
+		Padding(0, 2).
+		Render(title)
+}
+
+// describeTargets names a single server or summarises a batch
+func describeTargets(targets []serverTarget) string {
+	if len(targets) == 1 {
+		t := targets[0]
+		return fmt.Sprintf("%s (%s) in %s/%s", t.Server.Alias, t.Server.HostName, t.Group, t.Environment)
+	}
+	return fmt.Sprintf("%d servers", len(targets))
+}
+
+// protectedTerminal sets the terminal title, and the background when one is configured, while connected to a
+// server in a protected environment. The returned function restores the previous state.
+func protectedTerminal(t serverTarget) func() {
+	if !t.EnvDef.Protected || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return func() {}
+	}
+	// Save the current title on the terminal's title stack before replacing it
+	fmt.Print("\x1b[22;0t")
+	fmt.Printf("\x1b]0;ssm: %s [%s]\x07", t.Server.Alias, strings.ToUpper(t.Environment))
+	if t.EnvDef.Background != "" {
+		fmt.Printf("\x1b]11;%s\x07", t.EnvDef.Background)
+	}
+	return func() {
+		if t.EnvDef.Background != "" {
+			fmt.Print("\x1b]111\x07")
+		}
+		fmt.Print("\x1b[23;0t")
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+)
+
+func TestGuardProtectedRequiresTypedConfirmation(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	defer func(r *bufio.Reader, yes bool) { stdinReader, assumeYes = r, yes }(stdinReader, assumeYes)
+	assumeYes = true
+
+	prod := store.EnvironmentDef{Name: "prod", Protected: true}
+	pg1 := serverTarget{Group: "payments", Environment: "prod", EnvDef: prod, Server: store.Server{Alias: "pg1", HostName: "db1"}}
+	pg2 := serverTarget{Group: "payments", Environment: "prod", EnvDef: prod, Server: store.Server{Alias: "pg2", HostName: "db2"}}
+	dev := serverTarget{Group: "payments", Environment: "dev", EnvDef: store.EnvironmentDef{Name: "dev"}, Server: store.Server{Alias: "pg3"}}
+
+	tests := []struct {
+		input   string
+		targets []serverTarget
+		want    bool
+	}{
+		{"", []serverTarget{dev}, true},
+		{"y\n", []serverTarget{pg1}, false},
+		{"pg1\n", []serverTarget{pg1, dev}, true},
+		{"pg1\n", []serverTarget{pg1, pg2}, false},
+		{"prod\n", []serverTarget{pg1, pg2}, true},
+	}
+	for _, tt := range tests {
+		stdinReader = bufio.NewReader(strings.NewReader(tt.input))
+		if got := guardProtected("delete", "", tt.targets); got != tt.want {
+			t.Errorf("input %q on %d targets: got %v, want %v", tt.input, len(tt.targets), got, tt.want)
+		}
+	}
+
+	log, err := os.ReadFile(filepath.Join(home, ".ssm", "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(log), "\n"); lines != 6 {
+		t.Errorf("expected 6 audit entries for the protected servers, got %d:\n%s", lines, log)
+	}
+	if !strings.Contains(string(log), `"alias":"pg1"`) || !strings.Contains(string(log), `"outcome":"aborted"`) {
+		t.Errorf("unexpected audit log:\n%s", log)
+	}
+}
@@ -1,82 +1,263 @@
 package cmd
 
 import (
-	"context"
+	"bytes"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
-	"cloud.google.com/go/firestore"
 	"github.com/AshutoshPatole/ssm/internal/security"
-	"github.com/AshutoshPatole/ssm/internal/ssh"
 	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var (
+	pullRevision string
+	pullPrefer   string
+	pullForce    bool
+)
+
 // pullCmd represents the pull command
 var pullCmd = &cobra.Command{
 	Use:   "pull",
 	Short: "Pull your configurations from the cloud",
-	Long:  `Retrieves and applies your stored configurations from the cloud, including SSH keys, shell configurations, and other settings.`,
+	Long: `Retrieves and applies your stored configurations from the cloud, including SSH keys, shell configurations, and other settings.
+
+Files changed only remotely since this machine last synced are replaced, files changed only locally are
+kept. When .ssm.yaml changed on both sides the servers are merged: servers added on either side are kept
+and a field changed differently on both sides is asked about, or decided by --prefer. Other files changed
+on both sides are asked about as a whole.
+
+Before a local file is replaced, its differences are shown (fingerprints for SSH keys) and you are asked
+whether to replace it; --force replaces without asking. Replaced files are copied to <file>.bak and
+snapshotted, see 'ssm backup list'.
+
+--only and --exclude narrow down the files pulled. --rev restores an earlier revision as it was, without merging.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		downloadConfigurations()
+		if pullPrefer != "" && pullPrefer != "local" && pullPrefer != "remote" {
+			logrus.Errorf("Invalid --prefer %q, allowed values are: local, remote", pullPrefer)
+			return
+		}
+		backend, secret, err := openSyncBackend(true)
+		if err != nil {
+			logrus.Errorf("Failed to open sync backend: %v", err)
+			return
+		}
+		payload, err := backend.Get(pullRevision)
+		if errors.Is(err, store.ErrNoSyncData) {
+			logrus.Infof("Nothing has been pushed to %s yet", backend)
+			return
+		} else if err != nil {
+			logrus.Errorf("Error pulling configuration: %v", err)
+			return
+		}
+		key, err := syncKey(secret, payload.Envelope)
+		if err != nil {
+			logrus.Errorf("Failed to derive the encryption key: %v", err)
+			return
+		}
+		remote := decryptFiles(payload, key)
+		if pullRevision != "" {
+			applyFiles(remote)
+			return
+		}
+
+		state, err := store.LoadSyncState(backend.StateKey())
+		if err != nil {
+			logrus.Errorf("Failed to read sync state: %v", err)
+			return
+		}
+		if payload.Revision > 0 && payload.Revision == state.Revision && state.Hashes != nil {
+			logrus.Infof("Already up to date with revision %d of %s", payload.Revision, backend)
+			return
+		}
+		files, err := mergeFiles(state, readSyncFiles(), remote, key)
+		if err != nil {
+			logrus.Errorf("Pull aborted: %v", err)
+			return
+		}
+		if !applyFiles(files) {
+			return
+		}
+		if len(syncOnly) > 0 || len(syncExclude) > 0 {
+			// The files left out still differ, so this machine is not up to date with the revision
+			logrus.Infof("Pulled some of the files of revision %d, pull without --only and --exclude before pushing", payload.Revision)
+			return
+		}
+		// Files this machine does not synchronise keep the hashes recorded for them
+		hashes := make(map[string]string)
+		for name, hash := range state.Hashes {
+			if !slices.ContainsFunc(syncFiles, func(f store.SyncFile) bool { return f.Name == name }) {
+				hashes[name] = hash
+			}
+		}
+		maps.Copy(hashes, fileHashes(remote))
+		saveSyncState(backend, payload.Revision, hashes, remote["ssm_yaml"])
 	},
 }
 
 func init() {
 	syncCmd.AddCommand(pullCmd)
+	pullCmd.Flags().StringVar(&pullRevision, "rev", "", "Restore an earlier revision instead of merging the latest one, see 'ssm sync log'")
+	addFileFlags(pullCmd)
+	pullCmd.Flags().BoolVar(&pullForce, "force", false, "Replace the local files without asking, for unattended use")
+	pullCmd.Flags().StringVar(&pullPrefer, "prefer", "", "Decide conflicts without asking, keeping the local or the remote side: local, remote")
 }
 
-// downloadConfigurations retrieves user configurations from Firestore, decrypts them, and saves them to the local system
-func downloadConfigurations() {
-	if err := store.InitFirebaseOnce(); err != nil {
-		logrus.Errorf("Failed to initialize Firebase: %v", err)
-		return
+// decryptFiles decrypts the files of payload with key, skipping the ones that cannot be decrypted
+func decryptFiles(payload store.Payload, key []byte) map[string][]byte {
+	files := make(map[string][]byte)
+	for _, f := range syncFiles {
+		encrypted := payload.Files[f.Name]
+		if encrypted == "" {
+			continue
+		}
+		decrypted, err := security.DecryptData(encrypted, key)
+		if err != nil {
+			logrus.Errorf("Failed to decrypt %s: %v", f.Path, err)
+			continue
+		}
+		if len(decrypted) > 0 {
+			files[f.Name] = decrypted
+		}
 	}
+	return files
+}
 
-	userPassword, err := ssh.AskPassword()
-	if err != nil {
-		logrus.Errorf("Error reading password: %v", err)
-		return
+// mergeFiles compares the local and remote files with the ones of the last sync and returns the files
+// to write. .ssm.yaml changed on both sides is merged per server, other files are asked about.
+func mergeFiles(state *store.SyncState, local, remote map[string][]byte, key []byte) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for _, f := range syncFiles {
+		r, ok := remote[f.Name]
+		if !ok {
+			continue
+		}
+		l := local[f.Name]
+		switch {
+		case bytes.Equal(l, r):
+		case len(l) == 0 || isBase(state, f.Name, l, key):
+			files[f.Name] = r
+		case isBase(state, f.Name, r, key):
+			logrus.Infof("Keeping %s, it only changed locally", f.Path)
+		case f.Name == "ssm_yaml":
+			merged, err := store.MergeConfigFiles(state.Base, l, r, resolveConflict)
+			if err != nil {
+				return nil, fmt.Errorf("failed to merge %s: %w", f.Path, err)
+			}
+			files[f.Name] = merged
+		default:
+			useRemote, err := askLocalOrRemote(fmt.Sprintf("%s changed both locally and remotely.", f.Path))
+			if err != nil {
+				return nil, err
+			}
+			if useRemote {
+				files[f.Name] = r
+			}
+		}
 	}
+	return files, nil
+}
 
-	uid, err := fetchUID(userPassword)
-	if err != nil {
-		logrus.Errorf("Authentication failed: %v", err)
-		return
-	}
+// isBase reports whether data is the version of the file recorded in the sync state. States are plain
+// SHA-256 hashes, but states written by earlier versions of ssm hold HMACs keyed with the version 1 key
+// of the passphrase, which was also the key of the files they pushed. Those are tried with key, the key
+// of the payload being pulled: it matches while the remote files are still encrypted that way. Once they
+// were pushed again with a newer envelope the legacy hashes no longer match, and files changed on both
+// sides are asked about rather than silently replaced.
+func isBase(state *store.SyncState, name string, data []byte, key []byte) bool {
+	hash := state.Hashes[name]
+	return hash != "" && (hash == fileHash(data) || hash == security.ContentHash(data, key))
+}
 
-	client, err := store.App.Firestore(context.Background())
-	if err != nil {
-		logrus.Errorf("Failed to connect to Firestore: %v", err)
-		return
+// resolveConflict decides a conflict of the .ssm.yaml merge
+func resolveConflict(c store.MergeConflict) (bool, error) {
+	if c.Field == "" {
+		return askLocalOrRemote(fmt.Sprintf("Server %s was %s locally and %s remotely.", c, c.Local, c.Remote))
 	}
-	defer func(client *firestore.Client) {
-		_ = client.Close()
-	}(client)
-
-	logrus.Debugf("Fetching user configurations for UID: %s", uid)
+	return askLocalOrRemote(fmt.Sprintf("Conflict in %s:\n  local:  %s\n  remote: %s", c, c.Local, c.Remote))
+}
 
-	document, err := client.Collection("configurations").Doc(uid).Get(context.Background())
-	if err != nil || !document.Exists() {
-		logrus.Info("No configuration found for the current user")
+// askLocalOrRemote asks whether to keep the local or take the remote side of a conflict, unless
+// --prefer decides it. It returns true for the remote side.
+func askLocalOrRemote(question string) (bool, error) {
+	fmt.Println(question)
+	if pullPrefer != "" {
+		fmt.Printf("Keeping the %s side (--prefer)\n", pullPrefer)
+		return pullPrefer == "remote", nil
+	}
+	for {
+		fmt.Print("Keep (l)ocal or take (r)emote? ")
+		response, err := stdinReader.ReadString('\n')
+		switch strings.TrimSpace(strings.ToLower(response)) {
+		case "l", "local":
+			return false, nil
+		case "r", "remote":
+			return true, nil
+		}
 		if err != nil {
-			logrus.Debugf("Firestore error: %v", err)
+			fmt.Println()
+			return false, fmt.Errorf("no answer for the conflict, rerun with --prefer local or --prefer remote")
 		}
-		return
 	}
+}
 
-	logrus.Debugf("Found configuration for user with UID: %s", uid)
-
+// applyFiles shows how the pulled files differ from the local ones and saves the accepted ones to the
+// home directory. Each replaced file is snapshotted and copied to <file>.bak first. Nothing is asked with
+// --force, and nothing is saved in dry-run mode. It reports whether every accepted file was saved.
+func applyFiles(files map[string][]byte) bool {
 	userHomeDir, err := os.UserHomeDir()
 	if err != nil {
 		logrus.Errorf("Failed to get home directory: %v", err)
-		return
+		return false
 	}
 
-	dataMap := document.Data()
-	key := security.GenerateEncryptionKey(userPassword)
+	var accepted []store.SyncFile
+	changed := 0
+	for _, f := range syncFiles {
+		data, ok := files[f.Name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(userHomeDir, f.Path)
+		current, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Errorf("Failed to read %s: %v", path, err)
+			continue
+		}
+		if bytes.Equal(current, data) {
+			continue
+		}
+		changed++
+		if store.DryRun {
+			printFileDiff(store.DryRunOutput, f, current, data, "local", "pulled")
+			continue
+		}
+		if !pullForce {
+			printFileDiff(os.Stdout, f, current, data, "local", "pulled")
+			ok, err := confirm(fmt.Sprintf("Replace %s?", displayPath(path)))
+			if err != nil {
+				logrus.Errorf("No answer, pull aborted: %v (use --force to pull without asking)", err)
+				return false
+			}
+			if !ok {
+				logrus.Infof("Skipped %s", displayPath(path))
+				continue
+			}
+		}
+		accepted = append(accepted, f)
+	}
+	if changed == 0 {
+		logrus.Infof("Local files are up to date")
+	}
+	if len(accepted) == 0 {
+		return true
+	}
 
 	// Ensure .ssh directory exists
 	sshDir := filepath.Join(userHomeDir, ".ssh")
@@ -84,44 +265,62 @@ func downloadConfigurations() {
 		logrus.Errorf("Failed to create .ssh directory: %v", err)
 	}
 
-	fileConfigs := []struct {
-		mapKey      string
-		relPath     string
-		permissions os.FileMode
-	}{
-		{"ssm_yaml", ".ssm.yaml", 0644},
-		{"public", filepath.Join(".ssh", "id_ed25519.pub"), 0644},
-		{"private", filepath.Join(".ssh", "id_ed25519"), 0600},
-		{"bashrc", ".bashrc", 0644},
-		{"zshrc", ".zshrc", 0644},
-		{"ssh_config", filepath.Join(".ssh", "config"), 0644},
-		{"tmux", ".tmux.conf", 0644},
+	paths := make([]string, len(accepted))
+	for i, f := range accepted {
+		paths[i] = filepath.Join(userHomeDir, f.Path)
+	}
+	backup, err := store.Snapshot("sync pull", paths...)
+	if err != nil {
+		logrus.Errorf("Failed to back up local files, aborting pull: %v", err)
+		return false
+	}
+	if backup != nil {
+		logrus.Infof("Local files backed up as %s, undo with 'ssm restore %s'", backup.ID, backup.ID)
 	}
 
-	for _, fc := range fileConfigs {
-		val, ok := dataMap[fc.mapKey]
-		if !ok || val == nil {
-			continue
-		}
-		encryptedStr, ok := val.(string)
-		if !ok || encryptedStr == "" {
+	saved := true
+	for i, fc := range accepted {
+		fullPath, data := paths[i], files[fc.Name]
+		if err := copyToBak(fullPath); err != nil {
+			logrus.Errorf("Failed to back up %s, not replacing it: %v", fullPath, err)
+			saved = false
 			continue
 		}
-
-		decrypted, err := security.DecryptData(encryptedStr, key)
-		if err != nil {
-			logrus.Errorf("Failed to decrypt %s: %v", fc.relPath, err)
+		if configPath, _ := store.ConfigPath(); fc.Name == "ssm_yaml" && fullPath == configPath {
+			if err := store.Replace(data); err != nil {
+				logrus.Errorf("Failed to save %s: %v", fc.Path, err)
+				saved = false
+			} else {
+				logrus.Infof("Successfully saved file: %s", fullPath)
+			}
 			continue
 		}
-		if len(decrypted) == 0 {
-			continue
+		if err := saveFile(fullPath, data, fc.Mode); err != nil {
+			logrus.Errorf("Failed to save %s: %v", fc.Path, err)
+			saved = false
 		}
+	}
+	return saved
+}
 
-		fullPath := filepath.Join(userHomeDir, fc.relPath)
-		if err := saveFile(fullPath, decrypted, fc.permissions); err != nil {
-			logrus.Errorf("Failed to save %s: %v", fc.relPath, err)
-		}
+// copyToBak copies an existing file to <file>.bak with the same permissions, replacing an earlier copy
+func copyToBak(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
 	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Remove an earlier copy first, so that the new one is created with the permissions of the file
+	bak := path + ".bak"
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(bak, data, info.Mode().Perm())
 }
 
 // saveFile writes data to a file with specified permissions
@@ -137,21 +336,3 @@ func saveFile(filename string, data []byte, permission os.FileMode) error {
 	logrus.Infof("Successfully saved file: %s", filename)
 	return nil
 }
-
-// fetchUID retrieves the user ID using the provided password
-func fetchUID(userPassword string) (string, error) {
-	userMap, err := store.LoginUser(userEmail, userPassword)
-	if err != nil {
-		return "", err
-	}
-	uidVal, ok := userMap["user_id"]
-	if !ok {
-		return "", fmt.Errorf("user_id not found in token claims")
-	}
-	uidStr, ok := uidVal.(string)
-	if !ok || uidStr == "" {
-		return "", fmt.Errorf("invalid user_id in token claims")
-	}
-	return uidStr, nil
-}
-
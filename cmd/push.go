@@ -1,111 +1,169 @@
 package cmd
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 
-	"cloud.google.com/go/firestore"
 	"github.com/AshutoshPatole/ssm/internal/security"
-	"github.com/AshutoshPatole/ssm/internal/ssh"
 	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+var pushForce bool
+
 // pushCmd represents the push command
 var pushCmd = &cobra.Command{
 	Use:   "push",
 	Short: "Push your configuration to the cloud",
-	Long:  `Upload your local configuration files to the cloud storage for easy synchronization across devices.`,
+	Long: `Upload your local configuration files to the cloud storage for easy synchronization across devices.
+
+Only the files selected by --only and --exclude are pushed, the others are kept as they were pushed before.
+
+Every push is numbered. A push is refused when another machine pushed since this machine last synced,
+as it would drop that machine's changes: run 'ssm sync pull' first to merge them, or push with --force
+to overwrite them.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		userPassword, err := ssh.AskPassword()
+		backend, secret, err := openSyncBackend(true)
+		if err != nil {
+			logrus.Errorf("Failed to open sync backend: %v", err)
+			return
+		}
+		state, err := store.LoadSyncState(backend.StateKey())
 		if err != nil {
-			logrus.Errorf("Error reading password: %v", err)
+			logrus.Errorf("Failed to read sync state: %v", err)
+			return
+		}
+		remote, err := backend.Get("")
+		if err != nil && !errors.Is(err, store.ErrNoSyncData) {
+			logrus.Errorf("Error reading the latest revision: %v", err)
 			return
 		}
-		user, err := store.LoginUser(userEmail, userPassword)
+		envelope, key, err := pushKey(secret, remote)
 		if err != nil {
-			fmt.Println(err)
+			logrus.Errorf("Failed to derive the encryption key: %v", err)
 			return
 		}
 
-		uidVal, ok := user["user_id"]
-		if !ok {
-			logrus.Error("Error: user_id claim not found in user credentials")
+		files := readSyncFiles()
+		payload := encryptFiles(files, key)
+		payload.Envelope = envelope
+		// Files this machine does not synchronise are kept as they were pushed
+		kept, err := keepRemoteFiles(&payload, remote, secret, key)
+		if err != nil {
+			logrus.Errorf("Push aborted: %v", err)
 			return
 		}
-		userId, ok := uidVal.(string)
-		if !ok || userId == "" {
-			logrus.Error("Error: invalid user_id format")
+		base := state.Base
+		if slices.ContainsFunc(syncFiles, func(f store.SyncFile) bool { return f.Name == "ssm_yaml" }) {
+			base = files["ssm_yaml"]
+		}
+		if len(remote.Files) > 0 && maps.Equal(payload.Hashes, remote.Hashes) {
+			logrus.Infof("%s is up to date, nothing to push", backend)
+			saveSyncState(backend, remote.Revision, pushedHashes(state, files, kept), base)
+			return
+		}
+		if len(remote.Files) > 0 && (state.Hashes == nil || remote.Revision != state.Revision) && !pushForce {
+			logrus.Errorf("%s has changes this machine has not pulled yet (revision %d, last synced %d): run 'ssm sync pull' to merge them first, or push with --force to overwrite them",
+				backend, remote.Revision, state.Revision)
 			return
 		}
 
-		upload(userId, userPassword)
+		host, _ := os.Hostname()
+		payload.Revision = remote.Revision + 1
+		payload.Host = host
+		payload.Version = buildVersion(version, commit, date, builtBy, treeState).GitVersion
+		rev, err := backend.Put(payload, fmt.Sprintf("ssm sync push from %s", host))
+		if err != nil {
+			logrus.Errorf("Error pushing configuration: %v", err)
+			return
+		}
+		saveSyncState(backend, payload.Revision, pushedHashes(state, files, kept), base)
+		logrus.Infof("Configuration pushed to %s as revision %s", backend, shortRevision(rev.ID))
 	},
 }
 
 func init() {
 	syncCmd.AddCommand(pushCmd)
+	addFileFlags(pushCmd)
+	pushCmd.Flags().BoolVar(&pushForce, "force", false, "Push even if another machine pushed changes this machine has not pulled")
 }
 
-// upload encrypts and uploads the user's configuration files to Firestore
-func upload(documentID string, userPassword string) {
-	if err := store.InitFirebaseOnce(); err != nil {
-		logrus.Errorf("Failed to initialize Firebase: %v", err)
-		return
+// readSyncFiles reads the non-empty synchronised files from the home directory, keyed by name
+func readSyncFiles() map[string][]byte {
+	files := make(map[string][]byte)
+	for _, f := range syncFiles {
+		data, err := readFileAsBytes(f.Path)
+		if err != nil {
+			logrus.Warnf("Skipping %s: %v", f.Path, err)
+			continue
+		}
+		if len(data) > 0 {
+			files[f.Name] = data
+		}
 	}
+	return files
+}
 
-	client, err := store.App.Firestore(context.Background())
-	if err != nil {
-		logrus.Errorf("Error getting Firestore client: %v", err)
-		return
+// encryptFiles encrypts files with key and records the hash of each one
+func encryptFiles(files map[string][]byte, key []byte) store.Payload {
+	payload := store.Payload{Files: make(map[string]string), Hashes: hashFiles(files, key)}
+	for name, data := range files {
+		payload.Files[name] = security.EncryptData(data, key)
 	}
-	defer func(client *firestore.Client) {
-		_ = client.Close()
-	}(client)
-
-	ssmYaml, _ := readFileAsBytes(".ssm.yaml")
-	publicKey, _ := readFileAsBytes(filepath.Join(".ssh", "id_ed25519.pub"))
-	privateKey, _ := readFileAsBytes(filepath.Join(".ssh", "id_ed25519"))
-	zshrc, _ := readFileAsBytes(".zshrc")
-	bashrc, _ := readFileAsBytes(".bashrc")
-	tmux, _ := readFileAsBytes(".tmux.conf")
-	sshConfig, _ := readFileAsBytes(filepath.Join(".ssh", "config"))
-
-	key := security.GenerateEncryptionKey(userPassword)
+	return payload
+}
 
-	payload := map[string]interface{}{}
-	if len(ssmYaml) > 0 {
-		payload["ssm_yaml"] = security.EncryptData(ssmYaml, key)
-	}
-	if len(publicKey) > 0 {
-		payload["public"] = security.EncryptData(publicKey, key)
-	}
-	if len(privateKey) > 0 {
-		payload["private"] = security.EncryptData(privateKey, key)
-	}
-	if len(zshrc) > 0 {
-		payload["zshrc"] = security.EncryptData(zshrc, key)
-	}
-	if len(bashrc) > 0 {
-		payload["bashrc"] = security.EncryptData(bashrc, key)
-	}
-	if len(tmux) > 0 {
-		payload["tmux"] = security.EncryptData(tmux, key)
-	}
-	if len(sshConfig) > 0 {
-		payload["ssh_config"] = security.EncryptData(sshConfig, key)
+// keepRemoteFiles copies the files of remote this machine does not synchronise into payload and returns
+// their names. When payload has a new envelope, these files are re-encrypted with its key.
+func keepRemoteFiles(payload *store.Payload, remote store.Payload, secret string, key []byte) ([]string, error) {
+	var (
+		kept      []string
+		remoteKey []byte
+	)
+	for name, encrypted := range remote.Files {
+		if slices.ContainsFunc(syncFiles, func(f store.SyncFile) bool { return f.Name == name }) {
+			continue
+		}
+		kept = append(kept, name)
+		if payload.Envelope == remote.Envelope {
+			payload.Files[name] = encrypted
+			if hash, ok := remote.Hashes[name]; ok {
+				payload.Hashes[name] = hash
+			}
+			continue
+		}
+		if remoteKey == nil {
+			k, err := syncKey(secret, remote.Envelope)
+			if err != nil {
+				return nil, err
+			}
+			remoteKey = k
+		}
+		data, err := security.DecryptData(encrypted, remoteKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt %s with the new key: %w", name, err)
+		}
+		payload.Files[name] = security.EncryptData(data, key)
+		payload.Hashes[name] = security.ContentHash(data, key)
 	}
+	return kept, nil
+}
 
-	configurations := client.Collection("configurations")
-	_, err = configurations.Doc(documentID).Set(context.Background(), payload)
-	if err != nil {
-		logrus.Errorf("Error adding configuration: %v", err)
-		return
+// pushedHashes returns the sync state hashes after pushing files: their own hashes, and the recorded
+// ones of the kept files this machine does not synchronise
+func pushedHashes(state *store.SyncState, files map[string][]byte, kept []string) map[string]string {
+	hashes := fileHashes(files)
+	for _, name := range kept {
+		if hash, ok := state.Hashes[name]; ok {
+			hashes[name] = hash
+		}
 	}
-	logrus.Infof("Configuration successfully uploaded with reference ID: %s", documentID)
+	return hashes
 }
 
 // readFileAsBytes reads the content of a file and returns it as a byte slice
@@ -1,14 +1,17 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
 	"time"
 
-	"github.com/AshutoshPatole/ssm/internal/security"
 	"github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -48,27 +51,46 @@ This command will prompt for credentials if they are not stored, and then initia
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 
-		user, hostIP, credentialKey, isRDP, err := ListToConnectServers(args[0], rdpFilterEnvironment)
+		target, err := ListToConnectServers(args[0], rdpFilterEnvironment, store.Selector{})
 		if err != nil {
 			logrus.Fatalln(err)
 		}
 
-		if !isRDP {
+		if !target.Server.IsRDP {
 			logrus.Fatalln("Selected server is not configured for RDP")
 		}
+		if !guardProtected("connect", "", []serverTarget{target}) {
+			return
+		}
 
-		logrus.Debugf("Connecting to Windows machine %s using %s user\n", hostIP, user)
+		logrus.Debugf("Connecting to Windows machine %s using %s user\n", target.Server.IP, target.Server.User)
 
-		ConnectToServerRDP(user, hostIP, credentialKey)
+		connectRDP(target)
 	},
 }
 
+// connectRDP opens an RDP session to target with its credential
+func connectRDP(target serverTarget) {
+	ref, ok, err := target.credential()
+	if err != nil {
+		logrus.Errorln(err)
+		return
+	}
+	if !ok {
+		ConnectToServerRDP(target.Server.User, target.Server.IP, nil)
+		return
+	}
+	ConnectToServerRDP(target.Server.User, target.Server.IP, &ref)
+}
+
 func init() {
 	rootCmd.AddCommand(rdpCmd)
 	rdpCmd.Flags().StringVarP(&rdpFilterEnvironment, "filter", "f", "", "filter list by environment")
 }
 
-func ConnectToServerRDP(user, host, credentialKey string) {
+// ConnectToServerRDP opens an RDP session to host, with the password credential names or, when it is nil
+// or cannot be read, a password read from the terminal
+func ConnectToServerRDP(user, host string, credential *store.CredentialRef) {
 	if runtime.GOOS != "linux" {
 		logrus.Warnln("This function is only supported on Linux")
 		return
@@ -87,8 +109,8 @@ func ConnectToServerRDP(user, host, credentialKey string) {
 	}
 
 	var password string
-	if credentialKey != "" {
-		retrievedPassword, err := security.RetreiveCredentials(credentialKey)
+	if credential != nil {
+		retrievedPassword, err := getCredential(*credential)
 		if err != nil {
 			logrus.Warn("Error retrieving stored credential: " + err.Error())
 			password, err = ssh.AskPassword()
@@ -96,7 +118,9 @@ func ConnectToServerRDP(user, host, credentialKey string) {
 				logrus.Errorf("Error reading password: %v", err)
 				return
 			}
-			security.StoreCredentials(credentialKey, password)
+			if err := setCredential(*credential, password); err != nil && !errors.Is(err, store.ErrCredentialReadOnly) {
+				logrus.Warnf("Error storing credential: %v", err)
+			}
 		} else {
 			password = retrievedPassword
 		}
@@ -112,9 +136,11 @@ func ConnectToServerRDP(user, host, credentialKey string) {
 	// Add a delay to ensure environment is set
 	time.Sleep(2 * time.Second)
 
+	// The password is written to stdin rather than passed as /p:, where any user of the machine could read
+	// it from the process list
 	args := []string{
+		"/from-stdin:force",
 		fmt.Sprintf("/u:%s", user),
-		fmt.Sprintf("/p:%s", string(password)),
 		fmt.Sprintf("/v:%s", host),
 		"+clipboard",
 		"/dynamic-resolution",
@@ -135,6 +161,7 @@ func ConnectToServerRDP(user, host, credentialKey string) {
 	}
 
 	cmd := exec.Command("xfreerdp", args...)
+	cmd.Stdin = rdpCredentials(user, password)
 
 	if verbose {
 		cmd.Stdout = os.Stdout
@@ -149,3 +176,13 @@ func ConnectToServerRDP(user, host, credentialKey string) {
 		logrus.Debugln("RDP client finished successfully")
 	}
 }
+
+// rdpCredentials returns what xfreerdp /from-stdin:force reads for the fields not given on its command
+// line, one line each, in the order username, domain and password. The username is always given with
+// /u:, and the domain only as part of it, as in DOMAIN\user, so an empty domain is entered otherwise.
+func rdpCredentials(user, password string) io.Reader {
+	if strings.Contains(user, `\`) {
+		return strings.NewReader(password + "\n")
+	}
+	return strings.NewReader("\n" + password + "\n")
+}
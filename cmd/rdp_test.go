@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"io"
+	"testing"
+)
+
+func TestRDPCredentials(t *testing.T) {
+	for _, tt := range []struct {
+		user, want string
+	}{
+		{user: "admin", want: "\nhunter2\n"},
+		{user: `CORP\admin`, want: "hunter2\n"},
+	} {
+		data, err := io.ReadAll(rdpCredentials(tt.user, "hunter2"))
+		if err != nil || string(data) != tt.want {
+			t.Errorf("%s: expected %q, got %q, %v", tt.user, tt.want, data, err)
+		}
+	}
+}
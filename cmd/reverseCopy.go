@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	ssh2 "github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/AshutoshPatole/ssm/internal/store"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/sirupsen/logrus"
@@ -34,16 +35,20 @@ var reverseCopyCmd = &cobra.Command{
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		logrus.Debug("Initiating reverse-copy command")
-		user, host, _, isRDP, err := ListToConnectServers(args[0], filterByEnvironment)
+		target, err := ListToConnectServers(args[0], filterByEnvironment, store.Selector{})
 		if err != nil {
 			logrus.Error("Failed to retrieve server list: ", err)
 			return
 		}
 
-		if isRDP {
+		if target.Server.IsRDP {
 			fmt.Println("Reverse copy operation is not supported for Windows machines (RDP connections).")
 			return
 		}
+		if !guardProtected("copy", "", []serverTarget{target}) {
+			return
+		}
+		user, host := target.Server.User, target.Server.IP
 
 		logrus.Debug("Establishing SSH connection for ", user, "@", host)
 		client, err := ssh2.NewSSHClient(user, host)
@@ -2,22 +2,27 @@
 package cmd
 
 import (
+	"bufio"
 	"embed"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/AshutoshPatole/ssm/internal/store"
 	goversion "github.com/caarlos0/go-version"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
 	cfgFile     string
 	verbose     bool
 	showVersion bool
+	dryRun      bool
+	assumeYes   bool
 
 	version   = "0.0.0"
 	commit    = ""
@@ -25,6 +30,9 @@ var (
 	date      = ""
 	builtBy   = ""
 	debugFile *os.File
+
+	// inventory gives access to the servers, it is opened once the configuration file is known
+	inventory store.Repository
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -41,6 +49,10 @@ It simplifies the management of SSH profiles with commands to register users, im
 		} else {
 			logrus.SetLevel(logrus.InfoLevel)
 		}
+		store.DryRun = dryRun
+		if dryRun {
+			logrus.Debugln("Dry-run enabled, configuration changes will only be previewed")
+		}
 	},
 	Version: buildVersion(version, commit, date, builtBy, treeState).String(),
 }
@@ -70,6 +82,8 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.ssm.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "toggle debug logs")
 	rootCmd.PersistentFlags().BoolVar(&showVersion, "version", false, "Show version")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Preview configuration changes as a diff without writing them")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "Answer yes to all confirmation prompts")
 
 	// Parse embedded env directly into process environment without writing to disk
 	data, err := envFile.ReadFile(".env.production")
@@ -87,41 +101,19 @@ func init() {
 	}
 }
 
-// initConfig reads in config file and ENV variables if set.
+// initConfig selects the configuration file and opens the server inventory in the storage it selects
 func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-
-		// generate .ssm.yaml if it is not present
-		configName := ".ssm.yaml"
-		configFile := filepath.Join(home, configName)
-
-		if _, err := os.Stat(configFile); os.IsNotExist(err) {
-			file, err := os.Create(configFile)
-			cobra.CheckErr(err)
-			defer func(file *os.File) {
-				_ = file.Close()
-			}(file)
-		}
-
-		// Search config in home directory with name ".ssm" (without extension).
-		viper.AddConfigPath(home)
-		viper.SetConfigType("yaml")
-		viper.SetConfigName(configName)
+	if err := store.Init(cfgFile); err != nil {
+		logrus.Errorf("Error [.ssm.yaml]: %v", err)
+	} else if path, err := store.ConfigPath(); err == nil {
+		logrus.Debugf("Using config file: %s", path)
 	}
-
-	viper.AutomaticEnv() // read in environment variables that match
-
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		logrus.Debugf("Using config file: %s", viper.ConfigFileUsed())
-	} else {
+	var err error
+	if inventory, err = store.Open(); err != nil {
+		// Commands that need servers report the error, while commands such as edit and restore can still
+		// repair the configuration
 		logrus.Errorf("Error [.ssm.yaml]: %v", err)
+		inventory = store.FallbackRepository(err)
 	}
 }
 
@@ -174,3 +166,21 @@ func setupFileLogging() {
 
 	logrus.SetOutput(io.MultiWriter(os.Stdout, debugFile))
 }
+
+// stdinReader is shared by all prompts so that input buffered by one prompt is not lost to the next
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// confirm asks a yes/no question on stdin, answering yes straight away when --yes is set
+func confirm(question string) (bool, error) {
+	if assumeYes {
+		fmt.Printf("%s (y/n): y\n", question)
+		return true, nil
+	}
+	fmt.Printf("%s (y/n): ", question)
+	response, err := stdinReader.ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	response = strings.TrimSpace(strings.ToLower(response))
+	return response == "y" || response == "yes", nil
+}
@@ -3,17 +3,19 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/AshutoshPatole/ssm/internal/ssh"
 	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var (
 	rotateAll      bool
 	rotateGroup    string
+	rotateSelector string
 	privateKeyPath string
 	publicKeyPath  string
 )
@@ -25,16 +27,17 @@ var rotateKeyCmd = &cobra.Command{
 	Long: `The rotate-key command enables you to update the SSH keys used by your servers.
 This crucial security measure helps safeguard your infrastructure by periodically changing the authentication keys.
 By rotating keys regularly, you minimize the risk of unauthorized access even if a key is compromised.
+
+Servers can be chosen with --all, --group or a selector, which can be combined with --group:
+		ssm rotate-key -l role=db,env=prod --private-key new_key --public-key new_key.pub
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Note: RDP Connections will be excluded from the key rotation process")
-		if rotateAll {
-			rotateKeysForAll()
-		} else if rotateGroup != "" {
-			rotateKeysForGroup(rotateGroup)
-		} else {
-			cmd.Printf("Please specify either --all to rotate keys for all servers or --group to rotate keys for a specific group\n")
+		if !rotateAll && rotateGroup == "" && rotateSelector == "" {
+			cmd.Printf("Please specify either --all to rotate keys for all servers, --group to rotate keys for a specific group or --selector to rotate keys for matching servers\n")
+			return
 		}
+		rotateKeys(rotateGroup, mustParseSelector(rotateSelector))
 	},
 }
 
@@ -42,71 +45,59 @@ func init() {
 	rootCmd.AddCommand(rotateKeyCmd)
 	rotateKeyCmd.Flags().BoolVar(&rotateAll, "all", false, "Rotate SSH keys for all configured servers")
 	rotateKeyCmd.Flags().StringVar(&rotateGroup, "group", "", "Rotate SSH keys for servers in a specific group")
+	rotateKeyCmd.Flags().StringVarP(&rotateSelector, "selector", "l", "", "Rotate SSH keys for servers matching this selector (e.g. role=db,region!=eu)")
 	rotateKeyCmd.Flags().StringVar(&privateKeyPath, "private-key", "", "File path to the new Ed25519 private key")
 	rotateKeyCmd.Flags().StringVar(&publicKeyPath, "public-key", "", "File path to the new Ed25519 public key")
 	rotateKeyCmd.MarkFlagRequired("private-key")
 	rotateKeyCmd.MarkFlagRequired("public-key")
 }
 
-func rotateKeysForAll() {
-	var config store.Config
-	if err := viper.Unmarshal(&config); err != nil {
-		logrus.Fatalf("Failed to unmarshal configuration: %v", err)
-	}
-
-	for _, group := range config.Groups {
-		for _, env := range group.Environment {
-			for _, server := range env.Servers {
-				if !server.IsRDP {
-					logrus.Infof("Initiating key rotation for %s (%s) in group %s, environment %s", server.Alias, server.HostName, group.Name, env.Name)
-					if err := rotateKeyForServer(server, group.Name, env.Name); err != nil {
-						logrus.Errorf("Key rotation failed for %s: %v", server.HostName, err)
-					}
-				}
-			}
-		}
+// rotateKeys rotates the key of every SSH server, optionally restricted to a group and a selector
+func rotateKeys(group string, selector store.Selector) {
+	config, err := inventory.Load()
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	if err := viper.WriteConfig(); err != nil {
-		logrus.Fatalf("Failed to save updated configuration: %v", err)
+	if group != "" && !slices.ContainsFunc(config.Groups, func(g store.Group) bool { return g.Name == group }) {
+		logrus.Errorf("Specified group %s not found in configuration", group)
+		return
 	}
-}
 
-func rotateKeysForGroup(group string) {
-	var config store.Config
-	if err := viper.Unmarshal(&config); err != nil {
-		logrus.Fatalf("Failed to unmarshal configuration: %v", err)
+	targets := collectServers(config, group, "", selector)
+	if len(targets) == 0 {
+		logrus.Errorf("No servers found (group: '%s', selector: '%s')", group, selector)
+		return
 	}
-
-	groupFound := false
-	for _, g := range config.Groups {
-		if g.Name == group {
-			groupFound = true
-			for _, env := range g.Environment {
-				for _, server := range env.Servers {
-					if !server.IsRDP {
-						logrus.Infof("Initiating key rotation for %s (%s) in group %s, environment %s", server.Alias, server.HostName, g.Name, env.Name)
-						if err := rotateKeyForServer(server, g.Name, env.Name); err != nil {
-							logrus.Errorf("Key rotation failed for %s: %v", server.HostName, err)
-						}
-					}
-				}
+	if !store.DryRun {
+		var sshTargets []serverTarget
+		for _, target := range targets {
+			if !target.Server.IsRDP {
+				sshTargets = append(sshTargets, target)
 			}
-			break
+		}
+		if !guardProtected("rotate-key", "", sshTargets) {
+			return
 		}
 	}
-
-	if !groupFound {
-		logrus.Errorf("Specified group %s not found in configuration", group)
-		return
-	}
-
-	if err := viper.WriteConfig(); err != nil {
-		logrus.Fatalf("Failed to save updated configuration: %v", err)
+	for _, target := range targets {
+		server := target.Server
+		if server.IsRDP {
+			continue
+		}
+		logrus.Infof("Initiating key rotation for %s (%s) in group %s, environment %s", server.Alias, server.HostName, target.Group, target.Environment)
+		if err := rotateKeyForServer(server, target.Group, target.Environment); err != nil {
+			logrus.Errorf("Key rotation failed for %s: %v", server.HostName, err)
+		}
 	}
 }
 
 func rotateKeyForServer(server store.Server, groupName, envName string) error {
+	if store.DryRun {
+		logrus.Infof("Dry-run: skipping key rotation on %s", server.HostName)
+		return recordKeyRotation(server, groupName, envName)
+	}
+
 	client, err := ssh.NewSSHClient(server.User, server.HostName)
 	if err != nil {
 		return fmt.Errorf("failed to establish SSH connection: %w", err)
@@ -118,9 +109,15 @@ func rotateKeyForServer(server store.Server, groupName, envName string) error {
 		return fmt.Errorf("key rotation process failed: %w", err)
 	}
 
-	if err := store.UpdateKeyRotationTime(groupName, envName, server.HostName); err != nil {
+	if err := recordKeyRotation(server, groupName, envName); err != nil {
 		return fmt.Errorf("failed to record key rotation timestamp: %w", err)
 	}
 
 	return nil
 }
+
+// recordKeyRotation stores the time the key of server was rotated
+func recordKeyRotation(server store.Server, groupName, envName string) error {
+	server.KeyRotatedAt = time.Now()
+	return inventory.Upsert(store.ServerLocation{Group: groupName, Environment: envName}, server)
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	migrateTo   string
+	migratePath string
+)
+
+// storeCmd represents the store command
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Show and change where your servers are stored",
+	Long: `By default servers are kept in the groups section of .ssm.yaml. They can also be kept in
+a directory with one YAML file per group, in an embedded bbolt database, or read from a shared
+team file merged with your own .ssm.yaml. The storage is selected with the 'storage:' setting in
+.ssm.yaml, or for a single command with --config pointing at a directory or a .db file.
+
+Read-only inventory layers, such as a team file kept in git, are merged below your own servers:
+/etc/ssm/*.yaml first, then the files listed under 'layers:' in order. Later layers override
+servers with the same alias in earlier ones and your own servers override them all. Changes are
+only ever written to your own storage.
+
+Example .ssm.yaml:
+		storage:
+		  type: dir
+		  path: ~/ssm-inventory
+		layers:
+		  - ~/src/team-inventory/ssm.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		servers := 0
+		sourceCount := make(map[string]int)
+		for _, g := range config.Groups {
+			for _, env := range g.Environment {
+				servers += len(env.Servers)
+				for _, s := range env.Servers {
+					sourceCount[s.Source]++
+				}
+			}
+		}
+		fmt.Printf("Storage: %s\n", config.Storage())
+		fmt.Printf("Groups:  %d\n", len(config.Groups))
+		fmt.Printf("Servers: %d\n", servers)
+
+		layers, err := config.Layers()
+		if err != nil {
+			logrus.Fatalf("Failed to resolve inventory layers: %v", err)
+		}
+		if len(layers) > 0 {
+			fmt.Println("Layers, lowest precedence first:")
+			for _, layer := range layers {
+				fmt.Printf("  %s (%d servers)\n", displayPath(layer), sourceCount[layer])
+			}
+			fmt.Printf("  personal (%d servers)\n", sourceCount[""])
+		}
+	},
+}
+
+// storeMigrateCmd represents the store migrate command
+var storeMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Move your servers to another storage",
+	Long: `The migrate command copies every server from the storage in use to another, empty one and selects
+it in .ssm.yaml. The previous .ssm.yaml is snapshotted first, see 'ssm backup list'.
+
+Examples:
+		ssm store migrate --to dir --path ~/ssm-inventory
+		ssm store migrate --to bolt --path ~/.ssm/inventory.db
+		ssm store migrate --to yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		to := store.StorageConfig{Type: migrateTo, Path: migratePath}
+		if err := store.MigrateStorage(to); err != nil {
+			logrus.Fatalf("Failed to migrate servers: %v", err)
+		}
+		if !store.DryRun {
+			fmt.Printf("Servers migrated to %s storage.\n", to)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(storeCmd)
+	storeCmd.AddCommand(storeMigrateCmd)
+	storeMigrateCmd.Flags().StringVar(&migrateTo, "to", "", "Storage to migrate to, one of: "+strings.Join([]string{store.StorageYAML, store.StorageDir, store.StorageBolt}, ", "))
+	storeMigrateCmd.Flags().StringVar(&migratePath, "path", "", "Directory for the dir storage, database file for the bolt storage")
+	_ = storeMigrateCmd.MarkFlagRequired("to")
+}
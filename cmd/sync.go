@@ -1,13 +1,27 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+	"github.com/AshutoshPatole/ssm/internal/ssh"
 	"github.com/AshutoshPatole/ssm/internal/store"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var (
-	userEmail string
+	userEmail       string
+	syncBackendName string
+	syncOnly        []string
+	syncExclude     []string
+	// syncFiles are the files pushed and pulled by this command, see selectSyncFiles
+	syncFiles []store.SyncFile
 )
 
 // syncCmd represents the sync command
@@ -16,11 +30,48 @@ var syncCmd = &cobra.Command{
 	Short: "Synchronize your SSH keys and SSM configuration file",
 	Long: `The sync command allows you to upload or download your SSH public and private keys,
 as well as the SSM configuration file and other dot files. This ensures that your SSH setup is consistent
-across different machines and provides a backup of your essential SSH-related files.`,
+across different machines and provides a backup of your essential SSH-related files.
+
+Files are encrypted before they leave the machine. By default they are kept in the SSM cloud,
+which needs --email. They can be kept elsewhere with the 'sync:' setting in .ssm.yaml, or for a
+single command with --backend:
+
+		git   a commit per push in a private git repository
+		dir   a file per push in a directory, e.g. a NAS, Dropbox folder or USB stick
+		s3    an object per push in an S3-compatible bucket, with the credentials read from
+		      AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+
+Example .ssm.yaml:
+		sync:
+		  backend: git
+		  git:
+		    remote: git@github.com:me/ssm-sync.git
+		  dir:
+		    path: /mnt/nas/ssm
+		  s3:
+		    endpoint: https://s3.eu-west-1.amazonaws.com
+		    bucket: my-ssm-sync
+		    region: eu-west-1
+
+The SSM cloud encrypts with the account password unless sync.passphrase is set. Files pushed before it
+was set stay encrypted with the account password: run 'ssm sync rekey' once, entering the account
+password as the current passphrase, to move them to the passphrase.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		if rootCmd.PersistentPreRun != nil {
 			rootCmd.PersistentPreRun(cmd, args)
 		}
+		settings := syncSettings()
+		files, err := selectSyncFiles(settings)
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		syncFiles = files
+		if settings.Backend != store.SyncFirestore {
+			return
+		}
+		if userEmail == "" {
+			logrus.Fatalln("--email is required for the firestore sync backend")
+		}
 		if err := store.InitFirebaseOnce(); err != nil {
 			logrus.Fatalln("Failed to initialize Firebase:", err)
 		}
@@ -30,5 +81,224 @@ across different machines and provides a backup of your essential SSH-related fi
 func init() {
 	rootCmd.AddCommand(syncCmd)
 	syncCmd.PersistentFlags().StringVarP(&userEmail, "email", "e", "", "User's email address for authentication")
-	_ = syncCmd.MarkPersistentFlagRequired("email")
+	syncCmd.PersistentFlags().StringVar(&syncBackendName, "backend", "", "Sync backend to use instead of the configured one: "+strings.Join(store.SyncBackends, ", "))
+}
+
+// syncSettings returns the sync configuration of .ssm.yaml with --backend applied
+func syncSettings() store.SyncConfig {
+	config, err := inventory.Load()
+	if err != nil {
+		logrus.Fatalf("Failed to load configuration: %v", err)
+	}
+	settings := config.SyncSettings()
+	if syncBackendName != "" {
+		settings.Backend = syncBackendName
+	}
+	return settings
+}
+
+// selectSyncFiles returns the synchronised files of settings narrowed down by --only and --exclude
+func selectSyncFiles(settings store.SyncConfig) ([]store.SyncFile, error) {
+	files, err := settings.SyncFiles()
+	if err != nil {
+		return nil, fmt.Errorf("invalid sync.files in .ssm.yaml: %w", err)
+	}
+	for _, entry := range slices.Concat(syncOnly, syncExclude) {
+		if !slices.ContainsFunc(files, func(f store.SyncFile) bool { return store.MatchSyncFile(f, entry) }) {
+			return nil, fmt.Errorf("%q is not a synchronised file, add it under sync.files in .ssm.yaml", entry)
+		}
+	}
+	return slices.DeleteFunc(files, func(f store.SyncFile) bool {
+		matches := func(entry string) bool { return store.MatchSyncFile(f, entry) }
+		return (len(syncOnly) > 0 && !slices.ContainsFunc(syncOnly, matches)) || slices.ContainsFunc(syncExclude, matches)
+	}), nil
+}
+
+// addFileFlags registers --only and --exclude on a command transferring files
+func addFileFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&syncOnly, "only", nil, "Only transfer these files, by name or path (e.g. private, ~/.bashrc)")
+	cmd.Flags().StringSliceVar(&syncExclude, "exclude", nil, "Leave these files alone, by name or path (e.g. private, ~/.bashrc)")
+}
+
+// openSyncBackend returns the selected sync backend, together with the secret the key encrypting the
+// files is derived from when needSecret is set. The firestore backend signs in with --email and uses the
+// account password as secret unless sync.passphrase is set, the other backends ask for a passphrase.
+func openSyncBackend(needSecret bool) (store.SyncBackend, string, error) {
+	settings := syncSettings()
+	if settings.Backend != store.SyncFirestore {
+		backend, err := store.OpenSync(settings, "")
+		if err != nil || !needSecret {
+			return backend, "", err
+		}
+		passphrase, err := askSyncPassphrase()
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading passphrase: %w", err)
+		}
+		return backend, passphrase, nil
+	}
+
+	password, err := ssh.AskPassword()
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading password: %w", err)
+	}
+	uid, err := fetchUID(userEmail, password)
+	if err != nil {
+		return nil, "", fmt.Errorf("authentication failed: %w", err)
+	}
+	backend, err := store.OpenSync(settings, uid)
+	if err != nil || !needSecret || !settings.Passphrase {
+		return backend, password, err
+	}
+	passphrase, err := askSyncPassphrase()
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading passphrase: %w", err)
+	}
+	if err := checkPassphraseSwitch(backend, password, passphrase); err != nil {
+		return nil, "", err
+	}
+	return backend, passphrase, nil
+}
+
+// checkPassphraseSwitch fails when sync.passphrase was turned on after files were pushed to the SSM
+// cloud: they are still encrypted with the account password until 'ssm sync rekey' moves them to the
+// passphrase, so the passphrase is reported as wrong otherwise.
+func checkPassphraseSwitch(backend store.SyncBackend, password, passphrase string) error {
+	latest, err := backend.Get("")
+	if err != nil {
+		// Nothing pushed yet, or the command reports the error itself
+		return nil
+	}
+	if !errors.Is(checkSecret(passphrase, latest), security.ErrWrongSecret) || checkSecret(password, latest) != nil {
+		return nil
+	}
+	return fmt.Errorf("your synchronised files are still encrypted with your account password since sync.passphrase was turned on: " +
+		"run 'ssm sync rekey' and enter the account password as the current passphrase to encrypt them with the passphrase")
+}
+
+// askSyncPassphrase reads the passphrase encrypting the synchronised files, for the backends without an
+// account or when sync.passphrase is set
+func askSyncPassphrase() (string, error) {
+	fmt.Println("Enter the passphrase encrypting your synchronised files.")
+	passphrase, err := ssh.AskPassword()
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the passphrase cannot be empty")
+	}
+	return passphrase, nil
+}
+
+// syncKey returns the key of a payload: the one its envelope opens with secret, or the version 1 key
+// derived from secret for payloads pushed by earlier versions of ssm
+func syncKey(secret string, envelope *security.Envelope) ([]byte, error) {
+	if envelope == nil {
+		return security.GenerateEncryptionKey(secret), nil
+	}
+	return envelope.Open(secret)
+}
+
+// pushKey returns the envelope and key of a push on top of latest: the ones of latest, or a new envelope
+// wrapping a random data key when there is no latest push or it is encrypted without a data key. The
+// secret is checked against latest first, so that a mistyped secret does not replace the key.
+func pushKey(secret string, latest store.Payload) (*security.Envelope, []byte, error) {
+	if latest.Envelope != nil && latest.Envelope.Version >= security.EnvelopeV3 {
+		key, err := syncKey(secret, latest.Envelope)
+		return latest.Envelope, key, err
+	}
+	if err := checkSecret(secret, latest); err != nil {
+		return nil, nil, err
+	}
+	return newSyncKey(secret)
+}
+
+// checkSecret returns security.ErrWrongSecret when latest was not encrypted with the key of secret
+func checkSecret(secret string, latest store.Payload) error {
+	key, err := syncKey(secret, latest.Envelope)
+	if err != nil {
+		return err
+	}
+	// Version 1 has no key check, try to decrypt one of the files instead
+	for _, encrypted := range latest.Files {
+		if _, err := security.DecryptData(encrypted, key); err != nil {
+			return security.ErrWrongSecret
+		}
+		break
+	}
+	return nil
+}
+
+// newSyncKey returns a new envelope wrapping a random data key for secret, and that data key
+func newSyncKey(secret string) (*security.Envelope, []byte, error) {
+	envelope, err := security.NewEnvelope()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := security.NewDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := envelope.Wrap(key, secret); err != nil {
+		return nil, nil, err
+	}
+	return &envelope, key, nil
+}
+
+// hashFiles returns the keyed content hash of each file, as stored in the payload
+func hashFiles(files map[string][]byte, key []byte) map[string]string {
+	hashes := make(map[string]string, len(files))
+	for name, data := range files {
+		hashes[name] = security.ContentHash(data, key)
+	}
+	return hashes
+}
+
+// fileHashes returns the SHA-256 of each file, as recorded in the sync state. Unlike the hashes of the
+// payload they do not change with the key.
+func fileHashes(files map[string][]byte) map[string]string {
+	hashes := make(map[string]string, len(files))
+	for name, data := range files {
+		hashes[name] = fileHash(data)
+	}
+	return hashes
+}
+
+// fileHash returns the SHA-256 of data in hex
+func fileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// saveSyncState records that the local files are in sync with the given revision of backend, keeping
+// base, the .ssm.yaml of that revision, for the next merge
+func saveSyncState(backend store.SyncBackend, revision int, hashes map[string]string, base []byte) {
+	state := store.SyncState{Revision: revision, Hashes: hashes, Base: base}
+	if err := store.SaveSyncState(backend.StateKey(), state); err != nil {
+		logrus.Warnf("Failed to save sync state: %v", err)
+	}
+}
+
+// shortRevision abbreviates git commit hashes for messages, other revision IDs are short already
+func shortRevision(rev string) string {
+	if len(rev) == 40 && strings.Trim(rev, "0123456789abcdef") == "" {
+		return rev[:12]
+	}
+	return rev
+}
+
+// fetchUID signs in with email and password and returns the user ID
+func fetchUID(email, userPassword string) (string, error) {
+	userMap, err := store.LoginUser(email, userPassword)
+	if err != nil {
+		return "", err
+	}
+	uidVal, ok := userMap["user_id"]
+	if !ok {
+		return "", fmt.Errorf("user_id not found in token claims")
+	}
+	uidStr, ok := uidVal.(string)
+	if !ok || uidStr == "" {
+		return "", fmt.Errorf("invalid user_id in token claims")
+	}
+	return uidStr, nil
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/AshutoshPatole/ssm/internal/diff"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// syncDiffCmd represents the sync diff command
+var syncDiffCmd = &cobra.Command{
+	Use:   "diff <rev> [<other-rev>]",
+	Short: "Show how a pushed revision differs from your local files",
+	Long: `Compares the files of a revision listed by 'ssm sync log' with the local files, or with the files of
+another revision, so that a bad push can be found before restoring an earlier one with
+'ssm sync pull --rev <rev>'. Private keys are only reported as changed, never printed.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		backend, secret, err := openSyncBackend(true)
+		if err != nil {
+			logrus.Errorf("Failed to open sync backend: %v", err)
+			return
+		}
+		payload, err := backend.Get(args[0])
+		if err != nil {
+			logrus.Errorf("Error reading revision %s: %v", args[0], err)
+			return
+		}
+		key, err := syncKey(secret, payload.Envelope)
+		if err != nil {
+			logrus.Errorf("Failed to derive the encryption key: %v", err)
+			return
+		}
+		to, toLabel := decryptFiles(payload, key), "revision "+shortRevision(args[0])
+
+		from, fromLabel := readSyncFiles(), "local"
+		if len(args) == 2 {
+			other, err := backend.Get(args[1])
+			if err != nil {
+				logrus.Errorf("Error reading revision %s: %v", args[1], err)
+				return
+			}
+			if key, err = syncKey(secret, other.Envelope); err != nil {
+				logrus.Errorf("Failed to derive the encryption key: %v", err)
+				return
+			}
+			from, fromLabel = to, toLabel
+			to, toLabel = decryptFiles(other, key), "revision "+shortRevision(args[1])
+		}
+		printSyncDiff(from, to, fromLabel, toLabel)
+	},
+}
+
+func init() {
+	syncCmd.AddCommand(syncDiffCmd)
+}
+
+// printSyncDiff prints a diff of each synchronised file between two versions
+func printSyncDiff(from, to map[string][]byte, fromLabel, toLabel string) {
+	for _, f := range syncFiles {
+		before, after := from[f.Name], to[f.Name]
+		if len(before) == 0 && len(after) == 0 {
+			continue
+		}
+		printFileDiff(os.Stdout, f, before, after, fromLabel, toLabel)
+	}
+}
+
+// printFileDiff prints how a synchronised file differs between two versions: the fingerprints of SSH
+// keys, nothing but the fact for other sensitive files, and a unified diff for the rest
+func printFileDiff(w io.Writer, f store.SyncFile, before, after []byte, fromLabel, toLabel string) {
+	if bytes.Equal(before, after) {
+		_, _ = fmt.Fprintf(w, "No changes to %s\n", f.Path)
+		return
+	}
+	beforeKey, afterKey := keyFingerprint(before), keyFingerprint(after)
+	switch {
+	case beforeKey != "" || afterKey != "":
+		_, _ = fmt.Fprintf(w, "%s differs:\n  %-12s %s\n  %-12s %s\n", f.Path, fromLabel+":", cmp.Or(beforeKey, "(no key)"), toLabel+":", cmp.Or(afterKey, "(no key)"))
+	case f.Sensitive():
+		_, _ = fmt.Fprintf(w, "%s differs (contents hidden)\n", f.Path)
+	default:
+		_, _ = fmt.Fprint(w, diff.Unified(f.Path+" ("+fromLabel+")", f.Path+" ("+toLabel+")", before, after))
+	}
+}
+
+// keyFingerprint returns the SHA256 fingerprint of an SSH public or private key, or an empty string when
+// data is not a key. The fingerprint of a passphrase protected private key is read from its public part.
+func keyFingerprint(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if pub, _, _, _, err := gossh.ParseAuthorizedKey(data); err == nil {
+		return gossh.FingerprintSHA256(pub)
+	}
+	signer, err := gossh.ParsePrivateKey(data)
+	if err == nil {
+		return gossh.FingerprintSHA256(signer.PublicKey())
+	}
+	var missing *gossh.PassphraseMissingError
+	if errors.As(err, &missing) && missing.PublicKey != nil {
+		return gossh.FingerprintSHA256(missing.PublicKey)
+	}
+	return ""
+}
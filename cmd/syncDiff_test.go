@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestPrintFileDiffHidesKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := gossh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey := pem.EncodeToMemory(block)
+	sshPub, err := gossh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := gossh.FingerprintSHA256(sshPub)
+
+	private := store.SyncFile{Name: "private", Path: ".ssh/id_ed25519", Mode: 0600}
+	var out bytes.Buffer
+	printFileDiff(&out, private, []byte("old"), privateKey, "local", "pulled")
+	if !strings.Contains(out.String(), fingerprint) || strings.Contains(out.String(), "PRIVATE KEY") {
+		t.Errorf("expected the fingerprint of the private key and not its contents, got %q", out.String())
+	}
+
+	out.Reset()
+	public := store.SyncFile{Name: "public", Path: ".ssh/id_ed25519.pub", Mode: 0644}
+	printFileDiff(&out, public, nil, gossh.MarshalAuthorizedKey(sshPub), "local", "pulled")
+	if !strings.Contains(out.String(), fingerprint) || !strings.Contains(out.String(), "(no key)") {
+		t.Errorf("expected the fingerprint of the public key, got %q", out.String())
+	}
+
+	out.Reset()
+	netrc := store.SyncFile{Name: ".netrc", Path: ".netrc", Mode: 0600}
+	printFileDiff(&out, netrc, []byte("password one"), []byte("password two"), "local", "pulled")
+	if strings.Contains(out.String(), "password") || !strings.Contains(out.String(), "contents hidden") {
+		t.Errorf("expected the contents of a private file to be hidden, got %q", out.String())
+	}
+
+	out.Reset()
+	bashrc := store.SyncFile{Name: "bashrc", Path: ".bashrc", Mode: 0644}
+	printFileDiff(&out, bashrc, []byte("alias a=b\n"), []byte("alias a=c\n"), "local", "pulled")
+	if !strings.Contains(out.String(), "+alias a=c") {
+		t.Errorf("expected a diff of a text file, got %q", out.String())
+	}
+}
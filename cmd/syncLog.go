@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// syncLogCmd represents the sync log command
+var syncLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "List the pushed revisions of your configuration",
+	Long: `Lists every push kept by the sync backend, newest first, with the machine and ssm version that pushed it
+and the files it changed. Any revision can be inspected with 'ssm sync diff <rev>' and restored with
+'ssm sync pull --rev <rev>'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		backend, _, err := openSyncBackend(false)
+		if err != nil {
+			logrus.Errorf("Failed to open sync backend: %v", err)
+			return
+		}
+		revisions, err := backend.List()
+		if err != nil {
+			logrus.Errorf("Failed to list revisions: %v", err)
+			return
+		}
+		if len(revisions) == 0 {
+			fmt.Printf("Nothing has been pushed to %s yet\n", backend)
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "REVISION\t#\tPUSHED\tHOST\tVERSION\tCHANGED")
+		for i, r := range revisions {
+			var previous map[string]string
+			if i+1 < len(revisions) {
+				previous = revisions[i+1].Hashes
+			}
+			number := "-"
+			if r.Number > 0 {
+				number = fmt.Sprint(r.Number)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", shortRevision(r.ID), number, r.Time.Local().Format("2006-01-02 15:04:05"),
+				cmp.Or(r.Host, "-"), cmp.Or(r.Version, "-"), changedFiles(previous, r.Hashes))
+		}
+		_ = w.Flush()
+	},
+}
+
+func init() {
+	syncCmd.AddCommand(syncLogCmd)
+}
+
+// changedFiles lists the files whose hash differs between two revisions, by path when they are synchronised
+// by this machine and by name otherwise
+func changedFiles(previous, hashes map[string]string) string {
+	if hashes == nil {
+		return "-"
+	}
+	var changed, others []string
+	for _, f := range syncFiles {
+		if previous[f.Name] != hashes[f.Name] {
+			changed = append(changed, f.Path)
+		}
+	}
+	names := maps.Clone(hashes)
+	maps.Copy(names, previous)
+	for name := range names {
+		if previous[name] != hashes[name] && !slices.ContainsFunc(syncFiles, func(f store.SyncFile) bool { return f.Name == name }) {
+			others = append(others, name)
+		}
+	}
+	slices.Sort(others)
+	changed = append(changed, others...)
+	if len(changed) == 0 {
+		return "none"
+	}
+	return strings.Join(changed, ", ")
+}
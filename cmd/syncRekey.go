@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+	"github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// syncRekeyCmd represents the sync rekey command
+var syncRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Change the passphrase encrypting your synchronised files",
+	Long: `Wraps the key encrypting the latest push under a new passphrase and pushes it as a new revision. The
+files themselves are not encrypted again, unless they were pushed by an earlier version of ssm that
+encrypted them with the passphrase directly.
+
+Other machines need the new passphrase from the next push or pull on. Earlier revisions keep the
+passphrase they were pushed with, 'ssm sync pull --rev' asks for that one.
+
+The SSM cloud encrypts with the account password, which is changed with 'ssm auth change-password'.
+To encrypt with a passphrase of its own instead, set sync.passphrase in .ssm.yaml and run this command,
+entering the account password as the current passphrase.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := syncSettings()
+		if settings.Backend == store.SyncFirestore && !settings.Passphrase {
+			logrus.Errorf("The SSM cloud encrypts with your account password: change it with 'ssm auth change-password', or set sync.passphrase in .ssm.yaml to encrypt with a passphrase of its own")
+			return
+		}
+		backend, secret, err := openSyncBackend(true)
+		if err != nil {
+			logrus.Errorf("Failed to open sync backend: %v", err)
+			return
+		}
+		remote, err := backend.Get("")
+		if errors.Is(err, store.ErrNoSyncData) {
+			logrus.Infof("Nothing has been pushed to %s yet, the passphrase is chosen on the first push", backend)
+			return
+		} else if err != nil {
+			logrus.Errorf("Error reading the latest revision: %v", err)
+			return
+		}
+		if err := checkSecret(secret, remote); err != nil {
+			logrus.Errorf("Failed to open the latest revision: %v", err)
+			return
+		}
+
+		newSecret, err := askNewSecret("passphrase")
+		if err != nil {
+			logrus.Errorf("Failed to read the new passphrase: %v", err)
+			return
+		}
+		rekeyed, err := rekeyPayload(remote, secret, newSecret)
+		if err != nil {
+			logrus.Errorf("Rekey aborted: %v", err)
+			return
+		}
+		rev, err := pushRekeyed(backend, remote, rekeyed)
+		if err != nil {
+			logrus.Errorf("Error pushing the new key: %v", err)
+			return
+		}
+		logrus.Infof("Pushed revision %s encrypted for the new passphrase, use it on your other machines from now on", shortRevision(rev.ID))
+	},
+}
+
+func init() {
+	syncCmd.AddCommand(syncRekeyCmd)
+}
+
+// askNewSecret asks for a new password or passphrase twice
+func askNewSecret(what string) (string, error) {
+	fmt.Printf("Enter the new %s.\n", what)
+	secret, err := ssh.AskPassword()
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", fmt.Errorf("the %s cannot be empty", what)
+	}
+	fmt.Printf("Enter the new %s again.\n", what)
+	again, err := ssh.AskPassword()
+	if err != nil {
+		return "", err
+	}
+	if again != secret {
+		return "", fmt.Errorf("the %ss do not match", what)
+	}
+	return secret, nil
+}
+
+// rekeyPayload returns payload encrypted for newSecret instead of secret. The data key of a version 3
+// envelope is wrapped again; older payloads, encrypted with the secret directly, are decrypted and
+// encrypted again under a new data key.
+func rekeyPayload(payload store.Payload, secret, newSecret string) (store.Payload, error) {
+	if payload.Envelope != nil && payload.Envelope.Version >= security.EnvelopeV3 {
+		envelope, err := payload.Envelope.Rewrap(secret, newSecret)
+		if err != nil {
+			return store.Payload{}, err
+		}
+		payload.Envelope = &envelope
+		return payload, nil
+	}
+
+	key, err := syncKey(secret, payload.Envelope)
+	if err != nil {
+		return store.Payload{}, err
+	}
+	envelope, newKey, err := newSyncKey(newSecret)
+	if err != nil {
+		return store.Payload{}, err
+	}
+	rekeyed := payload
+	rekeyed.Envelope = envelope
+	rekeyed.Files = make(map[string]string, len(payload.Files))
+	rekeyed.Hashes = make(map[string]string, len(payload.Files))
+	for name, encrypted := range payload.Files {
+		data, err := security.DecryptData(encrypted, key)
+		if err != nil {
+			return store.Payload{}, fmt.Errorf("failed to decrypt %s: %w", name, err)
+		}
+		rekeyed.Files[name] = security.EncryptData(data, newKey)
+		rekeyed.Hashes[name] = security.ContentHash(data, newKey)
+	}
+	return rekeyed, nil
+}
+
+// pushRekeyed pushes rekeyed, the latest revision remote under a new key, as the next revision. A machine
+// in sync with remote stays in sync, as the files did not change.
+func pushRekeyed(backend store.SyncBackend, remote, rekeyed store.Payload) (store.Revision, error) {
+	state, err := store.LoadSyncState(backend.StateKey())
+	if err != nil {
+		return store.Revision{}, fmt.Errorf("failed to read sync state: %w", err)
+	}
+	host, _ := os.Hostname()
+	rekeyed.Revision = remote.Revision + 1
+	rekeyed.Host = host
+	rekeyed.Version = buildVersion(version, commit, date, builtBy, treeState).GitVersion
+	rev, err := backend.Put(rekeyed, fmt.Sprintf("ssm sync rekey from %s", host))
+	if err != nil {
+		return store.Revision{}, err
+	}
+	if state.Hashes != nil && state.Revision == remote.Revision {
+		saveSyncState(backend, rekeyed.Revision, state.Hashes, state.Base)
+	}
+	return rev, nil
+}
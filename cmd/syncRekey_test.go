@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+	"github.com/AshutoshPatole/ssm/internal/store"
+)
+
+func TestRekeyPayload(t *testing.T) {
+	files := map[string][]byte{"ssm_yaml": []byte("groups: []\n"), "bashrc": []byte("alias ll='ls -l'\n")}
+
+	// Pushed by an earlier version, encrypted with the version 1 key of the secret
+	v1 := encryptFiles(files, security.GenerateEncryptionKey("old"))
+	rekeyed, err := rekeyPayload(v1, "old", "new")
+	if err != nil {
+		t.Fatalf("rekeyPayload: %v", err)
+	}
+	if rekeyed.Envelope == nil || rekeyed.Envelope.Version != security.EnvelopeV3 {
+		t.Fatalf("expected a version 3 envelope, got %+v", rekeyed.Envelope)
+	}
+	checkFiles(t, rekeyed, "new", files)
+
+	// Wrapped again, the files stay as they are
+	again, err := rekeyPayload(rekeyed, "new", "newer")
+	if err != nil {
+		t.Fatalf("rekeyPayload: %v", err)
+	}
+	for name, encrypted := range rekeyed.Files {
+		if again.Files[name] != encrypted {
+			t.Errorf("%s was encrypted again", name)
+		}
+	}
+	checkFiles(t, again, "newer", files)
+	if _, err := syncKey("new", again.Envelope); err == nil {
+		t.Errorf("the previous secret still opens the payload")
+	}
+
+	if _, err := rekeyPayload(again, "wrong", "newest"); err == nil {
+		t.Errorf("rekeyPayload accepted a wrong secret")
+	}
+}
+
+// checkFiles verifies that payload decrypts to files with secret
+func checkFiles(t *testing.T, payload store.Payload, secret string, files map[string][]byte) {
+	t.Helper()
+	key, err := syncKey(secret, payload.Envelope)
+	if err != nil {
+		t.Fatalf("syncKey: %v", err)
+	}
+	for name, want := range files {
+		got, err := security.DecryptData(payload.Files[name], key)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s decrypted to %q (err %v), want %q", name, got, err, want)
+		}
+		if payload.Hashes[name] != security.ContentHash(want, key) {
+			t.Errorf("hash of %s does not match its contents", name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sirupsen/logrus"
+)
+
+// serverTarget is a server together with the group and environment it belongs to
+type serverTarget struct {
+	Group       string
+	Environment string
+	EnvDef      store.EnvironmentDef
+	Server      store.Server
+}
+
+// entry returns the target as an inventory entry
+func (t serverTarget) entry() store.Entry {
+	return store.Entry{ServerLocation: store.ServerLocation{Group: t.Group, Environment: t.Environment}, Server: t.Server}
+}
+
+// collectServers flattens the configuration into servers, optionally filtered by group, environment and selector.
+// Within each group, environments are listed in the order they are declared in.
+func collectServers(config *store.Config, group, environment string, selector store.Selector) []serverTarget {
+	var targets []serverTarget
+	for _, e := range config.Entries(store.Filter{Group: group, Environment: environment, Selector: selector}) {
+		def, _ := config.EnvironmentDef(e.Environment)
+		targets = append(targets, serverTarget{Group: e.Group, Environment: e.Environment, EnvDef: def, Server: e.Server})
+	}
+	return targets
+}
+
+// environmentLabel renders an environment name in the colour declared for it
+func environmentLabel(config *store.Config, name string) string {
+	def, ok := config.EnvironmentDef(name)
+	if !ok || def.Color == "" {
+		return name
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color(def.Color)).Render(name)
+}
+
+// mustParseSelector parses the value of a --selector flag, exiting on malformed input
+func mustParseSelector(s string) store.Selector {
+	selector, err := store.ParseSelector(s)
+	if err != nil {
+		logrus.Fatalf("Invalid selector: %v", err)
+	}
+	return selector
+}
@@ -30,11 +30,20 @@ func init() {
 // saveTemplate saves the template YAML to a file
 func saveTemplate() {
 	content := `
+version: 2
+environments:
+  - name: dev
+    color: "42"
+  - name: staging
+    color: "214"
+  - name: prod
+    color: "196"
+    protected: true
 groups:
   - name: atlanta
     user: root
     environment:
-      - name: dev|staging|prod
+      - name: dev
         servers:
           - hostname: chn-mit-test
             alias: test
@@ -42,7 +51,7 @@ groups:
   - name: chennai
     user: root
     environment:
-      - name: prod|dev|staging
+      - name: prod
         servers:
           - hostname: chn-mit-chennai
             alias: bb
@@ -76,10 +76,7 @@ func startUpgrade(latestRelease *GitHubRelease, latestVersion *semver.Version) {
 	fmt.Printf("New version available: %s\n", latestVersion)
 	fmt.Println("https://github.com/AshutoshPatole/ssm/releases")
 
-	fmt.Print("Do you want to download the update? (y/n): ")
-	var answer string
-	fmt.Scanln(&answer)
-	if strings.ToLower(answer) == "y" {
+	if ok, _ := confirm("Do you want to download the update?"); ok {
 		downloadUpdate(latestRelease)
 	}
 }
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	updateServerGroup       string
+	updateServerEnvironment string
+	newServerUser           string
+	newServerAlias          string
+	newServerHostname       string
+	moveToGroup             string
+	moveToEnvironment       string
+	resolveServerIP         bool
+)
+
+// updateServerCmd represents the update-server command
+var updateServerCmd = &cobra.Command{
+	Use:   "update-server <alias>",
+	Short: "Change the details of an existing server",
+	Long: `The update-server command changes the user, alias or hostname of a server, or moves it to another
+group or environment, without deleting and re-adding it.
+
+The server is looked up by alias; use --group and --environment when the alias is used more than once.
+The IP is resolved again when the hostname changes, or on request with --resolve-ip.
+Without any change flags an interactive form is opened.
+
+Examples:
+		ssm update-server web1 --user deploy
+		ssm update-server web1 --hostname web1.new.example.com
+		ssm update-server web1 --to-group frontend --to-environment staging
+		ssm update-server web1`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		alias := args[0]
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		entry, err := inventory.Get(alias, store.ServerLocation{Group: updateServerGroup, Environment: updateServerEnvironment})
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		server, from := entry.Server, entry.ServerLocation
+
+		changed := server
+		to := from
+		resolve := resolveServerIP
+		flags := cmd.Flags()
+		if !flags.Changed("user") && !flags.Changed("alias") && !flags.Changed("hostname") &&
+			!flags.Changed("to-group") && !flags.Changed("to-environment") && !flags.Changed("resolve-ip") {
+			var ok bool
+			changed, to, resolve, ok = runServerForm(config, server, from)
+			if !ok {
+				fmt.Println("Update cancelled.")
+				return
+			}
+		} else {
+			if flags.Changed("user") {
+				changed.User = newServerUser
+			}
+			if flags.Changed("alias") {
+				changed.Alias = newServerAlias
+			}
+			if flags.Changed("hostname") {
+				changed.HostName = newServerHostname
+			}
+			if flags.Changed("to-group") {
+				to.Group = moveToGroup
+			}
+			if flags.Changed("to-environment") {
+				to.Environment = moveToEnvironment
+			}
+		}
+
+		if !store.DryRun && !guardEdit("update-server", config, server, from, to) {
+			return
+		}
+		if resolve {
+			// An empty IP is resolved from the hostname when the server is written
+			changed.IP = ""
+		}
+		moveStoredCredential := followCredential(server, from, &changed, to)
+		if err := inventory.Move(alias, from, to, changed); err != nil {
+			logrus.Fatalf("Failed to update server: %v", err)
+		}
+		moveStoredCredential()
+		if !store.DryRun {
+			fmt.Printf("Server %s updated in %s.\n", changed.Alias, to)
+		}
+	},
+}
+
+// renameCmd represents the rename command
+var renameCmd = &cobra.Command{
+	Use:   "rename <alias> <new-alias>",
+	Short: "Change the alias of a server",
+	Long: `The rename command changes the alias of a server. It is a shortcut for 'ssm update-server <alias> --alias <new-alias>'.
+
+Example:
+		ssm rename web1 frontend-1`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := inventory.Load()
+		if err != nil {
+			logrus.Fatalf("Failed to load configuration: %v", err)
+		}
+		entry, err := inventory.Get(args[0], store.ServerLocation{Group: updateServerGroup, Environment: updateServerEnvironment})
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		server, location := entry.Server, entry.ServerLocation
+		if !store.DryRun && !guardEdit("rename", config, server, location, location) {
+			return
+		}
+		renamed := server
+		renamed.Alias = args[1]
+		moveStoredCredential := followCredential(server, location, &renamed, location)
+		if err := inventory.Move(args[0], location, location, renamed); err != nil {
+			logrus.Fatalf("Failed to rename server: %v", err)
+		}
+		moveStoredCredential()
+		if !store.DryRun {
+			fmt.Printf("Server %s renamed to %s.\n", args[0], args[1])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateServerCmd)
+	rootCmd.AddCommand(renameCmd)
+	for _, c := range []*cobra.Command{updateServerCmd, renameCmd} {
+		c.Flags().StringVarP(&updateServerGroup, "group", "g", "", "Group of the server, when the alias is used more than once")
+		c.Flags().StringVarP(&updateServerEnvironment, "environment", "e", "", "Environment of the server, when the alias is used more than once")
+	}
+	updateServerCmd.Flags().StringVar(&newServerUser, "user", "", "New username")
+	updateServerCmd.Flags().StringVar(&newServerAlias, "alias", "", "New alias")
+	updateServerCmd.Flags().StringVar(&newServerHostname, "hostname", "", "New hostname, the IP is resolved again")
+	updateServerCmd.Flags().StringVar(&moveToGroup, "to-group", "", "Move the server to this group")
+	updateServerCmd.Flags().StringVar(&moveToEnvironment, "to-environment", "", "Move the server to this environment")
+	updateServerCmd.Flags().BoolVar(&resolveServerIP, "resolve-ip", false, "Resolve the IP from the hostname again")
+}
+
+// guardEdit asks for a typed confirmation when a server is changed in, moved out of or moved into a
+// protected environment
+func guardEdit(action string, config *store.Config, server store.Server, from, to store.ServerLocation) bool {
+	fromDef, _ := config.EnvironmentDef(from.Environment)
+	toDef, _ := config.EnvironmentDef(to.Environment)
+	target := serverTarget{Group: from.Group, Environment: from.Environment, EnvDef: fromDef, Server: server}
+	if !fromDef.Protected {
+		target = serverTarget{Group: to.Group, Environment: to.Environment, EnvDef: toDef, Server: server}
+	}
+	detail := ""
+	if from != to {
+		detail = fmt.Sprintf("move %s to %s", from, to)
+	}
+	return guardProtected(action, detail, []serverTarget{target})
+}
+
+// Interactive form
+
+const (
+	formAlias = iota
+	formHostname
+	formUser
+	formGroup
+	formEnvironment
+	formResolveIP
+	formFieldCount
+)
+
+var formLabels = [formFieldCount]string{"Alias", "Hostname", "User", "Group", "Environment", "Resolve IP"}
+
+type serverFormModel struct {
+	config    *store.Config
+	values    [formFieldCount]string
+	resolveIP bool
+	cursor    int
+	status    string
+	submitted bool
+	cancelled bool
+}
+
+// runServerForm shows the form prefilled with server and returns the edited server, its destination,
+// whether the IP should be resolved again, and false when the form was cancelled
+func runServerForm(config *store.Config, server store.Server, from store.ServerLocation) (store.Server, store.ServerLocation, bool, bool) {
+	m := serverFormModel{config: config, status: fmt.Sprintf("Editing %s in %s", server.Alias, from)}
+	m.values[formAlias] = server.Alias
+	m.values[formHostname] = server.HostName
+	m.values[formUser] = server.User
+	m.values[formGroup] = from.Group
+	m.values[formEnvironment] = from.Environment
+
+	final, err := tea.NewProgram(m).Run()
+	if err != nil {
+		logrus.Fatalf("Error running form: %v", err)
+	}
+	m = final.(serverFormModel)
+	if !m.submitted {
+		return server, from, false, false
+	}
+	server.Alias = m.values[formAlias]
+	server.HostName = m.values[formHostname]
+	server.User = m.values[formUser]
+	return server, store.ServerLocation{Group: m.values[formGroup], Environment: m.values[formEnvironment]}, m.resolveIP, true
+}
+
+func (m serverFormModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m serverFormModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	switch key.String() {
+	case "ctrl+c", "esc":
+		m.cancelled = true
+		return m, tea.Quit
+	case "tab", "down":
+		m.cursor = (m.cursor + 1) % formFieldCount
+	case "shift+tab", "up":
+		m.cursor = (m.cursor + formFieldCount - 1) % formFieldCount
+	case "enter", "ctrl+s":
+		if err := m.validate(); err != nil {
+			m.status = err.Error()
+			return m, nil
+		}
+		m.submitted = true
+		return m, tea.Quit
+	case "backspace":
+		if m.cursor != formResolveIP {
+			runes := []rune(m.values[m.cursor])
+			if len(runes) > 0 {
+				m.values[m.cursor] = string(runes[:len(runes)-1])
+			}
+		}
+	case " ":
+		if m.cursor == formResolveIP {
+			m.resolveIP = !m.resolveIP
+		}
+	default:
+		if key.Type == tea.KeyRunes && m.cursor != formResolveIP {
+			m.values[m.cursor] += string(key.Runes)
+		}
+	}
+	return m, nil
+}
+
+// validate checks the form before it is submitted; duplicates are checked when the change is saved
+func (m serverFormModel) validate() error {
+	for _, field := range []int{formAlias, formHostname, formUser, formGroup, formEnvironment} {
+		if strings.TrimSpace(m.values[field]) == "" {
+			return fmt.Errorf("%s cannot be empty", formLabels[field])
+		}
+	}
+	return m.config.CheckEnvironment(m.values[formEnvironment])
+}
+
+func (m serverFormModel) View() string {
+	if m.submitted || m.cancelled {
+		return ""
+	}
+	active := lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	dim := lipgloss.NewStyle().Foreground(lipgloss.Color("240"))
+
+	s := "Update server:\n\n"
+	for i := 0; i < formFieldCount; i++ {
+		value := m.values[i]
+		if i == formResolveIP {
+			value = "[ ]"
+			if m.resolveIP {
+				value = "[x]"
+			}
+		}
+		line := fmt.Sprintf("  %-12s %s", formLabels[i]+":", value)
+		if i == m.cursor {
+			line = active.Render(fmt.Sprintf("> %-12s %s", formLabels[i]+":", value))
+			if i != formResolveIP {
+				line += active.Render("_")
+			}
+		}
+		if i == formEnvironment {
+			line += dim.Render("  (" + strings.Join(m.config.EnvironmentNames(), ", ") + ")")
+		}
+		s += line + "\n"
+	}
+
+	s += "\n" + dim.Render(m.status)
+	s += "\n" + dim.Render("Press 'tab'/'up'/'down' to move, 'space' to toggle, 'enter' to save, 'esc' to cancel")
+	return s
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+	"github.com/AshutoshPatole/ssm/internal/ssh"
+	"github.com/AshutoshPatole/ssm/internal/store"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var vaultTimeout time.Duration
+
+// vaultCmd represents the vault command
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Keep server credentials in an encrypted file",
+	Long: `The vault keeps the passwords of RDP servers in ~/.ssm/vault.json, encrypted with a passphrase, as an
+alternative to the OS keyring for machines without one, such as headless Linux boxes. Unlike the keyring
+it is pushed and pulled by 'ssm sync'.
+
+The vault is unlocked once and stays unlocked for the commands that follow, 15 minutes by default or
+vaultTimeout in ~/.ssm/local.yaml, until 'ssm vault lock'. The unlocked key is kept by the kernel
+keyring on Linux and by the OS keyring elsewhere, never on disk; without either the passphrase is
+asked for every time. Whether new credentials go to the keyring or
+the vault is chosen per machine with 'ssm vault use'; credentials are read from the vault when it holds
+them and from the keyring otherwise.`,
+}
+
+// vaultInitCmd represents the vault init command
+var vaultInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the vault and store new credentials in it",
+	Run: func(cmd *cobra.Command, args []string) {
+		passphrase, err := askNewSecret("vault passphrase")
+		if err != nil {
+			logrus.Fatalf("Failed to read the passphrase: %v", err)
+		}
+		vault, err := store.CreateVault(passphrase)
+		if err != nil {
+			logrus.Fatalf("Failed to create the vault: %v", err)
+		}
+		startVaultSession(vault)
+		if err := useCredentialStore(store.CredentialVault); err != nil {
+			logrus.Fatalln(err)
+		}
+		fmt.Printf("Vault created at %s, new credentials of this machine are stored in it.\n", displayPath(vault.Path()))
+	},
+}
+
+// vaultUnlockCmd represents the vault unlock command
+var vaultUnlockCmd = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock the vault for the commands that follow",
+	Run: func(cmd *cobra.Command, args []string) {
+		vault, err := store.LoadVault()
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		if err := askVaultPassphrase(vault); err != nil {
+			logrus.Fatalf("Failed to unlock the vault: %v", err)
+		}
+		startVaultSession(vault)
+	},
+}
+
+// vaultLockCmd represents the vault lock command
+var vaultLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock the vault before its timeout",
+	Run: func(cmd *cobra.Command, args []string) {
+		vault, err := store.LoadVault()
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		if err := vault.EndSession(); err != nil {
+			logrus.Fatalf("Failed to lock the vault: %v", err)
+		}
+		fmt.Println("Vault locked")
+	},
+}
+
+// vaultStatusCmd represents the vault status command
+var vaultStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the vault and the credential store of this machine",
+	Run: func(cmd *cobra.Command, args []string) {
+		settings, err := store.LoadLocalSettings()
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		fmt.Printf("Credential store: %s\n", settings.Store())
+		vault, err := store.LoadVault()
+		if errors.Is(err, store.ErrNoVault) {
+			fmt.Println("Vault:            none, create one with 'ssm vault init'")
+			return
+		} else if err != nil {
+			logrus.Fatalln(err)
+		}
+		fmt.Printf("Vault:            %s, %d credentials\n", displayPath(vault.Path()), len(vault.Entries))
+		if expires, ok := vault.SessionExpiry(); ok {
+			fmt.Printf("Status:           unlocked until %s\n", expires.Local().Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Println("Status:           locked")
+		}
+		for _, name := range vault.Names() {
+			fmt.Printf("  %s\n", name)
+		}
+	},
+}
+
+// vaultUseCmd represents the vault use command
+var vaultUseCmd = &cobra.Command{
+	Use:       "use <keyring|vault>",
+	Short:     "Choose where this machine stores new credentials",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: store.CredentialStores,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !slices.Contains(store.CredentialStores, args[0]) {
+			logrus.Fatalf("Invalid credential store %q, allowed values are: %s", args[0], strings.Join(store.CredentialStores, ", "))
+		}
+		if args[0] == store.CredentialVault {
+			if _, err := store.LoadVault(); err != nil {
+				logrus.Fatalln(err)
+			}
+		}
+		if err := useCredentialStore(args[0]); err != nil {
+			logrus.Fatalln(err)
+		}
+		fmt.Printf("New credentials of this machine are stored in the %s\n", args[0])
+	},
+}
+
+// vaultPassphraseCmd represents the vault passphrase command
+var vaultPassphraseCmd = &cobra.Command{
+	Use:   "passphrase",
+	Short: "Change the passphrase of the vault",
+	Run: func(cmd *cobra.Command, args []string) {
+		vault, err := store.LoadVault()
+		if err != nil {
+			logrus.Fatalln(err)
+		}
+		fmt.Println("Enter the current passphrase of your vault.")
+		passphrase, err := ssh.AskPassword()
+		if err != nil {
+			logrus.Fatalf("Failed to read the passphrase: %v", err)
+		}
+		if err := vault.Unlock(passphrase); err != nil {
+			logrus.Fatalf("Failed to unlock the vault: %v", err)
+		}
+		newPassphrase, err := askNewSecret("vault passphrase")
+		if err != nil {
+			logrus.Fatalf("Failed to read the new passphrase: %v", err)
+		}
+		if err := vault.ChangePassphrase(passphrase, newPassphrase); err != nil {
+			logrus.Fatalf("Failed to change the passphrase: %v", err)
+		}
+		startVaultSession(vault)
+		fmt.Println("Vault passphrase changed")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vaultCmd)
+	vaultCmd.AddCommand(vaultInitCmd, vaultUnlockCmd, vaultLockCmd, vaultStatusCmd, vaultUseCmd, vaultPassphraseCmd)
+	vaultUnlockCmd.Flags().DurationVar(&vaultTimeout, "timeout", 0, "Keep the vault unlocked this long instead of vaultTimeout of ~/.ssm/local.yaml, e.g. 1h")
+}
+
+// useCredentialStore makes name the credential store of this machine
+func useCredentialStore(name string) error {
+	settings, err := store.LoadLocalSettings()
+	if err != nil {
+		return err
+	}
+	settings.CredentialStore = name
+	if err := store.SaveLocalSettings(settings); err != nil {
+		return fmt.Errorf("failed to save local settings: %w", err)
+	}
+	return nil
+}
+
+// askVaultPassphrase unlocks vault with a passphrase read from the terminal
+func askVaultPassphrase(vault *store.Vault) error {
+	fmt.Println("Enter the passphrase of your vault.")
+	passphrase, err := ssh.AskPassword()
+	if err != nil {
+		return fmt.Errorf("error reading passphrase: %w", err)
+	}
+	return vault.Unlock(passphrase)
+}
+
+// startVaultSession keeps the unlocked vault unlocked for --timeout, or the timeout of the local settings
+func startVaultSession(vault *store.Vault) {
+	timeout := vaultTimeout
+	if timeout <= 0 {
+		settings, err := store.LoadLocalSettings()
+		if err != nil {
+			logrus.Warnf("Failed to read local settings: %v", err)
+		}
+		if timeout, err = settings.Timeout(); err != nil {
+			timeout = store.DefaultVaultTimeout
+		}
+	}
+	if err := vault.StartSession(timeout); errors.Is(err, security.ErrNoSessionStore) {
+		logrus.Warnf("No keyring to keep the vault unlocked in, its passphrase is asked for every time: %v", err)
+		return
+	} else if err != nil {
+		logrus.Warnf("Failed to keep the vault unlocked: %v", err)
+		return
+	}
+	logrus.Infof("Vault unlocked for %s, lock it earlier with 'ssm vault lock'", timeout)
+}
+
+// unlockVault unlocks vault with the running session, or by asking for the passphrase and starting one
+func unlockVault(vault *store.Vault) error {
+	if vault.Resume() {
+		return nil
+	}
+	if err := askVaultPassphrase(vault); err != nil {
+		return err
+	}
+	startVaultSession(vault)
+	return nil
+}
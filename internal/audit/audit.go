@@ -0,0 +1,68 @@
+// Package audit records actions taken against servers in protected environments.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+)
+
+// Entry is one line of the audit log
+type Entry struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Action      string    `json:"action"`
+	Detail      string    `json:"detail,omitempty"`
+	Group       string    `json:"group"`
+	Environment string    `json:"environment"`
+	Alias       string    `json:"alias"`
+	Host        string    `json:"host"`
+	Outcome     string    `json:"outcome"`
+}
+
+// Path returns the location of the audit log
+func Path() (string, error) {
+	dir, err := store.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+// Record appends entry to the audit log as a JSON line, filling in the time and local user when unset
+func Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.User == "" {
+		if u, err := user.Current(); err == nil {
+			entry.User = u.Username
+		}
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestRecordAppendsJSONLines(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, outcome := range []string{"aborted", "confirmed"} {
+		if err := Record(Entry{Action: "delete", Group: "payments", Environment: "prod", Alias: "pg1", Host: "db1", Outcome: outcome}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, err := Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 2 || entries[0].Outcome != "aborted" || entries[1].Outcome != "confirmed" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if entries[0].Time.IsZero() {
+		t.Errorf("expected time to be filled in")
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 {
+		t.Errorf("expected audit log to be private, got %v", info.Mode().Perm())
+	}
+}
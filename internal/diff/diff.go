@@ -0,0 +1,172 @@
+// Package diff renders line based unified diffs for previewing file changes.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+}
+
+// Unified returns a unified diff between a and b using the given file names in the header.
+// An empty string is returned when both inputs are identical.
+func Unified(fromName, toName string, a, b []byte) string {
+	if string(a) == string(b) {
+		return ""
+	}
+	ops := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks(ops) {
+		sb.WriteString(h)
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes the edit script between a and b from their longest common subsequence
+func diffLines(a, b []string) []op {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{opEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{opDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, op{opInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, op{opDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, op{opInsert, b[j]})
+	}
+	return ops
+}
+
+// hunks groups the edit script into hunks surrounded by contextLines of unchanged lines
+func hunks(ops []op) []string {
+	var result []string
+	aLine, bLine := 1, 1
+	for start := 0; start < len(ops); {
+		// Skip forward to the next change
+		if ops[start].kind == opEqual {
+			start++
+			aLine++
+			bLine++
+			continue
+		}
+
+		from := max(start-contextLines, 0)
+		aStart := aLine - (start - from)
+		bStart := bLine - (start - from)
+
+		// Extend the hunk until we see more than 2*contextLines equal lines in a row
+		end := start
+		equalRun := 0
+		for end < len(ops) {
+			if ops[end].kind == opEqual {
+				equalRun++
+			} else {
+				equalRun = 0
+			}
+			end++
+			if equalRun > 2*contextLines {
+				break
+			}
+		}
+		to := min(end-equalRun+contextLines, len(ops))
+
+		var body strings.Builder
+		aCount, bCount := 0, 0
+		for _, o := range ops[from:to] {
+			line := o.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			switch o.kind {
+			case opEqual:
+				body.WriteString(" " + line)
+				aCount++
+				bCount++
+			case opDelete:
+				body.WriteString("-" + line)
+				aCount++
+			case opInsert:
+				body.WriteString("+" + line)
+				bCount++
+			}
+		}
+		for _, o := range ops[start:to] {
+			switch o.kind {
+			case opEqual:
+				aLine++
+				bLine++
+			case opDelete:
+				aLine++
+			case opInsert:
+				bLine++
+			}
+		}
+		result = append(result, fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))+body.String())
+		start = to
+	}
+	return result
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,55 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedIdentical(t *testing.T) {
+	if got := Unified("a", "b", []byte("x\ny\n"), []byte("x\ny\n")); got != "" {
+		t.Fatalf("expected empty diff for identical input, got %q", got)
+	}
+}
+
+func TestUnifiedChange(t *testing.T) {
+	before := "groups:\n  - name: web\n    user: root\n"
+	after := "groups:\n  - name: web\n    user: admin\n"
+
+	want := `--- current
++++ proposed
+@@ -1,3 +1,3 @@
+ groups:
+   - name: web
+-    user: root
++    user: admin
+`
+	if got := Unified("current", "proposed", []byte(before), []byte(after)); got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		line := strings.Repeat("x", i+1)
+		a = append(a, line)
+		b = append(b, line)
+	}
+	b[1] = "changed-top"
+	b[18] = "changed-bottom"
+
+	got := Unified("a", "b", []byte(strings.Join(a, "\n")+"\n"), []byte(strings.Join(b, "\n")+"\n"))
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Fatalf("expected 2 hunks, got %d:\n%s", n, got)
+	}
+	if !strings.Contains(got, "@@ -1,5 +1,5 @@") || !strings.Contains(got, "@@ -16,5 +16,5 @@") {
+		t.Fatalf("unexpected hunk headers:\n%s", got)
+	}
+}
+
+func TestUnifiedFromEmpty(t *testing.T) {
+	got := Unified("a", "b", nil, []byte("one\n"))
+	if !strings.Contains(got, "@@ -0,0 +1 @@\n+one\n") {
+		t.Fatalf("unexpected diff for new file:\n%s", got)
+	}
+}
@@ -0,0 +1,68 @@
+package facts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AshutoshPatole/ssm/internal/store"
+)
+
+// cacheDir returns the directory holding one JSON file per server
+func cacheDir() (string, error) {
+	dir, err := store.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache", "facts"), nil
+}
+
+// cacheFile maps a hostname to a safe file name inside the cache directory
+func cacheFile(host string) (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, host)
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// Save stores the facts of host in the cache
+func Save(host string, f *Facts) error {
+	path, err := cacheFile(host)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// Cached returns the last facts collected for host, or nil when none are cached
+func Cached(host string) *Facts {
+	path, err := cacheFile(host)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var f Facts
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil
+	}
+	return &f
+}
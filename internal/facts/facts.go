@@ -0,0 +1,139 @@
+// Package facts gathers system information from servers over SSH and caches it locally.
+package facts
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Facts describes the operating system and resource usage of a server
+type Facts struct {
+	OS             string    `json:"os"`
+	Kernel         string    `json:"kernel"`
+	UptimeSeconds  int64     `json:"uptimeSeconds"`
+	CPUs           int       `json:"cpus"`
+	Load1          float64   `json:"load1"`
+	MemTotalKB     uint64    `json:"memTotalKB"`
+	MemAvailableKB uint64    `json:"memAvailableKB"`
+	DiskTotalKB    uint64    `json:"diskTotalKB"`
+	DiskUsedKB     uint64    `json:"diskUsedKB"`
+	CollectedAt    time.Time `json:"collectedAt"`
+}
+
+// collectScript prints one key=value pair per line and only relies on POSIX tools and /proc
+const collectScript = `echo "os=$( (. /etc/os-release 2>/dev/null && echo "$PRETTY_NAME") || uname -s)"
+echo "kernel=$(uname -r)"
+echo "uptime=$(cut -d' ' -f1 /proc/uptime 2>/dev/null)"
+echo "cpus=$(nproc 2>/dev/null || getconf _NPROCESSORS_ONLN 2>/dev/null)"
+echo "load=$(cut -d' ' -f1 /proc/loadavg 2>/dev/null)"
+awk '/^MemTotal:/{print "memtotal="$2} /^MemAvailable:/{print "memavailable="$2}' /proc/meminfo 2>/dev/null
+df -Pk / 2>/dev/null | awk 'NR==2{print "disktotal="$2; print "diskused="$3}'`
+
+// Collect runs the collection script on the server behind client
+func Collect(client *ssh.Client) (*Facts, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer func(session *ssh.Session) {
+		_ = session.Close()
+	}(session)
+
+	output, err := session.Output(collectScript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect facts: %w", err)
+	}
+	f := parse(string(output))
+	f.CollectedAt = time.Now()
+	return f, nil
+}
+
+// parse reads the key=value output of collectScript, ignoring values it cannot interpret
+func parse(output string) *Facts {
+	f := &Facts{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "os":
+			f.OS = value
+		case "kernel":
+			f.Kernel = value
+		case "uptime":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				f.UptimeSeconds = int64(seconds)
+			}
+		case "cpus":
+			f.CPUs, _ = strconv.Atoi(value)
+		case "load":
+			f.Load1, _ = strconv.ParseFloat(value, 64)
+		case "memtotal":
+			f.MemTotalKB, _ = strconv.ParseUint(value, 10, 64)
+		case "memavailable":
+			f.MemAvailableKB, _ = strconv.ParseUint(value, 10, 64)
+		case "disktotal":
+			f.DiskTotalKB, _ = strconv.ParseUint(value, 10, 64)
+		case "diskused":
+			f.DiskUsedKB, _ = strconv.ParseUint(value, 10, 64)
+		}
+	}
+	return f
+}
+
+// MemoryUsage returns the percentage of memory in use, or -1 when unknown
+func (f *Facts) MemoryUsage() float64 {
+	if f.MemTotalKB == 0 {
+		return -1
+	}
+	return 100 * float64(f.MemTotalKB-min(f.MemAvailableKB, f.MemTotalKB)) / float64(f.MemTotalKB)
+}
+
+// DiskUsage returns the percentage of the root filesystem in use, or -1 when unknown
+func (f *Facts) DiskUsage() float64 {
+	if f.DiskTotalKB == 0 {
+		return -1
+	}
+	return 100 * float64(f.DiskUsedKB) / float64(f.DiskTotalKB)
+}
+
+// Uptime returns a compact human readable uptime such as 12d4h or 3h20m
+func (f *Facts) Uptime() string {
+	d := time.Duration(f.UptimeSeconds) * time.Second
+	switch {
+	case f.UptimeSeconds <= 0:
+		return "-"
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
+
+// Summary returns a one line description used in pickers
+func (f *Facts) Summary() string {
+	parts := []string{f.OS}
+	if f.Kernel != "" {
+		parts = append(parts, f.Kernel)
+	}
+	parts = append(parts, "up "+f.Uptime())
+	if f.CPUs > 0 {
+		parts = append(parts, fmt.Sprintf("%d CPU load %.2f", f.CPUs, f.Load1))
+	}
+	if m := f.MemoryUsage(); m >= 0 {
+		parts = append(parts, fmt.Sprintf("mem %.0f%%", m))
+	}
+	if d := f.DiskUsage(); d >= 0 {
+		parts = append(parts, fmt.Sprintf("disk %.0f%%", d))
+	}
+	return strings.Join(parts, " · ")
+}
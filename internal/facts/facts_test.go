@@ -0,0 +1,51 @@
+package facts
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	output := `os=Ubuntu 22.04.4 LTS
+kernel=5.15.0-105-generic
+uptime=1040523.17
+cpus=4
+load=0.42
+memtotal=8000000
+memavailable=2000000
+disktotal=100000
+diskused=71000
+garbage line
+`
+	f := parse(output)
+	if f.OS != "Ubuntu 22.04.4 LTS" || f.Kernel != "5.15.0-105-generic" || f.CPUs != 4 {
+		t.Fatalf("unexpected facts: %+v", f)
+	}
+	if f.Uptime() != "12d1h" {
+		t.Errorf("unexpected uptime: %s", f.Uptime())
+	}
+	if f.MemoryUsage() != 75 {
+		t.Errorf("unexpected memory usage: %v", f.MemoryUsage())
+	}
+	if f.DiskUsage() != 71 {
+		t.Errorf("unexpected disk usage: %v", f.DiskUsage())
+	}
+}
+
+func TestParseMissingValues(t *testing.T) {
+	f := parse("os=Darwin\nkernel=23.4.0\nuptime=\n")
+	if f.MemoryUsage() != -1 || f.DiskUsage() != -1 || f.Uptime() != "-" {
+		t.Fatalf("expected unknown values to be reported as such: %+v", f)
+	}
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if Cached("web-01.example.com") != nil {
+		t.Fatal("expected empty cache")
+	}
+	if err := Save("web-01.example.com", &Facts{OS: "Debian GNU/Linux 12", CPUs: 2}); err != nil {
+		t.Fatal(err)
+	}
+	f := Cached("web-01.example.com")
+	if f == nil || f.OS != "Debian GNU/Linux 12" || f.CPUs != 2 {
+		t.Fatalf("unexpected cached facts: %+v", f)
+	}
+}
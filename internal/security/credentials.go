@@ -1,6 +1,7 @@
 package security
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/zalando/go-keyring"
@@ -19,3 +20,21 @@ func RetreiveCredentials(key string) (string, error) {
 	}
 	return password, nil
 }
+
+// DeleteCredentials removes a credential from the OS keyring, a missing one is not an error
+func DeleteCredentials(key string) error {
+	err := keyring.Delete(appName, key)
+	if err == nil || errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return fmt.Errorf("error deleting credentials %v", err)
+}
+
+// KeyringAvailable reports whether the OS keyring can be reached
+func KeyringAvailable() error {
+	_, err := keyring.Get(appName, "ssm-keyring-probe")
+	if err == nil || errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	return err
+}
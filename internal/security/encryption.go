@@ -3,6 +3,7 @@ package security
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -45,3 +46,11 @@ func EncryptData(data []byte, key []byte) string {
 
 	return hex.EncodeToString(ciphertext)
 }
+
+// ContentHash returns a keyed hash of data, so that synchronised files can be compared without
+// revealing their content to whoever keeps them
+func ContentHash(data []byte, key []byte) string {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,170 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Envelope versions
+const (
+	// EnvelopeV1 derives the key with PBKDF2-SHA256 and the constant KeySalt, see GenerateEncryptionKey
+	EnvelopeV1 = 1
+	// EnvelopeV2 derives the key with Argon2id and a random salt per user
+	EnvelopeV2 = 2
+	// EnvelopeV3 encrypts with a random data key, wrapped with the key derived like version 2. Changing
+	// the secret only wraps the data key again, the data stays as it is.
+	EnvelopeV3 = 3
+)
+
+// Argon2id parameters of new envelopes
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+	dataKeyLen    = 32
+	keyCheckLabel = "ssm sync key check"
+)
+
+// ErrWrongSecret is returned when a key does not match the envelope it was derived for
+var ErrWrongSecret = errors.New("wrong password or passphrase")
+
+// Envelope describes how the key encrypting synchronised data is derived from a password or passphrase.
+// It is stored next to the ciphertext, so that any machine knowing the secret can derive the same key.
+type Envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf,omitempty"`
+	Salt    string `json:"salt,omitempty"`
+	Time    uint32 `json:"time,omitempty"`
+	// Memory is in KiB
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	// Check is a keyed hash of a constant, telling a wrong secret apart from damaged data
+	Check string `json:"check,omitempty"`
+	// WrappedKey is the data key of version 3, encrypted with the key derived from the secret
+	WrappedKey string `json:"wrapped_key,omitempty"`
+}
+
+// NewEnvelope returns a version 3 envelope with a new random salt and no data key yet, see Wrap
+func NewEnvelope() (Envelope, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return Envelope{}, fmt.Errorf("error generating salt: %w", err)
+	}
+	return Envelope{
+		Version: EnvelopeV3,
+		KDF:     "argon2id",
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		Time:    argon2Time,
+		Memory:  argon2Memory,
+		Threads: argon2Threads,
+	}, nil
+}
+
+// DeriveKey derives the 32 byte AES key of the envelope from secret. For version 3 this is the key
+// wrapping the data key, use Open for the data key.
+func (e Envelope) DeriveKey(secret string) ([]byte, error) {
+	switch e.Version {
+	case 0, EnvelopeV1:
+		return GenerateEncryptionKey(secret), nil
+	case EnvelopeV2, EnvelopeV3:
+		if e.KDF != "argon2id" {
+			return nil, fmt.Errorf("unsupported key derivation %q", e.KDF)
+		}
+		salt, err := base64.StdEncoding.DecodeString(e.Salt)
+		if err != nil || len(salt) == 0 {
+			return nil, fmt.Errorf("invalid salt in envelope")
+		}
+		if e.Time == 0 || e.Memory == 0 || e.Threads == 0 {
+			return nil, fmt.Errorf("invalid argon2id parameters in envelope")
+		}
+		return argon2.IDKey([]byte(secret), salt, e.Time, e.Memory, e.Threads, 32), nil
+	}
+	return nil, fmt.Errorf("envelope version %d is newer than the supported version %d, please update ssm", e.Version, EnvelopeV3)
+}
+
+// Seal records the check of key, so that Verify can tell a wrong secret
+func (e *Envelope) Seal(key []byte) {
+	e.Check = ContentHash([]byte(keyCheckLabel), key)
+}
+
+// Verify returns ErrWrongSecret when key was not derived from the secret the envelope was sealed with.
+// Envelopes without a check, such as version 1, cannot be verified and pass.
+func (e Envelope) Verify(key []byte) error {
+	if e.Check == "" || hmac.Equal([]byte(e.Check), []byte(ContentHash([]byte(keyCheckLabel), key))) {
+		return nil
+	}
+	return ErrWrongSecret
+}
+
+// NewDataKey returns a random data key for Wrap
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, dataKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error generating data key: %w", err)
+	}
+	return key, nil
+}
+
+// Wrap stores dataKey in a version 3 envelope, encrypted with the key derived from secret
+func (e *Envelope) Wrap(dataKey []byte, secret string) error {
+	if e.Version != EnvelopeV3 {
+		return fmt.Errorf("envelope version %d cannot wrap a data key", e.Version)
+	}
+	key, err := e.DeriveKey(secret)
+	if err != nil {
+		return err
+	}
+	e.Seal(key)
+	e.WrappedKey = EncryptData(dataKey, key)
+	if e.WrappedKey == "" {
+		return fmt.Errorf("error wrapping data key")
+	}
+	return nil
+}
+
+// Open returns the key encrypting the data of the envelope: the unwrapped data key of version 3, the
+// key derived from secret otherwise. It returns ErrWrongSecret when secret is not the one the envelope
+// was sealed with.
+func (e Envelope) Open(secret string) ([]byte, error) {
+	key, err := e.DeriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Verify(key); err != nil {
+		return nil, err
+	}
+	if e.Version < EnvelopeV3 {
+		return key, nil
+	}
+	dataKey, err := DecryptData(e.WrappedKey, key)
+	if err != nil || len(dataKey) != dataKeyLen {
+		return nil, ErrWrongSecret
+	}
+	return dataKey, nil
+}
+
+// Rewrap returns a copy of the version 3 envelope with the data key wrapped for newSecret instead of
+// secret, under a new salt
+func (e Envelope) Rewrap(secret, newSecret string) (Envelope, error) {
+	if e.Version != EnvelopeV3 {
+		return Envelope{}, fmt.Errorf("envelope version %d has no data key to wrap again", e.Version)
+	}
+	dataKey, err := e.Open(secret)
+	if err != nil {
+		return Envelope{}, err
+	}
+	rewrapped, err := NewEnvelope()
+	if err != nil {
+		return Envelope{}, err
+	}
+	if err := rewrapped.Wrap(dataKey, newSecret); err != nil {
+		return Envelope{}, err
+	}
+	return rewrapped, nil
+}
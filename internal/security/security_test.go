@@ -2,6 +2,7 @@ package security
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 )
 
@@ -49,3 +50,95 @@ func TestDecryptBoundsCheck(t *testing.T) {
 		t.Fatalf("expected error for short ciphertext, got nil")
 	}
 }
+
+func TestEnvelopeV2(t *testing.T) {
+	envelope, err := NewEnvelope()
+	if err != nil {
+		t.Fatalf("NewEnvelope: %v", err)
+	}
+	key, err := envelope.DeriveKey("supersecret123")
+	if err != nil {
+		t.Fatalf("DeriveKey: %v", err)
+	}
+	if len(key) != 32 {
+		t.Fatalf("expected a 32 byte key, got %d bytes", len(key))
+	}
+	envelope.Seal(key)
+
+	again, err := envelope.DeriveKey("supersecret123")
+	if err != nil || !bytes.Equal(key, again) {
+		t.Fatalf("deriving the key twice gave different keys (err %v)", err)
+	}
+	if err := envelope.Verify(again); err != nil {
+		t.Fatalf("Verify rejected the right secret: %v", err)
+	}
+	wrong, _ := envelope.DeriveKey("wrongpassword")
+	if err := envelope.Verify(wrong); !errors.Is(err, ErrWrongSecret) {
+		t.Fatalf("expected ErrWrongSecret for a wrong secret, got %v", err)
+	}
+
+	other, _ := NewEnvelope()
+	if other.Salt == envelope.Salt {
+		t.Fatalf("two envelopes got the same salt")
+	}
+	if otherKey, _ := other.DeriveKey("supersecret123"); bytes.Equal(key, otherKey) {
+		t.Fatalf("the same secret gave the same key with different salts")
+	}
+}
+
+func TestEnvelopeVersions(t *testing.T) {
+	for _, e := range []Envelope{{}, {Version: EnvelopeV1}} {
+		key, err := e.DeriveKey("supersecret123")
+		if err != nil || !bytes.Equal(key, GenerateEncryptionKey("supersecret123")) {
+			t.Fatalf("version %d should derive the version 1 key (err %v)", e.Version, err)
+		}
+		if err := e.Verify(key); err != nil {
+			t.Fatalf("an envelope without check should pass Verify, got %v", err)
+		}
+	}
+	if _, err := (Envelope{Version: EnvelopeV2 + 1}).DeriveKey("supersecret123"); err == nil {
+		t.Fatalf("expected an error for an unknown envelope version")
+	}
+	if _, err := (Envelope{Version: EnvelopeV2, KDF: "argon2id"}).DeriveKey("supersecret123"); err == nil {
+		t.Fatalf("expected an error for an envelope without salt")
+	}
+}
+
+func TestEnvelopeWrappedKey(t *testing.T) {
+	envelope, err := NewEnvelope()
+	if err != nil {
+		t.Fatalf("NewEnvelope: %v", err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatalf("NewDataKey: %v", err)
+	}
+	if err := envelope.Wrap(dataKey, "supersecret123"); err != nil {
+		t.Fatalf("Wrap: %v", err)
+	}
+	opened, err := envelope.Open("supersecret123")
+	if err != nil || !bytes.Equal(opened, dataKey) {
+		t.Fatalf("Open did not return the data key (err %v)", err)
+	}
+	if _, err := envelope.Open("wrongpassword"); !errors.Is(err, ErrWrongSecret) {
+		t.Fatalf("expected ErrWrongSecret for a wrong secret, got %v", err)
+	}
+
+	rewrapped, err := envelope.Rewrap("supersecret123", "newsecret456")
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if rewrapped.Salt == envelope.Salt {
+		t.Fatalf("Rewrap kept the salt")
+	}
+	opened, err = rewrapped.Open("newsecret456")
+	if err != nil || !bytes.Equal(opened, dataKey) {
+		t.Fatalf("the rewrapped envelope did not open to the same data key (err %v)", err)
+	}
+	if _, err := rewrapped.Open("supersecret123"); !errors.Is(err, ErrWrongSecret) {
+		t.Fatalf("the old secret still opens the rewrapped envelope: %v", err)
+	}
+	if _, err := envelope.Rewrap("wrongpassword", "newsecret456"); !errors.Is(err, ErrWrongSecret) {
+		t.Fatalf("Rewrap accepted a wrong secret: %v", err)
+	}
+}
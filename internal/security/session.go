@@ -0,0 +1,53 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// sessionPrefix keeps sessions apart from the credentials of servers in the OS keyring
+const sessionPrefix = "ssm-session:"
+
+// ErrNoSessionStore is returned by StoreSession when this machine has nowhere to keep a session
+// but the disk
+var ErrNoSessionStore = errors.New("no keyring to keep the session in")
+
+// StoreSession keeps value under name for timeout, in the memory of the OS rather than on disk: the
+// kernel keyring of the user on Linux, which drops it after timeout, or the OS keyring otherwise.
+// It returns ErrNoSessionStore when neither can be reached.
+func StoreSession(name, value string, timeout time.Duration) error {
+	kernelErr := storeKernelSession(name, value, timeout)
+	if kernelErr == nil {
+		return nil
+	}
+	if err := keyring.Set(appName, sessionPrefix+name, value); err != nil {
+		return fmt.Errorf("%w: %v, %v", ErrNoSessionStore, kernelErr, err)
+	}
+	return nil
+}
+
+// LoadSession returns the value of the session name, false when there is none
+func LoadSession(name string) (string, bool) {
+	if value, err := loadKernelSession(name); err == nil {
+		return value, true
+	}
+	value, err := keyring.Get(appName, sessionPrefix+name)
+	return value, err == nil
+}
+
+// DeleteSession removes the session name, a missing one is not an error
+func DeleteSession(name string) error {
+	deleteKernelSession(name)
+	err := keyring.Delete(appName, sessionPrefix+name)
+	if err == nil || errors.Is(err, keyring.ErrNotFound) {
+		return nil
+	}
+	// Without an OS keyring the session can only have been kept by the kernel
+	if KeyringAvailable() != nil {
+		return nil
+	}
+	return fmt.Errorf("error deleting session %v", err)
+}
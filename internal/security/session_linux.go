@@ -0,0 +1,51 @@
+//go:build linux
+
+package security
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// storeKernelSession adds the session to the user keyring of the kernel, which expires it after timeout
+func storeKernelSession(name, value string, timeout time.Duration) error {
+	deleteKernelSession(name)
+	id, err := unix.AddKey("user", sessionPrefix+name, []byte(value), unix.KEY_SPEC_USER_KEYRING)
+	if err != nil {
+		return err
+	}
+	seconds := int(math.Ceil(timeout.Seconds()))
+	if _, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, max(seconds, 1), 0, 0); err != nil {
+		_, _ = unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+		return err
+	}
+	return nil
+}
+
+// loadKernelSession reads the session from the user keyring of the kernel
+func loadKernelSession(name string) (string, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", sessionPrefix+name, 0)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 512)
+	for {
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return "", err
+		}
+		if n <= len(buf) {
+			return string(buf[:n]), nil
+		}
+		buf = make([]byte, n)
+	}
+}
+
+// deleteKernelSession removes the session from the user keyring of the kernel, if it is there
+func deleteKernelSession(name string) {
+	if id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", sessionPrefix+name, 0); err == nil {
+		_, _ = unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package security
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoKernelKeyring is returned on systems without a kernel keyring, where sessions go to the OS keyring
+var errNoKernelKeyring = errors.New("no kernel keyring")
+
+func storeKernelSession(string, string, time.Duration) error {
+	return errNoKernelKeyring
+}
+
+func loadKernelSession(string) (string, error) {
+	return "", errNoKernelKeyring
+}
+
+func deleteKernelSession(string) {}
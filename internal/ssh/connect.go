@@ -55,25 +55,19 @@ func Connect(user, server string) {
 	}
 }
 
-func NewSSHClient(user, host string) (*ssh.Client, error) {
+// DefaultKeyPath returns the path of the Ed25519 private key used to authenticate
+func DefaultKeyPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
-	}
-	privateKey := filepath.Join(homeDir, ".ssh", "id_ed25519")
-
-	if _, err := os.Stat(privateKey); os.IsNotExist(err) {
-		return nil, fmt.Errorf("ED25519 private key does not exist at %s", privateKey)
-	}
-	key, err := os.ReadFile(privateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read private key: %w", err)
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
 	}
+	return filepath.Join(homeDir, ".ssh", "id_ed25519"), nil
+}
 
-	// Parse the private key
-	signer, err := ssh.ParsePrivateKey(key)
+func NewSSHClient(user, host string) (*ssh.Client, error) {
+	signer, err := loadSigner()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, err
 	}
 	config := &ssh.ClientConfig{
 		User: user,
@@ -92,4 +86,27 @@ func NewSSHClient(user, host string) (*ssh.Client, error) {
 	return client, nil
 }
 
+// loadSigner reads and parses the Ed25519 private key used to authenticate
+func loadSigner() (ssh.Signer, error) {
+	privateKey, err := DefaultKeyPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(privateKey); os.IsNotExist(err) {
+		return nil, fmt.Errorf("ED25519 private key does not exist at %s", privateKey)
+	}
+	key, err := os.ReadFile(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	// Parse the private key
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return signer, nil
+}
+
 
@@ -0,0 +1,28 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// RunCommand runs command on the server behind client and returns its combined output and exit status.
+// A non-zero exit status is not an error; err is only set when the command could not be run at all.
+func RunCommand(client *ssh.Client, command string) ([]byte, int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	output, err := session.CombinedOutput(command)
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return output, exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return output, -1, fmt.Errorf("failed to run command: %w", err)
+	}
+	return output, 0, nil
+}
@@ -0,0 +1,163 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// RDPPort is the port probed for RDP servers
+const RDPPort = 3389
+
+// ProbeStatus classifies the outcome of a reachability probe
+type ProbeStatus string
+
+const (
+	ProbeOK              ProbeStatus = "ok"
+	ProbeDNSFailure      ProbeStatus = "dns-failure"
+	ProbeRefused         ProbeStatus = "refused"
+	ProbeTimeout         ProbeStatus = "timeout"
+	ProbeUnreachable     ProbeStatus = "unreachable"
+	ProbeHandshakeFailed ProbeStatus = "handshake-failed"
+	ProbeHostKeyMismatch ProbeStatus = "host-key-mismatch"
+	ProbeAuthFailed      ProbeStatus = "auth-failed"
+)
+
+// ProbeResult holds the outcome and timings of a probe
+type ProbeResult struct {
+	Status ProbeStatus
+	// Connect is the time taken to open the TCP connection
+	Connect time.Duration
+	// Handshake is the time taken by the SSH handshake including authentication
+	Handshake time.Duration
+	Err       error
+}
+
+// ProbeTCP checks that host accepts TCP connections on port
+func ProbeTCP(ctx context.Context, host string, port int, timeout time.Duration) ProbeResult {
+	conn, result := dialProbe(ctx, host, port, timeout)
+	if conn != nil {
+		_ = conn.Close()
+	}
+	return result
+}
+
+// ProbeSSH checks TCP reachability on the SSH port, performs the SSH handshake verifying the host key
+// against ~/.ssh/known_hosts when present, and authenticates as user with the Ed25519 key
+func ProbeSSH(ctx context.Context, user, host string, timeout time.Duration) ProbeResult {
+	conn, result := dialProbe(ctx, host, PORT, timeout)
+	if conn == nil {
+		return result
+	}
+	defer conn.Close()
+
+	signer, err := loadSigner()
+	if err != nil {
+		result.Status, result.Err = ProbeAuthFailed, err
+		return result
+	}
+
+	hostKeyCallback, mismatch := verifyKnownHosts()
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	start := time.Now()
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, net.JoinHostPort(host, strconv.Itoa(PORT)), config)
+	result.Handshake = time.Since(start)
+	if err != nil {
+		result.Err = err
+		switch {
+		case *mismatch != nil:
+			result.Status, result.Err = ProbeHostKeyMismatch, *mismatch
+		case strings.Contains(err.Error(), "unable to authenticate"):
+			result.Status = ProbeAuthFailed
+		case isTimeout(err):
+			result.Status = ProbeTimeout
+		default:
+			result.Status = ProbeHandshakeFailed
+		}
+		return result
+	}
+	_ = ssh.NewClient(sshConn, chans, reqs).Close()
+	result.Status = ProbeOK
+	return result
+}
+
+// dialProbe resolves host and opens a TCP connection, classifying any failure
+func dialProbe(ctx context.Context, host string, port int, timeout time.Duration) (net.Conn, ProbeResult) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return nil, ProbeResult{Status: ProbeDNSFailure, Err: err}
+		}
+	}
+
+	dialer := &net.Dialer{}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	elapsed := time.Since(start)
+	if err != nil {
+		status := ProbeUnreachable
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			status = ProbeRefused
+		case isTimeout(err) || errors.Is(err, context.DeadlineExceeded):
+			status = ProbeTimeout
+		}
+		return nil, ProbeResult{Status: status, Connect: elapsed, Err: err}
+	}
+	return conn, ProbeResult{Status: ProbeOK, Connect: elapsed}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// verifyKnownHosts returns a host key callback that rejects keys conflicting with ~/.ssh/known_hosts.
+// Hosts that are not listed, or only listed with keys of another type, are accepted.
+// The returned pointer is set when a mismatch was detected.
+func verifyKnownHosts() (ssh.HostKeyCallback, *error) {
+	mismatch := new(error)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ssh.InsecureIgnoreHostKey(), mismatch
+	}
+	callback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return ssh.InsecureIgnoreHostKey(), mismatch
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if err == nil || !errors.As(err, &keyErr) {
+			return err
+		}
+		for _, want := range keyErr.Want {
+			if want.Key.Type() == key.Type() {
+				*mismatch = fmt.Errorf("host key for %s does not match %s:%d", hostname, want.Filename, want.Line)
+				return *mismatch
+			}
+		}
+		return nil
+	}, mismatch
+}
@@ -0,0 +1,29 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestProbeTCPClassifiesResults(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	if r := ProbeTCP(context.Background(), "127.0.0.1", port, time.Second); r.Status != ProbeOK {
+		t.Errorf("expected open port to be ok, got %s (%v)", r.Status, r.Err)
+	}
+
+	_ = listener.Close()
+	if r := ProbeTCP(context.Background(), "127.0.0.1", port, time.Second); r.Status != ProbeRefused {
+		t.Errorf("expected closed port to be refused, got %s (%v)", r.Status, r.Err)
+	}
+
+	if r := ProbeTCP(context.Background(), "host.invalid", port, time.Second); r.Status != ProbeDNSFailure {
+		t.Errorf("expected unresolvable host to be a dns failure, got %s (%v)", r.Status, r.Err)
+	}
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// MaxBackups is the number of configuration snapshots kept under ~/.ssm/backups
+const MaxBackups = 20
+
+const (
+	backupIDFormat   = "20060102-150405.000"
+	backupManifest   = "manifest.json"
+	backupDirName    = "backups"
+	ssmDataDirectory = ".ssm"
+)
+
+// BackupFile describes a single file captured in a backup
+type BackupFile struct {
+	Name string      `json:"name"`
+	Path string      `json:"path"`
+	Mode os.FileMode `json:"mode"`
+}
+
+// Backup is a timestamped snapshot of one or more files
+type Backup struct {
+	ID        string       `json:"id"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Reason    string       `json:"reason"`
+	Files     []BackupFile `json:"files"`
+}
+
+// DataDir returns the ssm data directory (~/.ssm)
+func DataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ssmDataDirectory), nil
+}
+
+// BackupDir returns the directory holding configuration snapshots
+func BackupDir() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, backupDirName), nil
+}
+
+// Snapshot copies the given files into a new backup and prunes old backups.
+// Files that do not exist or are empty are skipped; no backup is created if nothing is left.
+func Snapshot(reason string, paths ...string) (*Backup, error) {
+	root, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	b := &Backup{ID: now.UTC().Format(backupIDFormat), CreatedAt: now, Reason: reason}
+	dir := filepath.Join(root, b.ID)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			break
+		}
+		b.ID = fmt.Sprintf("%s-%d", now.UTC().Format(backupIDFormat), i)
+		dir = filepath.Join(root, b.ID)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(b.Files) == 0 {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return nil, fmt.Errorf("failed to create backup directory: %w", err)
+			}
+		}
+		name := fmt.Sprintf("%d-%s", len(b.Files), filepath.Base(path))
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write backup of %s: %w", path, err)
+		}
+		abs, _ := filepath.Abs(path)
+		b.Files = append(b.Files, BackupFile{Name: name, Path: abs, Mode: info.Mode().Perm()})
+	}
+	if len(b.Files) == 0 {
+		return nil, nil
+	}
+
+	manifest, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, backupManifest), manifest, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+
+	return b, pruneBackups(root, MaxBackups)
+}
+
+// ListBackups returns all backups, oldest first
+func ListBackups() ([]Backup, error) {
+	root, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []Backup
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, entry.Name(), backupManifest))
+		if err != nil {
+			continue
+		}
+		var b Backup
+		if err := json.Unmarshal(data, &b); err != nil {
+			continue
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].ID < backups[j].ID })
+	return backups, nil
+}
+
+// FindBackup returns the backup whose ID equals or uniquely starts with id
+func FindBackup(id string) (*Backup, error) {
+	backups, err := ListBackups()
+	if err != nil {
+		return nil, err
+	}
+	var matches []Backup
+	for _, b := range backups {
+		if b.ID == id {
+			return &b, nil
+		}
+		if strings.HasPrefix(b.ID, id) {
+			matches = append(matches, b)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("backup %s not found", id)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("backup ID %s is ambiguous, it matches %d backups", id, len(matches))
+	}
+}
+
+// ReadFile returns the backed up contents of f
+func (b *Backup) ReadFile(f BackupFile) ([]byte, error) {
+	root, err := BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(root, b.ID, f.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup of %s: %w", f.Path, err)
+	}
+	return data, nil
+}
+
+// Restore writes every file of the backup back to its original location.
+// The current versions are snapshotted first, and that snapshot is returned so the restore can be undone.
+func Restore(b *Backup) (*Backup, error) {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	configPath, _ := ConfigPath()
+	if configPath != "" {
+		unlock, err := lockConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	// Read the backup before taking the snapshot, which may prune it when it is the oldest
+	var paths []string
+	contents := make([][]byte, len(b.Files))
+	for i, f := range b.Files {
+		data, err := b.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, f.Path)
+		contents[i] = data
+	}
+	previous, err := Snapshot("restore "+b.ID, paths...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up current files: %w", err)
+	}
+
+	for i, f := range b.Files {
+		data := contents[i]
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+			return previous, fmt.Errorf("failed to create directory for %s: %w", f.Path, err)
+		}
+		if err := writeFileAtomic(f.Path, data); err != nil {
+			return previous, err
+		}
+		if err := os.Chmod(f.Path, f.Mode); err != nil {
+			return previous, fmt.Errorf("failed to set permissions on %s: %w", f.Path, err)
+		}
+	}
+
+	if configPath != "" {
+		if err := viper.ReadInConfig(); err != nil {
+			return previous, fmt.Errorf("failed to reload configuration: %w", err)
+		}
+	}
+	return previous, nil
+}
+
+func pruneBackups(root string, keep int) error {
+	backups, err := ListBackups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		if err := os.RemoveAll(filepath.Join(root, backups[0].ID)); err != nil {
+			return fmt.Errorf("failed to remove old backup %s: %w", backups[0].ID, err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreOldestBackupWhenFull(t *testing.T) {
+	setupConfig(t)
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	for i := 0; i < MaxBackups; i++ {
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("version %d\n", i)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Snapshot(fmt.Sprintf("change %d", i), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != MaxBackups {
+		t.Fatalf("expected %d backups, got %d", MaxBackups, len(backups))
+	}
+
+	// The snapshot taken by the restore prunes the backup being restored
+	if _, err := Restore(&backups[0]); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "version 0\n" {
+		t.Errorf("expected the oldest version, got %q", data)
+	}
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+)
+
+// Credential schemes of Server.Credential besides the credential stores CredentialKeyring and CredentialVault
+const (
+	CredentialEnv     = "env"
+	CredentialCommand = "cmd"
+)
+
+// CredentialSchemes are the schemes understood by ParseCredential
+var CredentialSchemes = []string{CredentialKeyring, CredentialVault, CredentialEnv, CredentialCommand}
+
+// ErrCredentialReadOnly is returned when a credential is set or deleted through a provider that only reads
+var ErrCredentialReadOnly = errors.New("credentials of this kind are read only")
+
+// CredentialProvider reads and writes the secrets of servers, e.g. the passwords of RDP servers
+type CredentialProvider interface {
+	// Get returns the secret stored under key
+	Get(key string) (string, error)
+	// Set stores value under key, or returns ErrCredentialReadOnly
+	Set(key, value string) error
+	// Delete removes key, or returns ErrCredentialReadOnly. Deleting a missing key is not an error.
+	Delete(key string) error
+}
+
+// CredentialRef names the secret of a server, written as <scheme>:<key> in the credential field:
+//
+//	keyring:web_prod_host1           the OS keyring
+//	vault:web_prod_host1             the vault, see Vault
+//	env:RDP_PASSWORD                 an environment variable
+//	cmd:pass show ssm/{{.Alias}}     the output of a command
+//
+// The key is a text/template over the server, see CredentialData.
+type CredentialRef struct {
+	Scheme string
+	Key    string
+}
+
+func (r CredentialRef) String() string {
+	if r.Scheme == "" {
+		return r.Key
+	}
+	return r.Scheme + ":" + r.Key
+}
+
+// CredentialData is what the key of a credential can refer to, e.g. {{.Alias}} or {{.Key}}
+type CredentialData struct {
+	Group       string
+	Environment string
+	HostName    string
+	IP          string
+	Alias       string
+	User        string
+	// Key is the default key of the server, see CredentialKey
+	Key string
+}
+
+// CredentialKey returns the default key of a server's credential: group_environment_host
+func CredentialKey(at ServerLocation, hostName string) string {
+	return fmt.Sprintf("%s_%s_%s", at.Group, at.Environment, hostName)
+}
+
+// ParseCredential parses a <scheme>:<key> credential, without expanding its key
+func ParseCredential(credential string) (CredentialRef, error) {
+	scheme, key, ok := strings.Cut(credential, ":")
+	if !ok || key == "" {
+		return CredentialRef{}, fmt.Errorf("invalid credential %q, expected <scheme>:<key> with scheme one of: %s", credential, strings.Join(CredentialSchemes, ", "))
+	}
+	switch scheme {
+	case CredentialKeyring, CredentialVault, CredentialEnv, CredentialCommand:
+	default:
+		return CredentialRef{}, fmt.Errorf("unknown credential scheme %q, allowed values are: %s", scheme, strings.Join(CredentialSchemes, ", "))
+	}
+	words := []string{key}
+	if scheme == CredentialCommand {
+		var err error
+		if words, err = splitCommand(key, true); err != nil {
+			return CredentialRef{}, fmt.Errorf("invalid credential %q: %w", credential, err)
+		}
+	}
+	for _, word := range words {
+		if _, err := template.New("credential").Parse(word); err != nil {
+			return CredentialRef{}, fmt.Errorf("invalid credential %q: %w", credential, err)
+		}
+	}
+	return CredentialRef{Scheme: scheme, Key: key}, nil
+}
+
+// CredentialRef returns the credential of s at the given location with its key expanded. Servers added
+// by earlier versions of ssm name their keyring or vault key in the password field, for which the
+// scheme is empty. It returns false when s has no credential.
+func (s Server) CredentialRef(at ServerLocation) (CredentialRef, bool, error) {
+	if s.Credential == "" {
+		return CredentialRef{Key: s.Password}, s.Password != "", nil
+	}
+	ref, err := ParseCredential(s.Credential)
+	if err != nil {
+		return ref, false, err
+	}
+	data := CredentialData{
+		Group:       at.Group,
+		Environment: at.Environment,
+		HostName:    s.HostName,
+		IP:          s.IP,
+		Alias:       s.Alias,
+		User:        s.User,
+		Key:         CredentialKey(at, s.HostName),
+	}
+	if ref.Scheme != CredentialCommand {
+		if ref.Key, err = expandCredential(ref.Key, data); err != nil {
+			return ref, false, fmt.Errorf("invalid credential %q: %w", s.Credential, err)
+		}
+		return ref, true, nil
+	}
+	// The words of a command are expanded one by one and quoted, so that the values of the server,
+	// which may come from a pulled or shared configuration, are always single arguments
+	words, _ := splitCommand(ref.Key, true)
+	for i, word := range words {
+		if words[i], err = expandCredential(word, data); err != nil {
+			return ref, false, fmt.Errorf("invalid credential %q: %w", s.Credential, err)
+		}
+	}
+	ref.Key = joinCommand(words)
+	return ref, true, nil
+}
+
+// expandCredential executes the template key over data
+func expandCredential(key string, data CredentialData) (string, error) {
+	t, err := template.New("credential").Option("missingkey=error").Parse(key)
+	if err != nil {
+		return "", err
+	}
+	var expanded strings.Builder
+	if err := t.Execute(&expanded, data); err != nil {
+		return "", err
+	}
+	return expanded.String(), nil
+}
+
+// splitCommand splits a command line into words like a POSIX shell, without expanding anything:
+// words are separated by blanks, single quotes keep everything up to the next one, double quotes
+// keep everything but a backslash escaping " or \, and a backslash outside quotes escapes the next
+// character. With templates set, {{ }} actions are kept whole.
+func splitCommand(line string, templates bool) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+	)
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case templates && strings.HasPrefix(string(runes[i:]), "{{"):
+			rest := string(runes[i:])
+			end := strings.Index(rest, "}}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated {{")
+			}
+			action := rest[:end+2]
+			word.WriteString(action)
+			i += utf8.RuneCountInString(action) - 1
+		case r == '\'':
+			end := slices.Index(runes[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated '")
+			}
+			word.WriteString(string(runes[i+1 : i+1+end]))
+			i += end + 1
+		case r == '"':
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("unterminated \"")
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("trailing \\")
+			}
+			i++
+			word.WriteRune(runes[i])
+		default:
+			word.WriteRune(r)
+		}
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return words, nil
+}
+
+// joinCommand quotes words into a command line that splitCommand splits back into them
+func joinCommand(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		if word != "" && strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+			quoted[i] = word
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// OpenCredentialProvider returns the provider of a credential scheme. unlock unlocks the vault,
+// e.g. by asking for its passphrase, and is only called by the vault provider. trust is called by the
+// command provider before running a command and refuses it by returning an error; without trust no
+// command is run.
+func OpenCredentialProvider(scheme string, unlock func(*Vault) error, trust func(command string) error) (CredentialProvider, error) {
+	switch scheme {
+	case CredentialKeyring:
+		return keyringProvider{}, nil
+	case CredentialVault:
+		return vaultProvider{unlock: unlock}, nil
+	case CredentialEnv:
+		return envProvider{}, nil
+	case CredentialCommand:
+		return commandProvider{trust: trust}, nil
+	}
+	return nil, fmt.Errorf("unknown credential scheme %q, allowed values are: %s", scheme, strings.Join(CredentialSchemes, ", "))
+}
+
+// keyringProvider keeps credentials in the OS keyring
+type keyringProvider struct{}
+
+func (keyringProvider) Get(key string) (string, error) {
+	return security.RetreiveCredentials(key)
+}
+
+func (keyringProvider) Set(key, value string) error {
+	return security.StoreCredentials(key, value)
+}
+
+func (keyringProvider) Delete(key string) error {
+	return security.DeleteCredentials(key)
+}
+
+// vaultProvider keeps credentials in the vault of this machine
+type vaultProvider struct {
+	unlock func(*Vault) error
+}
+
+func (p vaultProvider) open() (*Vault, error) {
+	v, err := LoadVault()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.unlock(v); err != nil {
+		return nil, fmt.Errorf("failed to unlock the vault: %w", err)
+	}
+	return v, nil
+}
+
+func (p vaultProvider) Get(key string) (string, error) {
+	v, err := LoadVault()
+	if err != nil {
+		return "", err
+	}
+	if !v.Has(key) {
+		return "", fmt.Errorf("%s is not in the vault", key)
+	}
+	if err := p.unlock(v); err != nil {
+		return "", fmt.Errorf("failed to unlock the vault: %w", err)
+	}
+	return v.Get(key)
+}
+
+func (p vaultProvider) Set(key, value string) error {
+	v, err := p.open()
+	if err != nil {
+		return err
+	}
+	return v.Set(key, value)
+}
+
+func (p vaultProvider) Delete(key string) error {
+	v, err := LoadVault()
+	if errors.Is(err, ErrNoVault) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return v.Delete(key)
+}
+
+// envProvider reads credentials from environment variables
+type envProvider struct{}
+
+func (envProvider) Get(key string) (string, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return "", fmt.Errorf("environment variable %s is not set", key)
+	}
+	return value, nil
+}
+
+func (envProvider) Set(string, string) error {
+	return ErrCredentialReadOnly
+}
+
+func (envProvider) Delete(string) error {
+	return ErrCredentialReadOnly
+}
+
+// commandProvider reads credentials from the output of a command such as 'pass show ssm/web' or
+// 'op read op://ssm/web/password'. The command is split into words like a shell would, but run without
+// one: pipes, redirections and variables are not supported.
+type commandProvider struct {
+	trust func(command string) error
+}
+
+func (p commandProvider) Get(key string) (string, error) {
+	words, err := splitCommand(key, false)
+	if err != nil {
+		return "", fmt.Errorf("invalid command %q: %w", key, err)
+	}
+	if p.trust == nil {
+		return "", fmt.Errorf("%q is not trusted on this machine", key)
+	}
+	if err := p.trust(key); err != nil {
+		return "", err
+	}
+	// The words are run as they are, never by a shell, so no value of the server is interpreted
+	c := exec.Command(words[0], words[1:]...)
+	var stdout bytes.Buffer
+	// The command may ask for a passphrase of its own
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, &stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("%q failed: %w", key, err)
+	}
+	// Like pass, only the first line is the secret
+	value, _, _ := strings.Cut(stdout.String(), "\n")
+	value = strings.TrimSuffix(value, "\r")
+	if value == "" {
+		return "", fmt.Errorf("%q printed no credential", key)
+	}
+	return value, nil
+}
+
+func (commandProvider) Set(string, string) error {
+	return ErrCredentialReadOnly
+}
+
+func (commandProvider) Delete(string) error {
+	return ErrCredentialReadOnly
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"errors"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestCredentialRef(t *testing.T) {
+	at := ServerLocation{Group: "web", Environment: "prod"}
+	server := Server{HostName: "host1.example.com", Alias: "web1", User: "admin"}
+
+	for credential, want := range map[string]CredentialRef{
+		"keyring:{{.Key}}":                        {Scheme: CredentialKeyring, Key: "web_prod_host1.example.com"},
+		"vault:rdp-{{.Alias}}":                    {Scheme: CredentialVault, Key: "rdp-web1"},
+		"env:RDP_PASSWORD":                        {Scheme: CredentialEnv, Key: "RDP_PASSWORD"},
+		"cmd:pass show ssm/{{.Group}}/{{.Alias}}": {Scheme: CredentialCommand, Key: "pass show ssm/web/web1"},
+	} {
+		server.Credential = credential
+		ref, ok, err := server.CredentialRef(at)
+		if err != nil || !ok || ref != want {
+			t.Errorf("%s: expected %v, got %v, %v, %v", credential, want, ref, ok, err)
+		}
+	}
+
+	for _, credential := range []string{"web_prod_host1", "ftp:secret", "env:", "cmd:{{.Nope}}", "cmd:{{.Alias", "cmd:pass show 'ssm"} {
+		server.Credential = credential
+		if _, _, err := server.CredentialRef(at); err == nil {
+			t.Errorf("%s: expected an error", credential)
+		}
+	}
+
+	// Servers added by earlier versions name their key in the password field
+	legacy := Server{HostName: "host1", Password: "web_prod_host1"}
+	if ref, ok, err := legacy.CredentialRef(at); err != nil || !ok || ref != (CredentialRef{Key: "web_prod_host1"}) {
+		t.Errorf("expected the legacy key, got %v, %v, %v", ref, ok, err)
+	}
+	if _, ok, _ := (Server{HostName: "host1"}).CredentialRef(at); ok {
+		t.Errorf("expected no credential")
+	}
+}
+
+func TestReadOnlyCredentialProviders(t *testing.T) {
+	t.Setenv("SSM_TEST_PASSWORD", "hunter2")
+	env, err := OpenCredentialProvider(CredentialEnv, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := env.Get("SSM_TEST_PASSWORD"); err != nil || value != "hunter2" {
+		t.Errorf("expected hunter2, got %q, %v", value, err)
+	}
+	if _, err := env.Get("SSM_TEST_UNSET"); err == nil {
+		t.Errorf("expected an error for an unset variable")
+	}
+	if err := env.Set("SSM_TEST_PASSWORD", "x"); !errors.Is(err, ErrCredentialReadOnly) {
+		t.Errorf("expected ErrCredentialReadOnly, got %v", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	var trusted []string
+	command, err := OpenCredentialProvider(CredentialCommand, nil, func(command string) error {
+		trusted = append(trusted, command)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := command.Get("printf 'hunter2\\nurl: example.com\\n'"); err != nil || value != "hunter2" {
+		t.Errorf("expected the first line of the output, got %q, %v", value, err)
+	}
+	if _, err := command.Get("false"); err == nil {
+		t.Errorf("expected an error for a failing command")
+	}
+	if len(trusted) != 2 {
+		t.Errorf("expected every command to be trusted before running, got %q", trusted)
+	}
+	// The command is run without a shell, its operators are arguments
+	if value, err := command.Get("echo hunter2; exit 1"); err != nil || value != "hunter2; exit 1" {
+		t.Errorf("expected the words echoed, got %q, %v", value, err)
+	}
+	if err := command.Delete("true"); !errors.Is(err, ErrCredentialReadOnly) {
+		t.Errorf("expected ErrCredentialReadOnly, got %v", err)
+	}
+
+	refused, err := OpenCredentialProvider(CredentialCommand, nil, func(string) error { return errors.New("not trusted") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := refused.Get("printf hunter2"); err == nil || err.Error() != "not trusted" {
+		t.Errorf("expected the command to be refused, got %v", err)
+	}
+	untrusted, err := OpenCredentialProvider(CredentialCommand, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := untrusted.Get("printf hunter2"); err == nil {
+		t.Errorf("expected no command to run without trust")
+	}
+}
+
+func TestCommandCredentialQuotesValues(t *testing.T) {
+	at := ServerLocation{Group: "web", Environment: "prod"}
+	server := Server{HostName: "host1", Alias: "x;touch /tmp/pwned", Credential: `cmd:pass show "ssm/{{.Group}}/{{.Alias}}" {{.User}}`}
+	ref, _, err := server.CredentialRef(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `pass show 'ssm/web/x;touch /tmp/pwned' ''`; ref.Key != want {
+		t.Errorf("expected %s, got %s", want, ref.Key)
+	}
+	words, err := splitCommand(ref.Key, false)
+	if err != nil || len(words) != 4 || words[2] != "ssm/web/x;touch /tmp/pwned" || words[3] != "" {
+		t.Errorf("expected the alias as a single argument, got %q, %v", words, err)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	for line, want := range map[string][]string{
+		"pass show ssm/web":           {"pass", "show", "ssm/web"},
+		`op read  'op://a b/c'`:       {"op", "read", "op://a b/c"},
+		`printf "a \"b\" \\ $c" d\ e`: {"printf", `a "b" \ $c`, "d e"},
+		`echo 'it'\''s' ""`:           {"echo", "it's", ""},
+	} {
+		words, err := splitCommand(line, false)
+		if err != nil || !slices.Equal(words, want) {
+			t.Errorf("%s: expected %q, got %q, %v", line, want, words, err)
+			continue
+		}
+		if again, err := splitCommand(joinCommand(words), false); err != nil || !slices.Equal(again, want) {
+			t.Errorf("%s: expected %s to split back into %q, got %q, %v", line, joinCommand(words), want, again, err)
+		}
+	}
+	if words, err := splitCommand(`pass show {{printf "%s %s" .Group .Alias}}`, true); err != nil || len(words) != 3 {
+		t.Errorf("expected a template to stay one word, got %q, %v", words, err)
+	}
+	for _, line := range []string{"", "  ", "echo 'a", `echo "a`, `echo a\`} {
+		if _, err := splitCommand(line, false); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// EnvironmentDef declares an environment servers can be placed in.
+// The order of the definitions in .ssm.yaml is the order environments are listed in.
+// Actions against servers in protected environments need a typed confirmation and are audited,
+// and Background optionally sets the terminal background colour while connected to them.
+type EnvironmentDef struct {
+	Name       string `yaml:"name"`
+	Color      string `yaml:"color,omitempty"`
+	Protected  bool   `yaml:"protected,omitempty"`
+	Background string `yaml:"background,omitempty"`
+}
+
+// DefaultEnvironments are used when the configuration does not declare any environments. None of them is
+// protected: protection is opted into by declaring the environment with protected: true.
+var DefaultEnvironments = []EnvironmentDef{
+	{Name: "dev", Color: "42"},
+	{Name: "staging", Color: "214"},
+	{Name: "prod", Color: "196"},
+}
+
+// backgroundPattern accepts the #RRGGBB colours terminals understand as a background
+var backgroundPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// colorPattern accepts the colours understood by lipgloss: an ANSI colour number or a #RRGGBB value
+var colorPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{6}|[0-9]{1,3})$`)
+
+// EnvironmentDefs returns the declared environments, or DefaultEnvironments when none are declared
+func (c *Config) EnvironmentDefs() []EnvironmentDef {
+	if len(c.Environments) == 0 {
+		return DefaultEnvironments
+	}
+	return c.Environments
+}
+
+// EnvironmentDef returns the definition of the named environment
+func (c *Config) EnvironmentDef(name string) (EnvironmentDef, bool) {
+	defs := c.EnvironmentDefs()
+	i := slices.IndexFunc(defs, func(d EnvironmentDef) bool { return d.Name == name })
+	if i < 0 {
+		return EnvironmentDef{}, false
+	}
+	return defs[i], true
+}
+
+// EnvironmentNames returns the names of the declared environments in order
+func (c *Config) EnvironmentNames() []string {
+	defs := c.EnvironmentDefs()
+	names := make([]string, len(defs))
+	for i, d := range defs {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// EnvironmentRank returns the position of the named environment, placing undeclared ones last
+func (c *Config) EnvironmentRank(name string) int {
+	defs := c.EnvironmentDefs()
+	if i := slices.IndexFunc(defs, func(d EnvironmentDef) bool { return d.Name == name }); i >= 0 {
+		return i
+	}
+	return len(defs)
+}
+
+// CheckEnvironment returns an error naming the allowed values when name is not a declared environment
+func (c *Config) CheckEnvironment(name string) error {
+	if _, ok := c.EnvironmentDef(name); ok {
+		return nil
+	}
+	return fmt.Errorf("unknown environment %q, allowed values are: %s (declare more under 'environments:' in .ssm.yaml)",
+		name, strings.Join(c.EnvironmentNames(), ", "))
+}
+
+// validateEnvironmentDefs checks the declared environments for missing or duplicate names and invalid colours
+func validateEnvironmentDefs(defs []EnvironmentDef) []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for i, d := range defs {
+		switch {
+		case d.Name == "":
+			errs = append(errs, fmt.Errorf("environment definition #%d has no name", i+1))
+		case seen[d.Name]:
+			errs = append(errs, fmt.Errorf("environment %q is declared more than once", d.Name))
+		}
+		seen[d.Name] = true
+		if d.Color != "" && !colorPattern.MatchString(d.Color) {
+			errs = append(errs, fmt.Errorf("environment %q: invalid color %q, expected an ANSI colour number or #RRGGBB", d.Name, d.Color))
+		}
+		if d.Background != "" && !backgroundPattern.MatchString(d.Background) {
+			errs = append(errs, fmt.Errorf("environment %q: invalid background %q, expected #RRGGBB", d.Name, d.Background))
+		}
+	}
+	return errs
+}
@@ -81,6 +81,18 @@ func RegisterUser(email, password string) (*auth.UserRecord, error) {
 	return user, nil
 }
 
+// ChangePassword sets the password of the user with the given ID
+func ChangePassword(userID, password string) error {
+	client, err := App.Auth(Ctx)
+	if err != nil {
+		return fmt.Errorf("error getting Auth client: %v", err)
+	}
+	if _, err := client.UpdateUser(Ctx, userID, (&auth.UserToUpdate{}).Password(password)); err != nil {
+		return fmt.Errorf("error changing password: %v", err)
+	}
+	return nil
+}
+
 // LoginUser authenticates a user with email and password
 func LoginUser(email, password string) (map[string]interface{}, error) {
 	_, err := App.Auth(Ctx)
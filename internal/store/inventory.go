@@ -0,0 +1,293 @@
+package store
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Find returns the server with the given alias. Group and environment in within narrow the search
+// down when set; an alias used by several servers within it is reported as ambiguous.
+func (c *Config) Find(alias string, within ServerLocation) (Entry, error) {
+	var (
+		found     Entry
+		locations []string
+	)
+	for _, g := range c.Groups {
+		if within.Group != "" && g.Name != within.Group {
+			continue
+		}
+		for _, env := range g.Environment {
+			if within.Environment != "" && env.Name != within.Environment {
+				continue
+			}
+			for _, s := range env.Servers {
+				if s.Alias == alias {
+					found = Entry{ServerLocation: ServerLocation{Group: g.Name, Environment: env.Name}, Server: s}
+					locations = append(locations, found.ServerLocation.String())
+				}
+			}
+		}
+	}
+	switch len(locations) {
+	case 0:
+		return Entry{}, fmt.Errorf("%w: no server with alias %q", ErrNotFound, alias)
+	case 1:
+		return found, nil
+	default:
+		return Entry{}, fmt.Errorf("%w: %q is used in %s, narrow it down with a group and environment", ErrAmbiguous, alias, strings.Join(locations, ", "))
+	}
+}
+
+// Entries returns the servers matching filter. Within each group, environments are listed in the order
+// they are declared in.
+func (c *Config) Entries(filter Filter) []Entry {
+	var entries []Entry
+	for _, g := range c.Groups {
+		if filter.Group != "" && g.Name != filter.Group {
+			continue
+		}
+		envs := slices.Clone(g.Environment)
+		slices.SortStableFunc(envs, func(a, b Env) int {
+			return cmp.Compare(c.EnvironmentRank(a.Name), c.EnvironmentRank(b.Name))
+		})
+		for _, env := range envs {
+			if filter.Environment != "" && env.Name != filter.Environment {
+				continue
+			}
+			for _, s := range env.Servers {
+				if filter.Selector.Matches(g.Name, env.Name, s) {
+					entries = append(entries, Entry{ServerLocation: ServerLocation{Group: g.Name, Environment: env.Name}, Server: s})
+				}
+			}
+		}
+	}
+	return entries
+}
+
+// locate returns the indexes of the group and environment at the given location, -1 when missing
+func (c *Config) locate(at ServerLocation) (int, int) {
+	gi := slices.IndexFunc(c.Groups, func(g Group) bool { return g.Name == at.Group })
+	if gi < 0 {
+		return -1, -1
+	}
+	ei := slices.IndexFunc(c.Groups[gi].Environment, func(e Env) bool { return e.Name == at.Environment })
+	return gi, ei
+}
+
+// indexOf returns the index of the server identified by alias, or by hostname when it has no alias
+func indexOf(servers []Server, alias, hostname string) int {
+	return slices.IndexFunc(servers, func(s Server) bool {
+		if alias == "" {
+			return s.Alias == "" && s.HostName == hostname
+		}
+		return s.Alias == alias
+	})
+}
+
+// checkServer validates a server about to be written to the given location
+func (c *Config) checkServer(at ServerLocation, server Server) error {
+	if at.Group == "" {
+		return fmt.Errorf("group cannot be empty")
+	}
+	if err := c.CheckEnvironment(at.Environment); err != nil {
+		return err
+	}
+	if server.HostName == "" || server.User == "" {
+		return fmt.Errorf("hostname and user cannot be empty")
+	}
+	return nil
+}
+
+// place writes server at the given location, replacing the server at index si of that environment
+// unless si is negative, after checking the other servers there for duplicates
+func (c *Config) place(at ServerLocation, si int, server Server) error {
+	var others []Server
+	gi, ei := c.locate(at)
+	if ei >= 0 {
+		others = c.Groups[gi].Environment[ei].Servers
+		if si >= 0 {
+			others = slices.Delete(slices.Clone(others), si, si+1)
+		}
+	}
+	if checkDuplicateServer(server, others) {
+		return fmt.Errorf("%w: a server with the same hostname, IP or alias already exists in %s", ErrDuplicate, at)
+	}
+	if si >= 0 {
+		c.Groups[gi].Environment[ei].Servers[si] = server
+		return nil
+	}
+	return addServer(c, at.Group, at.Environment, server)
+}
+
+// CheckAdd reports whether server can be added at the given location without writing anything,
+// so that callers can fail before side effects such as storing credentials. Add checks again on write.
+func (c *Config) CheckAdd(at ServerLocation, server Server) error {
+	if err := c.checkServer(at, server); err != nil {
+		return err
+	}
+	if gi, ei := c.locate(at); ei >= 0 && checkDuplicateServer(server, c.Groups[gi].Environment[ei].Servers) {
+		return fmt.Errorf("%w: a server with the same hostname, IP or alias already exists in %s", ErrDuplicate, at)
+	}
+	return nil
+}
+
+// hostIPs holds the IPs of hostnames resolved before the configuration was locked, see writeServer
+type hostIPs map[string]string
+
+// errUnresolved is returned by a write that needs the IP of a hostname missing from its hostIPs
+type errUnresolved string
+
+func (e errUnresolved) Error() string {
+	return fmt.Sprintf("%s was not resolved", string(e))
+}
+
+// ip returns the IP of host, or errUnresolved when it was not resolved yet
+func (ips hostIPs) ip(host string) (string, error) {
+	ip, ok := ips[host]
+	if !ok {
+		return "", errUnresolved(host)
+	}
+	return ip, nil
+}
+
+// writeServer runs write through update with the IPs of the hostnames it needs. DNS is never queried
+// while the configuration is locked, as a slow resolver would block every other ssm process: the
+// hostname of a server without an IP is resolved first, and when write needs another IP it returns
+// errUnresolved, which is resolved before write runs again.
+func writeServer(update func(fn func(c *Config) error) error, server Server, write func(c *Config, ips hostIPs) error) error {
+	ips := hostIPs{}
+	if server.IP == "" {
+		ips[server.HostName] = ResolveIP(server.HostName)
+	}
+	for {
+		err := update(func(c *Config) error {
+			return write(c, ips)
+		})
+		var unresolved errUnresolved
+		if !errors.As(err, &unresolved) {
+			return err
+		}
+		if _, ok := ips[string(unresolved)]; ok {
+			return err
+		}
+		ips[string(unresolved)] = ResolveIP(string(unresolved))
+	}
+}
+
+func (c *Config) insertServer(at ServerLocation, server Server, ips hostIPs) error {
+	if err := c.CheckAdd(at, server); err != nil {
+		return err
+	}
+	if server.IP == "" {
+		ip, err := ips.ip(server.HostName)
+		if err != nil {
+			return err
+		}
+		server.IP = ip
+	}
+	return addServer(c, at.Group, at.Environment, server)
+}
+
+func (c *Config) upsertServer(at ServerLocation, server Server, ips hostIPs) error {
+	if err := c.checkServer(at, server); err != nil {
+		return err
+	}
+	si := -1
+	if gi, ei := c.locate(at); ei >= 0 {
+		servers := c.Groups[gi].Environment[ei].Servers
+		if si = indexOf(servers, server.Alias, server.HostName); si >= 0 && servers[si].HostName != server.HostName {
+			server.IP = ""
+		}
+	}
+	if server.IP == "" {
+		ip, err := ips.ip(server.HostName)
+		if err != nil {
+			return err
+		}
+		server.IP = ip
+	}
+	return c.place(at, si, server)
+}
+
+func (c *Config) moveServer(alias string, from, to ServerLocation, server Server, ips hostIPs) error {
+	gi, ei := c.locate(from)
+	si := -1
+	if ei >= 0 {
+		si = slices.IndexFunc(c.Groups[gi].Environment[ei].Servers, func(s Server) bool { return s.Alias == alias })
+	}
+	if si < 0 {
+		return fmt.Errorf("%w: no server with alias %q in %s", ErrNotFound, alias, from)
+	}
+	current := c.Groups[gi].Environment[ei].Servers[si]
+
+	if err := c.checkServer(to, server); err != nil {
+		return err
+	}
+	if server.IP == "" || server.HostName != current.HostName {
+		ip, err := ips.ip(server.HostName)
+		if err != nil {
+			return err
+		}
+		server.IP = ip
+	}
+	if from == to {
+		return c.place(to, si, server)
+	}
+
+	// Check the destination before the server is taken out of its current environment
+	if gi, ei := c.locate(to); ei >= 0 && checkDuplicateServer(server, c.Groups[gi].Environment[ei].Servers) {
+		return fmt.Errorf("%w: a server with the same hostname, IP or alias already exists in %s", ErrDuplicate, to)
+	}
+	c.removeServer(gi, ei, si)
+	return addServer(c, to.Group, to.Environment, server)
+}
+
+func (c *Config) deleteServers(entries []Entry) error {
+	for _, e := range entries {
+		gi, ei := c.locate(e.ServerLocation)
+		si := -1
+		if ei >= 0 {
+			si = indexOf(c.Groups[gi].Environment[ei].Servers, e.Server.Alias, e.Server.HostName)
+		}
+		if si < 0 {
+			return fmt.Errorf("%w: %s (%s) in %s", ErrNotFound, e.Server.Alias, e.Server.HostName, e.ServerLocation)
+		}
+		c.removeServer(gi, ei, si)
+	}
+	return nil
+}
+
+// removeServer removes a server, dropping its environment and group when they are left empty
+func (c *Config) removeServer(gi, ei, si int) {
+	env := &c.Groups[gi].Environment[ei]
+	env.Servers = slices.Delete(env.Servers, si, si+1)
+	if len(env.Servers) > 0 {
+		return
+	}
+	c.Groups[gi].Environment = slices.Delete(c.Groups[gi].Environment, ei, ei+1)
+	if len(c.Groups[gi].Environment) == 0 {
+		c.Groups = slices.Delete(c.Groups, gi, gi+1)
+	}
+}
+
+// prune removes empty environments and groups and returns them as group or group/environment
+func (c *Config) prune() []string {
+	var removed []string
+	for gi := len(c.Groups) - 1; gi >= 0; gi-- {
+		group := &c.Groups[gi]
+		for ei := len(group.Environment) - 1; ei >= 0; ei-- {
+			if len(group.Environment[ei].Servers) == 0 {
+				removed = append(removed, group.Name+"/"+group.Environment[ei].Name)
+				group.Environment = slices.Delete(group.Environment, ei, ei+1)
+			}
+		}
+		if len(group.Environment) == 0 {
+			removed = append(removed, group.Name)
+			c.Groups = slices.Delete(c.Groups, gi, gi+1)
+		}
+	}
+	return removed
+}
@@ -0,0 +1,236 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SystemLayers is the pattern of the system-wide inventory files, read below every other layer
+var SystemLayers = "/etc/ssm/*.yaml"
+
+// Layers returns the inventory files layered below the personal inventory, lowest precedence first:
+// the files matching SystemLayers, the `layers` listed in .ssm.yaml and the shared file of an overlay
+// storage. Patterns are expanded in lexical order; a listed file that does not exist is an error.
+func (c *Config) Layers() ([]string, error) {
+	var patterns []string
+	if SystemLayers != "" {
+		patterns = append(patterns, SystemLayers)
+	}
+	patterns = append(patterns, c.LayerPaths...)
+	if s := c.Storage(); s.Type == StorageOverlay {
+		patterns = append(patterns, s.Path)
+	}
+
+	personal, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	var layers []string
+	for _, pattern := range patterns {
+		pattern, err := expandHome(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("invalid layer pattern %q: %w", pattern, err)
+			}
+		} else if _, err := os.Stat(pattern); err != nil {
+			return nil, fmt.Errorf("inventory layer: %w", err)
+		}
+		for _, path := range matches {
+			// The personal inventory is always the top layer and never read twice
+			if path != personal && !slices.Contains(layers, path) {
+				layers = append(layers, path)
+			}
+		}
+	}
+	return layers, nil
+}
+
+// writableRepository is a Repository whose writes can be checked against its own servers while they are locked
+type writableRepository interface {
+	Repository
+	update(fn func(c *Config) error) error
+}
+
+// layeredRepository merges read-only inventory layers, such as a system-wide or team file, with the
+// personal inventory. Servers are matched by alias, or by hostname when they have no alias, within the
+// same group and environment; a later layer replaces the servers of the layers before it and the
+// personal inventory replaces them all. Writes only go to the personal inventory: deleting or moving a
+// server that is defined in a layer alone fails with ErrReadOnly, and servers can not be added next to
+// a layer server with the same hostname, IP or alias (ErrDuplicate). Upserting such a server copies it
+// into the personal inventory, where it overrides the layer. Environments declared by a layer are
+// available in addition to the personal declarations, which take precedence.
+type layeredRepository struct {
+	layers   []string
+	personal writableRepository
+}
+
+// layerConfig reads and merges all layers, recording in each server the file it came from
+func (r *layeredRepository) layerConfig() (*Config, error) {
+	merged := &Config{}
+	for _, path := range r.layers {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inventory layer: %w", err)
+		}
+		c, _, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid inventory layer %s: %w", path, err)
+		}
+		for gi := range c.Groups {
+			for ei := range c.Groups[gi].Environment {
+				for si := range c.Groups[gi].Environment[ei].Servers {
+					c.Groups[gi].Environment[ei].Servers[si].Source = path
+				}
+			}
+		}
+		merged.Environments = mergeEnvironments(merged.Environments, c.Environments)
+		merged.Groups = mergeGroups(merged.Groups, c.Groups)
+	}
+	return merged, nil
+}
+
+// layerGroups returns the merged groups of all layers
+func (r *layeredRepository) layerGroups() ([]Group, error) {
+	c, err := r.layerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return c.Groups, nil
+}
+
+func (r *layeredRepository) Load() (*Config, error) {
+	c, err := r.personal.Load()
+	if err != nil {
+		return nil, err
+	}
+	layers, err := r.layerConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers.Environments) > 0 {
+		c.Environments = mergeEnvironments(layers.Environments, c.EnvironmentDefs())
+	}
+	c.Groups = mergeGroups(layers.Groups, c.Groups)
+	return c, nil
+}
+
+func (r *layeredRepository) Get(alias string, within ServerLocation) (Entry, error) {
+	c, err := r.Load()
+	if err != nil {
+		return Entry{}, err
+	}
+	return c.Find(alias, within)
+}
+
+func (r *layeredRepository) List(filter Filter) ([]Entry, error) {
+	c, err := r.Load()
+	if err != nil {
+		return nil, err
+	}
+	return c.Entries(filter), nil
+}
+
+// checkLayers fails with ErrDuplicate when server clashes with a layer server at the given location.
+// When replace is set, the layer server with the same alias is not a clash since server overrides it.
+func checkLayers(layers []Group, at ServerLocation, server Server, replace bool) error {
+	others := sharedServers(layers, at)
+	if i := indexOf(others, server.Alias, server.HostName); replace && i >= 0 {
+		others = slices.Delete(slices.Clone(others), i, i+1)
+	}
+	for _, other := range others {
+		if checkDuplicateServer(server, []Server{other}) {
+			return fmt.Errorf("%w: a server with the same hostname, IP or alias already exists in %s of %s", ErrDuplicate, at, other.Source)
+		}
+	}
+	return nil
+}
+
+// checkWritable fails with ErrReadOnly when the server is only defined in a layer
+func checkWritable(layers []Group, c *Config, at ServerLocation, alias, hostname string) error {
+	if gi, ei := c.locate(at); ei >= 0 && indexOf(c.Groups[gi].Environment[ei].Servers, alias, hostname) >= 0 {
+		return nil
+	}
+	shared := sharedServers(layers, at)
+	if i := indexOf(shared, alias, hostname); i >= 0 {
+		return fmt.Errorf("%w: %s in %s is defined in the inventory layer %s", ErrReadOnly, cmp.Or(alias, hostname), at, shared[i].Source)
+	}
+	return nil
+}
+
+func (r *layeredRepository) Add(at ServerLocation, server Server) error {
+	layers, err := r.layerGroups()
+	if err != nil {
+		return err
+	}
+	// Adding never replaces a layer server
+	if err := checkLayers(layers, at, server, false); err != nil {
+		return err
+	}
+	return r.personal.Add(at, server)
+}
+
+func (r *layeredRepository) Upsert(at ServerLocation, server Server) error {
+	layers, err := r.layerGroups()
+	if err != nil {
+		return err
+	}
+	if err := checkLayers(layers, at, server, true); err != nil {
+		return err
+	}
+	return r.personal.Upsert(at, server)
+}
+
+func (r *layeredRepository) Delete(entries ...Entry) error {
+	layers, err := r.layerGroups()
+	if err != nil {
+		return err
+	}
+	return r.personal.update(func(c *Config) error {
+		for _, e := range entries {
+			if err := checkWritable(layers, c, e.ServerLocation, e.Server.Alias, e.Server.HostName); err != nil {
+				return err
+			}
+		}
+		return c.deleteServers(entries)
+	})
+}
+
+func (r *layeredRepository) Move(alias string, from, to ServerLocation, server Server) error {
+	layers, err := r.layerGroups()
+	if err != nil {
+		return err
+	}
+	return writeServer(r.personal.update, server, func(c *Config, ips hostIPs) error {
+		if err := checkWritable(layers, c, from, alias, ""); err != nil {
+			return err
+		}
+		if err := checkLayers(layers, to, server, true); err != nil {
+			return err
+		}
+		return c.moveServer(alias, from, to, server, ips)
+	})
+}
+
+func (r *layeredRepository) Prune() ([]string, error) {
+	return r.personal.Prune()
+}
+
+// mergeEnvironments lays the environments declared by a higher layer over the ones below. The
+// declarations of the higher layer come first and win; environments only declared below are appended.
+func mergeEnvironments(lower, upper []EnvironmentDef) []EnvironmentDef {
+	merged := slices.Clone(upper)
+	for _, d := range lower {
+		if !slices.ContainsFunc(merged, func(m EnvironmentDef) bool { return m.Name == d.Name }) {
+			merged = append(merged, d)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayeredInventoryPrecedence(t *testing.T) {
+	path := setupConfig(t)
+	home := filepath.Dir(path)
+	system := filepath.Join(home, "etc")
+	if err := os.Mkdir(system, 0700); err != nil {
+		t.Fatal(err)
+	}
+	SystemLayers = filepath.Join(system, "*.yaml")
+	team := filepath.Join(home, "team.yaml")
+	files := map[string]string{
+		filepath.Join(system, "base.yaml"): `groups:
+  - name: web
+    environment:
+      - name: dev
+        servers:
+          - {hostname: web1, ip: 10.0.0.1, alias: w1, user: system}
+          - {hostname: web9, ip: 10.0.0.9, alias: w9, user: system}
+`,
+		team: `environments:
+  - name: staging
+groups:
+  - name: web
+    environment:
+      - name: dev
+        servers:
+          - {hostname: web1, ip: 10.0.0.1, alias: w1, user: team}
+  - name: api
+    environment:
+      - name: staging
+        servers:
+          - {hostname: api1, ip: 10.0.2.1, alias: a1, user: team}
+`,
+		path: `version: 2
+layers:
+  - ~/team.yaml
+groups:
+  - name: web
+    environment:
+      - name: dev
+        servers:
+          - {hostname: web1, ip: 10.0.0.1, alias: w1, user: me}
+`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := repo.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, e := range entries {
+		got[e.Server.Alias] = e.Server.User + "@" + e.Server.Source
+	}
+	want := map[string]string{
+		"w1": "me@",
+		"w9": "system@" + filepath.Join(system, "base.yaml"),
+		"a1": "team@" + team,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for alias, w := range want {
+		if got[alias] != w {
+			t.Errorf("%s: expected %s, got %s", alias, w, got[alias])
+		}
+	}
+
+	dev := ServerLocation{Group: "web", Environment: "dev"}
+	if err := repo.Delete(Entry{dev, Server{HostName: "web9", Alias: "w9"}}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly deleting a system server, got %v", err)
+	}
+	if err := repo.Add(dev, Server{HostName: "web2", IP: "10.0.0.2", Alias: "w2", User: "me"}); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting the personal override uncovers the team server
+	if err := repo.Delete(Entry{dev, Server{HostName: "web1", Alias: "w1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := repo.Get("w1", dev); err != nil || e.Server.User != "team" {
+		t.Errorf("expected the team server after deleting the override, got %+v, %v", e, err)
+	}
+
+	personal := string(mustRead(t, path))
+	if !strings.Contains(personal, "w2") || strings.Contains(personal, "w9") || strings.Contains(personal, "a1") {
+		t.Errorf("expected only personal servers in .ssm.yaml, got:\n%s", personal)
+	}
+	if c, err := repo.Load(); err != nil || c.CheckEnvironment("staging") != nil {
+		t.Errorf("expected the environments of the team layer to be declared, got %v", err)
+	}
+
+	if err := os.Remove(team); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(); err == nil {
+		t.Error("expected a missing layer to fail")
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const localSettingsFileName = "local.yaml"
+
+// Credential stores understood by LocalSettings.CredentialStore
+const (
+	CredentialKeyring = "keyring"
+	CredentialVault   = "vault"
+)
+
+// CredentialStores are the allowed values of LocalSettings.CredentialStore
+var CredentialStores = []string{CredentialKeyring, CredentialVault}
+
+// LocalSettings are the settings of this machine, kept in ~/.ssm/local.yaml. Unlike the settings of
+// .ssm.yaml they are never synchronised.
+type LocalSettings struct {
+	// CredentialStore is where new credentials are stored: keyring (default) or vault
+	CredentialStore string `yaml:"credentialStore,omitempty"`
+	// VaultTimeout is how long the vault stays unlocked, e.g. 30m, DefaultVaultTimeout when empty
+	VaultTimeout string `yaml:"vaultTimeout,omitempty"`
+	// TrustedCommands are the cmd: credentials confirmed on this machine, as they are run, see Trusts
+	TrustedCommands []string `yaml:"trustedCommands,omitempty"`
+}
+
+// localSettingsPath returns the path of local.yaml
+func localSettingsPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, localSettingsFileName), nil
+}
+
+// LoadLocalSettings reads the settings of this machine, empty ones when there are none
+func LoadLocalSettings() (LocalSettings, error) {
+	var s LocalSettings
+	path, err := localSettingsPath()
+	if err != nil {
+		return s, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if _, err := s.Timeout(); err != nil {
+		return s, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	if s.CredentialStore != "" && !slices.Contains(CredentialStores, s.CredentialStore) {
+		return s, fmt.Errorf("invalid %s: unknown credentialStore %q, allowed values are: %s", path, s.CredentialStore, strings.Join(CredentialStores, ", "))
+	}
+	return s, nil
+}
+
+// SaveLocalSettings writes the settings of this machine. Nothing is written in dry-run mode.
+func SaveLocalSettings(s LocalSettings) error {
+	if DryRun {
+		return nil
+	}
+	path, err := localSettingsPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// Store returns the credential store of this machine
+func (s LocalSettings) Store() string {
+	if s.CredentialStore == "" {
+		return CredentialKeyring
+	}
+	return s.CredentialStore
+}
+
+// Timeout returns how long the vault stays unlocked
+func (s LocalSettings) Timeout() (time.Duration, error) {
+	if s.VaultTimeout == "" {
+		return DefaultVaultTimeout, nil
+	}
+	d, err := time.ParseDuration(s.VaultTimeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid vaultTimeout %q, expected a duration such as 30m", s.VaultTimeout)
+	}
+	return d, nil
+}
+
+// Trusts reports whether command, the expanded key of a cmd: credential, was confirmed on this machine.
+// Commands may come from configurations written elsewhere, synchronised or shared ones, so they are only
+// run once trusted.
+func (s LocalSettings) Trusts(command string) bool {
+	return slices.Contains(s.TrustedCommands, command)
+}
+
+// TrustCommand records command as trusted on this machine
+func TrustCommand(command string) error {
+	s, err := LoadLocalSettings()
+	if err != nil {
+		return err
+	}
+	if s.Trusts(command) {
+		return nil
+	}
+	s.TrustedCommands = append(s.TrustedCommands, command)
+	return SaveLocalSettings(s)
+}
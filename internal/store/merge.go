@@ -0,0 +1,314 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MergeConflict is a server changed differently on both sides of a three-way merge
+type MergeConflict struct {
+	Location ServerLocation
+	// Server is the alias of the server, or its hostname when it has no alias
+	Server string
+	// Field is the .ssm.yaml name of the conflicting field, empty when one side deleted the server
+	// and the other changed it
+	Field string
+	// Local and Remote describe the value on each side
+	Local  string
+	Remote string
+}
+
+func (c MergeConflict) String() string {
+	if c.Field == "" {
+		return fmt.Sprintf("%s/%s", c.Location, c.Server)
+	}
+	return fmt.Sprintf("%s/%s %s", c.Location, c.Server, c.Field)
+}
+
+// MergeResolver decides a conflict, returning true to take the remote side
+type MergeResolver func(conflict MergeConflict) (bool, error)
+
+// serverKey identifies a server across the versions of a merge, the same way mergeGroups matches them
+type serverKey struct {
+	ServerLocation
+	alias    string
+	hostname string
+}
+
+func keyOf(at ServerLocation, s Server) serverKey {
+	if s.Alias != "" {
+		return serverKey{ServerLocation: at, alias: s.Alias}
+	}
+	return serverKey{ServerLocation: at, hostname: s.HostName}
+}
+
+// indexServers returns the servers of c by key, and the keys in inventory order
+func indexServers(c *Config) (map[serverKey]Server, []serverKey) {
+	servers := make(map[serverKey]Server)
+	var order []serverKey
+	if c == nil {
+		return servers, nil
+	}
+	for _, g := range c.Groups {
+		for _, env := range g.Environment {
+			for _, s := range env.Servers {
+				key := keyOf(ServerLocation{Group: g.Name, Environment: env.Name}, s)
+				if _, ok := servers[key]; !ok {
+					order = append(order, key)
+				}
+				servers[key] = s
+			}
+		}
+	}
+	return servers, order
+}
+
+// MergeConfigs merges the servers of local and remote, two versions of the configuration that both
+// changed since base. Servers are matched by group, environment and alias (or hostname), so servers
+// added on either side are kept. A server changed on one side only takes that change, and a server
+// changed on both sides is merged field by field. Fields changed differently on both sides, and
+// servers deleted on one side but changed on the other, are passed to resolve. base may be nil when
+// there is no common version, in which case every difference is a conflict.
+//
+// Groups and environments are kept when they are on both sides or were added on one, and dropped when
+// one side deleted them, unless they still hold servers after the merge.
+//
+// The settings outside groups are taken from local, with the environments of both sides declared.
+func MergeConfigs(base, local, remote *Config, resolve MergeResolver) (*Config, error) {
+	baseServers, _ := indexServers(base)
+	localServers, localOrder := indexServers(local)
+	remoteServers, remoteOrder := indexServers(remote)
+
+	merged := *local
+	if len(local.Environments) > 0 && len(remote.Environments) > 0 {
+		merged.Environments = mergeEnvironments(remote.Environments, local.Environments)
+	}
+	// Take the groups and environments of both sides, even empty ones, fill them in below and drop the
+	// deleted ones at the end
+	merged.Groups = nil
+	for _, c := range []*Config{local, remote} {
+		for _, g := range c.Groups {
+			for _, env := range g.Environment {
+				gi, ei := merged.locate(ServerLocation{Group: g.Name, Environment: env.Name})
+				switch {
+				case gi < 0:
+					merged.Groups = append(merged.Groups, Group{Name: g.Name, User: g.User, Environment: []Env{{Name: env.Name}}})
+				case ei < 0:
+					merged.Groups[gi].Environment = append(merged.Groups[gi].Environment, Env{Name: env.Name})
+				}
+			}
+			if gi, _ := merged.locate(ServerLocation{Group: g.Name}); gi < 0 {
+				merged.Groups = append(merged.Groups, Group{Name: g.Name, User: g.User})
+			}
+		}
+	}
+
+	order := localOrder
+	for _, key := range remoteOrder {
+		if _, ok := localServers[key]; !ok {
+			order = append(order, key)
+		}
+	}
+	for _, key := range order {
+		b, inBase := baseServers[key]
+		l, inLocal := localServers[key]
+		r, inRemote := remoteServers[key]
+
+		var (
+			s    Server
+			keep = true
+			err  error
+		)
+		switch {
+		case inLocal && inRemote:
+			s, err = mergeServer(key, b, l, r, inBase, resolve)
+		case inLocal && !inBase:
+			s = l
+		case inRemote && !inBase:
+			s = r
+		case inLocal:
+			// Deleted remotely: follow the deletion unless the server changed locally
+			s, keep, err = mergeDeletion(key, b, l, false, resolve)
+		default:
+			s, keep, err = mergeDeletion(key, b, r, true, resolve)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !keep {
+			continue
+		}
+		gi, ei := merged.locate(key.ServerLocation)
+		merged.Groups[gi].Environment[ei].Servers = append(merged.Groups[gi].Environment[ei].Servers, s)
+	}
+
+	baseAt, localAt, remoteAt := locations(base), locations(local), locations(remote)
+	deleted := func(at ServerLocation) bool {
+		return baseAt[at] && !(localAt[at] && remoteAt[at])
+	}
+	groups := merged.Groups[:0]
+	for _, g := range merged.Groups {
+		envs := g.Environment[:0]
+		for _, env := range g.Environment {
+			if len(env.Servers) > 0 || !deleted(ServerLocation{Group: g.Name, Environment: env.Name}) {
+				envs = append(envs, env)
+			}
+		}
+		g.Environment = envs
+		if len(g.Environment) > 0 || !deleted(ServerLocation{Group: g.Name}) {
+			groups = append(groups, g)
+		}
+	}
+	merged.Groups = groups
+	return &merged, nil
+}
+
+// locations returns the groups of c, with an empty Environment, and their environments
+func locations(c *Config) map[ServerLocation]bool {
+	at := make(map[ServerLocation]bool)
+	if c == nil {
+		return at
+	}
+	for _, g := range c.Groups {
+		at[ServerLocation{Group: g.Name}] = true
+		for _, env := range g.Environment {
+			at[ServerLocation{Group: g.Name, Environment: env.Name}] = true
+		}
+	}
+	return at
+}
+
+// mergeDeletion handles a server still in base that one side deleted. changed is the version of the
+// side that kept it, remote tells which side that is. It reports whether the server is kept.
+func mergeDeletion(key serverKey, base, changed Server, remote bool, resolve MergeResolver) (Server, bool, error) {
+	if sameServer(base, changed) {
+		return changed, false, nil
+	}
+	conflict := MergeConflict{Location: key.ServerLocation, Server: key.alias + key.hostname, Local: "changed", Remote: "deleted"}
+	if remote {
+		conflict.Local, conflict.Remote = conflict.Remote, conflict.Local
+	}
+	useRemote, err := resolve(conflict)
+	if err != nil {
+		return Server{}, false, err
+	}
+	// Keep the server when the side that changed it wins
+	return changed, useRemote == remote, nil
+}
+
+// mergeServer merges the local and remote versions of a server, field by field when both changed it
+func mergeServer(key serverKey, base, local, remote Server, inBase bool, resolve MergeResolver) (Server, error) {
+	switch {
+	case sameServer(local, remote):
+		return local, nil
+	case inBase && sameServer(local, base):
+		return remote, nil
+	case inBase && sameServer(remote, base):
+		return local, nil
+	}
+
+	merged := local
+	mv, bv, lv, rv := reflect.ValueOf(&merged).Elem(), reflect.ValueOf(base), reflect.ValueOf(local), reflect.ValueOf(remote)
+	t := mv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := yamlName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		l, r, b := lv.Field(i).Interface(), rv.Field(i).Interface(), bv.Field(i).Interface()
+		switch {
+		case reflect.DeepEqual(l, r), inBase && reflect.DeepEqual(r, b):
+			continue
+		case inBase && reflect.DeepEqual(l, b):
+			mv.Field(i).Set(rv.Field(i))
+			continue
+		}
+		useRemote, err := resolve(MergeConflict{
+			Location: key.ServerLocation,
+			Server:   key.alias + key.hostname,
+			Field:    name,
+			Local:    formatField(name, l),
+			Remote:   formatField(name, r),
+		})
+		if err != nil {
+			return Server{}, err
+		}
+		if useRemote {
+			mv.Field(i).Set(rv.Field(i))
+		}
+	}
+	return merged, nil
+}
+
+// sameServer compares the stored fields of two servers
+func sameServer(a, b Server) bool {
+	a.Source, b.Source = "", ""
+	return reflect.DeepEqual(a, b)
+}
+
+// yamlName returns the .ssm.yaml name of a struct field, empty for fields that are not stored
+func yamlName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+// formatField renders a field value for a conflict prompt, hiding passwords
+func formatField(name string, value any) string {
+	if reflect.ValueOf(value).IsZero() {
+		return "(empty)"
+	}
+	switch v := value.(type) {
+	case string:
+		if name == "password" {
+			return "(hidden)"
+		}
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case map[string]string:
+		pairs := make([]string, 0, len(v))
+		for key, value := range v {
+			pairs = append(pairs, key+"="+value)
+		}
+		slices.Sort(pairs)
+		return strings.Join(pairs, ", ")
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
+
+// MergeConfigFiles merges three versions of .ssm.yaml with MergeConfigs and returns the merged file.
+// An empty base means there is no common version.
+func MergeConfigFiles(base, local, remote []byte, resolve MergeResolver) ([]byte, error) {
+	var b *Config
+	if len(base) > 0 {
+		c, _, err := Parse(base)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base configuration: %w", err)
+		}
+		b = c
+	}
+	l, _, err := Parse(local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local configuration: %w", err)
+	}
+	r, _, err := Parse(remote)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote configuration: %w", err)
+	}
+	merged, err := MergeConfigs(b, l, r, resolve)
+	if err != nil {
+		return nil, err
+	}
+	return encodeConfig(merged)
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the schema version written to .ssm.yaml by this build
+const CurrentVersion = 2
+
+// migration upgrades a configuration document from version `from` to `from+1`
+type migration struct {
+	from        int
+	description string
+	apply       func(root *yaml.Node) error
+}
+
+// migrations are applied in order to bring older files up to CurrentVersion
+var migrations = []migration{
+	{
+		from:        0,
+		description: "normalise key casing written by older versions and inherit group level users",
+		apply:       migrateV0ToV1,
+	},
+	{
+		from:        1,
+		description: "declare the environments in use, which used to be hard-coded",
+		apply:       migrateV1ToV2,
+	},
+}
+
+// Parse strictly decodes a configuration document, upgrading it to CurrentVersion first.
+// Unknown keys are reported together with their line number instead of being dropped.
+// The returned flag tells whether a migration was applied and the file should be rewritten.
+func Parse(data []byte) (*Config, bool, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &Config{Version: CurrentVersion}, false, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, false, err
+	}
+	if len(doc.Content) == 0 {
+		return &Config{Version: CurrentVersion}, false, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, false, fmt.Errorf("line %d: configuration must be a mapping", root.Line)
+	}
+
+	version := 0
+	if v := mappingValue(root, "version"); v != nil {
+		n, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return nil, false, fmt.Errorf("line %d: invalid version %q", v.Line, v.Value)
+		}
+		version = n
+	}
+	if version > CurrentVersion {
+		return nil, false, fmt.Errorf("configuration version %d is newer than the supported version %d, please update ssm", version, CurrentVersion)
+	}
+
+	migrated := false
+	for _, m := range migrations {
+		if m.from < version {
+			continue
+		}
+		if err := m.apply(root); err != nil {
+			return nil, false, fmt.Errorf("failed to migrate configuration from version %d: %w", m.from, err)
+		}
+		version = m.from + 1
+		setMappingValue(root, "version", strconv.Itoa(version), "!!int")
+		migrated = true
+	}
+
+	// Unknown keys are checked on the document itself, rather than through a strict decoder, so that the
+	// reported lines match the file even after a migration rewrote parts of it
+	if err := checkKnownFields(root, reflect.TypeOf(Config{})); err != nil {
+		return nil, false, err
+	}
+	var c Config
+	if err := root.Decode(&c); err != nil {
+		return nil, false, err
+	}
+	if c.StorageConfig != nil {
+		if _, err := checkStorage(*c.StorageConfig); err != nil {
+			return nil, false, fmt.Errorf("storage: %w", err)
+		}
+	}
+	if c.Sync != nil {
+		if err := checkSync(*c.Sync); err != nil {
+			return nil, false, fmt.Errorf("sync: %w", err)
+		}
+	}
+	return &c, migrated, nil
+}
+
+// checkKnownFields reports every mapping key that does not correspond to a field of t, with its line
+func checkKnownFields(node *yaml.Node, t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var errs []error
+	switch {
+	case node.Kind == yaml.SequenceNode && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+		for _, item := range node.Content {
+			errs = append(errs, checkKnownFields(item, t.Elem()))
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Map:
+		for i := 1; i < len(node.Content); i += 2 {
+			errs = append(errs, checkKnownFields(node.Content[i], t.Elem()))
+		}
+	case node.Kind == yaml.MappingNode && t.Kind() == reflect.Struct:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			field, ok := fields[key.Value]
+			if !ok {
+				errs = append(errs, fmt.Errorf("line %d: field %s not found in type %s", key.Line, key.Value, t))
+				continue
+			}
+			errs = append(errs, checkKnownFields(node.Content[i+1], field))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// yamlFields maps the yaml key of each exported field of struct type t to the field type
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// migrateV0ToV1 renames lower cased keys such as `isrdp` that older versions wrote through viper,
+// and copies the group level `user` into servers that do not set their own
+func migrateV0ToV1(root *yaml.Node) error {
+	renameKeys(root, map[string]string{
+		"isrdp":        "isRDP",
+		"keyrotatedat": "keyRotatedAt",
+	})
+
+	groups := mappingValue(root, "groups")
+	if groups == nil || groups.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, group := range groups.Content {
+		user := mappingValue(group, "user")
+		if user == nil || user.Value == "" {
+			continue
+		}
+		environments := mappingValue(group, "environment")
+		if environments == nil {
+			continue
+		}
+		for _, env := range environments.Content {
+			servers := mappingValue(env, "servers")
+			if servers == nil {
+				continue
+			}
+			for _, server := range servers.Content {
+				if v := mappingValue(server, "user"); v == nil || v.Value == "" {
+					setMappingValue(server, "user", user.Value, "!!str")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// migrateV1ToV2 declares the environments that used to be built in, followed by any other environment
+// names already in use so that existing files remain valid. Environments were never protected before,
+// so none is declared protected: users turn protection on themselves.
+func migrateV1ToV2(root *yaml.Node) error {
+	if mappingValue(root, "environments") != nil {
+		return nil
+	}
+	defs := slices.Clone(DefaultEnvironments)
+	for i := range defs {
+		defs[i].Protected = false
+	}
+	if groups := mappingValue(root, "groups"); groups != nil {
+		for _, group := range groups.Content {
+			environments := mappingValue(group, "environment")
+			if environments == nil {
+				continue
+			}
+			for _, env := range environments.Content {
+				name := mappingValue(env, "name")
+				if name == nil || name.Value == "" || slices.ContainsFunc(defs, func(d EnvironmentDef) bool { return d.Name == name.Value }) {
+					continue
+				}
+				defs = append(defs, EnvironmentDef{Name: name.Value})
+			}
+		}
+	}
+
+	var node yaml.Node
+	if err := node.Encode(defs); err != nil {
+		return err
+	}
+	// Place the declarations right after the version so they are read before the groups using them
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "environments"}
+	at := 0
+	if len(root.Content) >= 2 && root.Content[0].Value == "version" {
+		at = 2
+	}
+	root.Content = slices.Insert(root.Content, at, key, &node)
+	return nil
+}
+
+// mappingValue returns the value node stored under key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets a scalar value under key, appending the key when it is missing.
+// A missing `version` key is inserted first so that it heads the file.
+func setMappingValue(node *yaml.Node, key, value, tag string) {
+	if v := mappingValue(node, key); v != nil {
+		v.Kind, v.Tag, v.Value = yaml.ScalarNode, tag, value
+		return
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	if key == "version" {
+		node.Content = append([]*yaml.Node{k, v}, node.Content...)
+		return
+	}
+	node.Content = append(node.Content, k, v)
+}
+
+// renameKeys recursively renames mapping keys according to names
+func renameKeys(node *yaml.Node, names map[string]string) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if name, ok := names[node.Content[i].Value]; ok {
+				node.Content[i].Value = name
+			}
+		}
+	}
+	for _, child := range node.Content {
+		renameKeys(child, names)
+	}
+}
@@ -3,13 +3,20 @@ package store
 import "time"
 
 type Server struct {
-	HostName     string    `yaml:"hostname"`
-	IP           string    `yaml:"ip"`
-	Alias        string    `yaml:"alias"`
-	User         string    `yaml:"user"`
-	Password     string    `yaml:"password,omitempty"`
-	IsRDP        bool      `yaml:"isRDP,omitempty"`
-	KeyRotatedAt time.Time `yaml:"keyRotatedAt,omitempty"`
+	HostName string `yaml:"hostname"`
+	IP       string `yaml:"ip"`
+	Alias    string `yaml:"alias"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password,omitempty"`
+	// Credential names the secret of the server as <scheme>:<key>, see CredentialRef
+	Credential   string            `yaml:"credential,omitempty"`
+	IsRDP        bool              `yaml:"isRDP,omitempty"`
+	KeyRotatedAt time.Time         `yaml:"keyRotatedAt,omitempty"`
+	Tags         []string          `yaml:"tags,omitempty"`
+	Labels       map[string]string `yaml:"labels,omitempty"`
+	// Source is the inventory layer the server was read from, empty for the personal inventory.
+	// It is never stored.
+	Source string `yaml:"-" json:"-"`
 }
 
 type Env struct {
@@ -19,9 +26,15 @@ type Env struct {
 
 type Group struct {
 	Name        string `yaml:"name"`
+	User        string `yaml:"user,omitempty"`
 	Environment []Env  `yaml:"environment"`
 }
 
 type Config struct {
-	Groups []Group `yaml:"groups"`
+	Version       int              `yaml:"version"`
+	Environments  []EnvironmentDef `yaml:"environments,omitempty"`
+	StorageConfig *StorageConfig   `yaml:"storage,omitempty"`
+	LayerPaths    []string         `yaml:"layers,omitempty"`
+	Sync          *SyncConfig      `yaml:"sync,omitempty"`
+	Groups        []Group          `yaml:"groups"`
 }
@@ -0,0 +1,128 @@
+package store
+
+import "errors"
+
+// Errors reported by repositories. They are wrapped with details and can be matched with errors.Is.
+var (
+	ErrNotFound  = errors.New("server not found")
+	ErrDuplicate = errors.New("duplicate server")
+	ErrAmbiguous = errors.New("ambiguous alias")
+)
+
+// ServerLocation identifies where a server lives in the inventory
+type ServerLocation struct {
+	Group       string
+	Environment string
+}
+
+func (l ServerLocation) String() string {
+	return l.Group + "/" + l.Environment
+}
+
+// Entry is a server together with the group and environment it belongs to
+type Entry struct {
+	ServerLocation
+	Server Server
+}
+
+// Filter narrows List down to a group, an environment and the servers matching a selector.
+// Empty fields match everything.
+type Filter struct {
+	Group       string
+	Environment string
+	Selector    Selector
+}
+
+// Repository is the typed API to the server inventory.
+//
+// Servers are identified by their alias within a group and environment; servers without an alias
+// are identified by their hostname. Writes are validated: environments must be declared, hostname
+// and user are required, and an environment cannot hold two servers with the same hostname, IP
+// or alias (ErrDuplicate). The IP is resolved from the hostname when it is empty or the hostname changes.
+type Repository interface {
+	// Load returns the whole configuration
+	Load() (*Config, error)
+	// Get returns the server with the given alias; within optionally narrows the search down to a group
+	// and environment. ErrNotFound and ErrAmbiguous report no or several matches.
+	Get(alias string, within ServerLocation) (Entry, error)
+	// List returns the servers matching filter. Within each group, environments are listed in the order
+	// they are declared in.
+	List(filter Filter) ([]Entry, error)
+	// Add stores a new server at the given location and never replaces an existing one
+	Add(at ServerLocation, server Server) error
+	// Upsert stores server at the given location, replacing the server with the same alias there
+	Upsert(at ServerLocation, server Server) error
+	// Delete removes the given servers in one write, dropping environments and groups left empty
+	Delete(entries ...Entry) error
+	// Move replaces the server with the given alias at from by server and places it at to. from and to
+	// may be the same, which changes the server in place, e.g. to rename it.
+	Move(alias string, from, to ServerLocation, server Server) error
+	// Prune removes empty environments and groups and returns them as group or group/environment
+	Prune() ([]string, error)
+}
+
+// fileRepository keeps the inventory in the active configuration file. Every write goes through Update,
+// so it is locked, snapshotted, atomic and honours DryRun.
+type fileRepository struct{}
+
+// NewFileRepository returns a Repository backed by the active configuration file
+func NewFileRepository() Repository {
+	return fileRepository{}
+}
+
+func (fileRepository) update(fn func(c *Config) error) error {
+	return Update(fn)
+}
+
+func (fileRepository) Load() (*Config, error) {
+	return Load()
+}
+
+func (fileRepository) Get(alias string, within ServerLocation) (Entry, error) {
+	c, err := Load()
+	if err != nil {
+		return Entry{}, err
+	}
+	return c.Find(alias, within)
+}
+
+func (fileRepository) List(filter Filter) ([]Entry, error) {
+	c, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return c.Entries(filter), nil
+}
+
+func (fileRepository) Add(at ServerLocation, server Server) error {
+	return writeServer(Update, server, func(c *Config, ips hostIPs) error {
+		return c.insertServer(at, server, ips)
+	})
+}
+
+func (fileRepository) Upsert(at ServerLocation, server Server) error {
+	return writeServer(Update, server, func(c *Config, ips hostIPs) error {
+		return c.upsertServer(at, server, ips)
+	})
+}
+
+func (fileRepository) Delete(entries ...Entry) error {
+	return Update(func(c *Config) error {
+		return c.deleteServers(entries)
+	})
+}
+
+func (fileRepository) Move(alias string, from, to ServerLocation, server Server) error {
+	return writeServer(Update, server, func(c *Config, ips hostIPs) error {
+		return c.moveServer(alias, from, to, server, ips)
+	})
+}
+
+func (fileRepository) Prune() ([]string, error) {
+	var removed []string
+	err := Update(func(c *Config) error {
+		removed = c.prune()
+		return nil
+	})
+	return removed, err
+}
@@ -1,20 +1,15 @@
 package store
 
 import (
+	"fmt"
 	"net"
 
 	"github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
-func Save(group, environment, host, user, alias, password string, isRDP bool) {
-	var c Config
-	err := viper.Unmarshal(&c)
-	if err != nil {
-		logrus.Errorf("Error reading configuration: %v", err)
-		return
-	}
-
+// addServer appends server to the given group and environment, creating them when missing.
+// ErrDuplicate is returned when the environment already holds a server with the same hostname, IP or alias.
+func addServer(c *Config, group, environment string, server Server) error {
 	doesGroupExist := false
 	doesEnvironmentExist := false
 	groupIndex := -1
@@ -35,15 +30,6 @@ func Save(group, environment, host, user, alias, password string, isRDP bool) {
 		}
 	}
 
-	server := Server{
-		HostName: host,
-		IP:       getIP(host),
-		Alias:    alias,
-		User:     user,
-		IsRDP:    isRDP,
-		Password: password,
-	}
-
 	env := Env{
 		Name:    environment,
 		Servers: []Server{server},
@@ -54,31 +40,18 @@ func Save(group, environment, host, user, alias, password string, isRDP bool) {
 			Environment: []Env{env},
 		}
 		c.Groups = append(c.Groups, newGroup)
-		groupIndex = len(c.Groups) - 1
-
 	} else {
 		if !doesEnvironmentExist {
-			newEnv := Env{
-				Name:    environment,
-				Servers: []Server{server},
-			}
-			c.Groups[groupIndex].Environment = append(c.Groups[groupIndex].Environment, newEnv)
-			environmentIndex = len(c.Groups[groupIndex].Environment) - 1
+			c.Groups[groupIndex].Environment = append(c.Groups[groupIndex].Environment, env)
 		} else {
 			isDuplicate := checkDuplicateServer(server, c.Groups[groupIndex].Environment[environmentIndex].Servers)
 			if isDuplicate {
-				logrus.Println("Duplicate server found in group")
-			} else {
-				c.Groups[groupIndex].Environment[environmentIndex].Servers = append(c.Groups[groupIndex].Environment[environmentIndex].Servers, server)
+				return fmt.Errorf("%w: a server with the same hostname, IP or alias already exists in %s/%s", ErrDuplicate, group, environment)
 			}
+			c.Groups[groupIndex].Environment[environmentIndex].Servers = append(c.Groups[groupIndex].Environment[environmentIndex].Servers, server)
 		}
 	}
-
-	viper.Set("groups", c.Groups)
-	err = viper.WriteConfig()
-	if err != nil {
-		logrus.Errorf("Error writing config: %v", err)
-	}
+	return nil
 }
 
 func checkDuplicateServer(s Server, servers []Server) bool {
@@ -90,7 +63,9 @@ func checkDuplicateServer(s Server, servers []Server) bool {
 	return false
 }
 
-func getIP(host string) string {
+// ResolveIP returns the IP of host, or host itself when it cannot be resolved, as the repositories
+// do for servers stored without an IP
+func ResolveIP(host string) string {
 	lookupHost, err := net.LookupHost(host)
 	if err != nil || len(lookupHost) == 0 {
 		logrus.Debugf("Could not resolve IP from hostname %s, using hostname as IP", host)
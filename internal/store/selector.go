@@ -0,0 +1,209 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+// requirement is a single comma separated term of a selector
+type requirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+// Selector matches servers by their tags, labels and location in the configuration.
+//
+// A selector is a comma separated list of terms that must all match:
+//
+//	role=db        label role equals db
+//	region!=eu     label region is missing or differs from eu
+//	primary        server has the tag primary or a label with key primary
+//	!deprecated    server has neither the tag nor a label deprecated
+//
+// The keys group, env, alias, host, ip, user and type (ssh or rdp) refer to the server itself,
+// and tag=name is equivalent to the bare term name.
+type Selector struct {
+	requirements []requirement
+}
+
+// ParseSelector parses a selector such as "role=db,env=prod,!deprecated"
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var r requirement
+		switch {
+		case strings.Contains(term, "!="):
+			key, value, _ := strings.Cut(term, "!=")
+			r = requirement{key: strings.TrimSpace(key), op: opNotEquals, value: strings.TrimSpace(value)}
+		case strings.Contains(term, "="):
+			key, value, _ := strings.Cut(term, "=")
+			r = requirement{key: strings.TrimSpace(key), op: opEquals, value: strings.TrimSpace(value)}
+		case strings.HasPrefix(term, "!"):
+			r = requirement{key: strings.TrimSpace(term[1:]), op: opNotExists}
+		default:
+			r = requirement{key: term, op: opExists}
+		}
+		if r.key == "" || strings.ContainsAny(r.key, "=! ") || strings.ContainsAny(r.value, "=!") {
+			return Selector{}, fmt.Errorf("invalid selector term %q", term)
+		}
+		if r.key == "tag" && (r.op == opEquals || r.op == opNotEquals) {
+			if r.value == "" {
+				return Selector{}, fmt.Errorf("invalid selector term %q: tag name is empty", term)
+			}
+			r.key, r.value = r.value, ""
+			if r.op == opEquals {
+				r.op = opExists
+			} else {
+				r.op = opNotExists
+			}
+		}
+		sel.requirements = append(sel.requirements, r)
+	}
+	return sel, nil
+}
+
+// Empty reports whether the selector has no terms and therefore matches every server
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Matches reports whether server, located in group and environment, satisfies every term
+func (s Selector) Matches(group, environment string, server Server) bool {
+	for _, r := range s.requirements {
+		if !r.matches(group, environment, server) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r requirement) matches(group, environment string, server Server) bool {
+	switch r.op {
+	case opExists:
+		_, ok := server.Labels[r.key]
+		return ok || slices.Contains(server.Tags, r.key)
+	case opNotExists:
+		_, ok := server.Labels[r.key]
+		return !ok && !slices.Contains(server.Tags, r.key)
+	}
+
+	value, ok := builtinValue(r.key, group, environment, server)
+	if !ok {
+		value, ok = server.Labels[r.key]
+	}
+	if r.op == opEquals {
+		return ok && value == r.value
+	}
+	return !ok || value != r.value
+}
+
+// builtinValue resolves the keys that describe the server itself rather than a label
+func builtinValue(key, group, environment string, server Server) (string, bool) {
+	switch key {
+	case "group":
+		return group, true
+	case "env", "environment":
+		return environment, true
+	case "alias":
+		return server.Alias, true
+	case "host", "hostname":
+		return server.HostName, true
+	case "ip":
+		return server.IP, true
+	case "user":
+		return server.User, true
+	case "type":
+		if server.IsRDP {
+			return "rdp", true
+		}
+		return "ssh", true
+	}
+	return "", false
+}
+
+// ParseTags checks tags given on the command line and removes duplicates
+func ParseTags(tags []string) ([]string, error) {
+	var result []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if err := checkTag(tag); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+// ParseLabels converts key=value pairs, as given on the command line, into a label map
+func ParseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := checkLabel(key, value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// checkTag rejects tags that could not be expressed in a selector
+func checkTag(tag string) error {
+	if tag == "" || strings.ContainsAny(tag, ",!= \t") {
+		return fmt.Errorf("invalid tag %q: tags must be non-empty and cannot contain spaces or any of ',!='", tag)
+	}
+	return nil
+}
+
+// checkLabel rejects labels that could not be expressed in a selector or that shadow a built-in key
+func checkLabel(key, value string) error {
+	if key == "" || strings.ContainsAny(key, ",!= \t") || strings.ContainsAny(value, ",!=") {
+		return fmt.Errorf("invalid label %s=%s: keys must be non-empty and cannot contain spaces or any of ',!=', values cannot contain ',!='", key, value)
+	}
+	if _, reserved := builtinValue(key, "", "", Server{}); reserved || key == "tag" {
+		return fmt.Errorf("invalid label %s=%s: %s is a reserved selector key", key, value, key)
+	}
+	return nil
+}
+
+// String returns the selector in its canonical comma separated form
+func (s Selector) String() string {
+	terms := make([]string, len(s.requirements))
+	for i, r := range s.requirements {
+		switch r.op {
+		case opEquals:
+			terms[i] = r.key + "=" + r.value
+		case opNotEquals:
+			terms[i] = r.key + "!=" + r.value
+		case opExists:
+			terms[i] = r.key
+		case opNotExists:
+			terms[i] = "!" + r.key
+		}
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,416 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Storage types understood by Open
+const (
+	StorageYAML    = "yaml"
+	StorageDir     = "dir"
+	StorageOverlay = "overlay"
+	StorageBolt    = "bolt"
+)
+
+// StorageTypes lists the storage types in the order they are documented in
+var StorageTypes = []string{StorageYAML, StorageDir, StorageOverlay, StorageBolt}
+
+// ErrReadOnly is returned when a write targets servers that the storage cannot change
+var ErrReadOnly = errors.New("read-only")
+
+// StorageConfig selects where the servers are kept. The settings in .ssm.yaml, such as the declared
+// environments, always stay in .ssm.yaml.
+//
+//	yaml     the groups section of .ssm.yaml (default)
+//	dir      one YAML file per group in the directory at path
+//	overlay  the shared file at path, read-only, merged with the groups of .ssm.yaml
+//	bolt     an embedded bbolt database at path
+type StorageConfig struct {
+	Type string `yaml:"type"`
+	Path string `yaml:"path,omitempty"`
+}
+
+func (s StorageConfig) String() string {
+	if s.Path == "" {
+		return s.Type
+	}
+	return s.Type + " " + s.Path
+}
+
+// storageOverride is set by Init when --config points at a directory or database instead of a YAML file
+var storageOverride *StorageConfig
+
+// Storage returns the storage in use, taking a --config override into account
+func (c *Config) Storage() StorageConfig {
+	switch {
+	case storageOverride != nil:
+		return *storageOverride
+	case c.StorageConfig != nil:
+		return *c.StorageConfig
+	}
+	return StorageConfig{Type: StorageYAML}
+}
+
+// checkStorage validates a storage configuration and expands ~ in its path
+func checkStorage(s StorageConfig) (StorageConfig, error) {
+	if !slices.Contains(StorageTypes, s.Type) {
+		return s, fmt.Errorf("unknown storage type %q, allowed values are: %s", s.Type, strings.Join(StorageTypes, ", "))
+	}
+	if s.Type == StorageYAML {
+		return StorageConfig{Type: StorageYAML}, nil
+	}
+	if s.Path == "" {
+		return s, fmt.Errorf("storage type %q needs a path", s.Type)
+	}
+	path, err := expandHome(s.Path)
+	if err != nil {
+		return s, err
+	}
+	s.Path = path
+	return s, nil
+}
+
+// expandHome replaces a leading ~/ in path by the home directory
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path, err
+	}
+	return filepath.Join(home, path[2:]), nil
+}
+
+// Open returns the Repository for the storage selected in .ssm.yaml or with --config, with the
+// inventory layers of the configuration merged below it
+func Open() (Repository, error) {
+	c, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	s, err := checkStorage(c.Storage())
+	if err != nil {
+		return nil, err
+	}
+	layers, err := c.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) == 0 {
+		return personalRepository(s), nil
+	}
+	return &layeredRepository{layers: layers, personal: personalRepository(s)}, nil
+}
+
+// FallbackRepository returns the Repository to use when Open fails with err. When the servers are kept in
+// the configuration file, or it cannot be read to tell, that is the file repository, which reports the
+// same error to commands that need servers while commands such as edit and restore can still repair the
+// file. Servers kept in another storage are never written to the configuration file instead: every call
+// then reports err.
+func FallbackRepository(err error) Repository {
+	if storageOverride == nil {
+		if c, loadErr := Load(); loadErr != nil || c.Storage().Type == StorageYAML {
+			return fileRepository{}
+		}
+	}
+	return unavailableRepository{err: err}
+}
+
+// unavailableRepository is the inventory of a storage that cannot be opened
+type unavailableRepository struct {
+	err error
+}
+
+func (r unavailableRepository) Load() (*Config, error) {
+	return nil, r.err
+}
+
+func (r unavailableRepository) Get(string, ServerLocation) (Entry, error) {
+	return Entry{}, r.err
+}
+
+func (r unavailableRepository) List(Filter) ([]Entry, error) {
+	return nil, r.err
+}
+
+func (r unavailableRepository) Add(ServerLocation, Server) error {
+	return r.err
+}
+
+func (r unavailableRepository) Upsert(ServerLocation, Server) error {
+	return r.err
+}
+
+func (r unavailableRepository) Delete(...Entry) error {
+	return r.err
+}
+
+func (r unavailableRepository) Move(string, ServerLocation, ServerLocation, Server) error {
+	return r.err
+}
+
+func (r unavailableRepository) Prune() ([]string, error) {
+	return nil, r.err
+}
+
+// OpenStorage returns the Repository for the given storage
+func OpenStorage(s StorageConfig) (Repository, error) {
+	s, err := checkStorage(s)
+	if err != nil {
+		return nil, err
+	}
+	if s.Type == StorageOverlay {
+		return newOverlayRepository(s.Path), nil
+	}
+	return personalRepository(s), nil
+}
+
+// personalRepository returns the writable Repository of a checked storage, without any layers
+func personalRepository(s StorageConfig) writableRepository {
+	switch s.Type {
+	case StorageDir, StorageBolt:
+		return &backendRepository{backend: backendFor(s)}
+	}
+	return fileRepository{}
+}
+
+// backendFor returns the Backend of a checked dir or bolt storage
+func backendFor(s StorageConfig) Backend {
+	if s.Type == StorageBolt {
+		return boltBackend{path: s.Path}
+	}
+	return dirBackend{dir: s.Path}
+}
+
+// MigrateStorage copies all servers from the storage in use to the storage to and selects it in .ssm.yaml.
+// The target must be empty. The groups section of .ssm.yaml is emptied when moving to a dir or bolt
+// storage, and an old dir or bolt storage is left in place. Migrating away from an overlay copies the
+// merged servers.
+func MigrateStorage(to StorageConfig) error {
+	target, err := checkStorage(to)
+	if err != nil {
+		return err
+	}
+	if target.Type == StorageOverlay {
+		return fmt.Errorf("the overlay storage is read-only and cannot be migrated to")
+	}
+
+	settings, err := Load()
+	if err != nil {
+		return err
+	}
+	current, err := checkStorage(settings.Storage())
+	if err != nil {
+		return err
+	}
+	if current == target {
+		return fmt.Errorf("already using %s storage", target)
+	}
+	from, err := OpenStorage(current)
+	if err != nil {
+		return err
+	}
+	c, err := from.Load()
+	if err != nil {
+		return err
+	}
+	groups := c.Groups
+
+	if target.Type == StorageYAML {
+		return Update(func(c *Config) error {
+			c.StorageConfig = nil
+			c.Groups = groups
+			return nil
+		})
+	}
+
+	backend := backendFor(target)
+	existing, err := backend.ReadGroups()
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("%s already holds %d group(s), migrate to an empty location", backend, len(existing))
+	}
+	if DryRun {
+		after, err := encodeGroups(groups)
+		if err != nil {
+			return err
+		}
+		PrintDiff(backend.String(), nil, after)
+	} else {
+		unlock, err := backend.Lock()
+		if err != nil {
+			return err
+		}
+		err = backend.WriteGroups(groups)
+		unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return Update(func(c *Config) error {
+		c.StorageConfig = &StorageConfig{Type: to.Type, Path: to.Path}
+		c.Groups = nil
+		return nil
+	})
+}
+
+// Backend keeps the groups of the inventory outside of .ssm.yaml
+type Backend interface {
+	// String describes the backend in messages and dry-run diffs
+	String() string
+	// Lock takes an exclusive lock on the storage and returns a function releasing it
+	Lock() (func(), error)
+	// ReadGroups returns all groups
+	ReadGroups() ([]Group, error)
+	// WriteGroups replaces all groups
+	WriteGroups(groups []Group) error
+	// Paths returns the files snapshotted to ~/.ssm/backups before every write
+	Paths() ([]string, error)
+}
+
+// backendRepository implements Repository on top of a Backend, with the settings, such as the declared
+// environments, read from .ssm.yaml. Writes are locked, snapshotted and honour DryRun like Update.
+type backendRepository struct {
+	backend Backend
+	// dryRunGroups holds the in-memory groups in dry-run mode so that successive mutations build on each other
+	dryRunGroups []Group
+}
+
+func (r *backendRepository) readGroups() ([]Group, error) {
+	if DryRun && r.dryRunGroups != nil {
+		return cloneGroups(r.dryRunGroups), nil
+	}
+	return r.backend.ReadGroups()
+}
+
+func (r *backendRepository) Load() (*Config, error) {
+	c, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if c.Groups, err = r.readGroups(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// update applies fn to the latest configuration and writes the resulting groups to the backend
+func (r *backendRepository) update(fn func(c *Config) error) error {
+	// Settings are loaded first, Load may take the write lock itself to upgrade .ssm.yaml
+	c, err := Load()
+	if err != nil {
+		return err
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	unlock, err := r.backend.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if c.Groups, err = r.readGroups(); err != nil {
+		return err
+	}
+	before, err := encodeGroups(c.Groups)
+	if err != nil {
+		return err
+	}
+	if err := fn(c); err != nil {
+		return err
+	}
+	after, err := encodeGroups(c.Groups)
+	if err != nil {
+		return err
+	}
+
+	if DryRun {
+		PrintDiff(r.backend.String(), before, after)
+		r.dryRunGroups = c.Groups
+		return nil
+	}
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	paths, err := r.backend.Paths()
+	if err != nil {
+		return err
+	}
+	if _, err := Snapshot("update", paths...); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", r.backend, err)
+	}
+	return r.backend.WriteGroups(c.Groups)
+}
+
+func (r *backendRepository) Get(alias string, within ServerLocation) (Entry, error) {
+	c, err := r.Load()
+	if err != nil {
+		return Entry{}, err
+	}
+	return c.Find(alias, within)
+}
+
+func (r *backendRepository) List(filter Filter) ([]Entry, error) {
+	c, err := r.Load()
+	if err != nil {
+		return nil, err
+	}
+	return c.Entries(filter), nil
+}
+
+func (r *backendRepository) Add(at ServerLocation, server Server) error {
+	return writeServer(r.update, server, func(c *Config, ips hostIPs) error {
+		return c.insertServer(at, server, ips)
+	})
+}
+
+func (r *backendRepository) Upsert(at ServerLocation, server Server) error {
+	return writeServer(r.update, server, func(c *Config, ips hostIPs) error {
+		return c.upsertServer(at, server, ips)
+	})
+}
+
+func (r *backendRepository) Delete(entries ...Entry) error {
+	return r.update(func(c *Config) error {
+		return c.deleteServers(entries)
+	})
+}
+
+func (r *backendRepository) Move(alias string, from, to ServerLocation, server Server) error {
+	return writeServer(r.update, server, func(c *Config, ips hostIPs) error {
+		return c.moveServer(alias, from, to, server, ips)
+	})
+}
+
+func (r *backendRepository) Prune() ([]string, error) {
+	var removed []string
+	err := r.update(func(c *Config) error {
+		removed = c.prune()
+		return nil
+	})
+	return removed, err
+}
+
+// encodeGroups renders groups the way they appear in .ssm.yaml, for dry-run diffs and change detection
+func encodeGroups(groups []Group) ([]byte, error) {
+	data, err := yaml.Marshal(struct {
+		Groups []Group `yaml:"groups"`
+	}{groups})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render groups: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// groupsBucket holds one JSON encoded Group per key, keyed by group name
+var groupsBucket = []byte("groups")
+
+// boltBackend keeps the groups in an embedded bbolt database, for fleets too large to edit by hand.
+// Groups are listed in name order.
+type boltBackend struct {
+	path string
+}
+
+func (b boltBackend) String() string {
+	return "database " + b.path
+}
+
+func (b boltBackend) Lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(b.path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(b.path), err)
+	}
+	return lockConfig(b.path)
+}
+
+func (b boltBackend) Paths() ([]string, error) {
+	return []string{b.path}, nil
+}
+
+// open opens the database, waiting a little for other processes holding it
+func (b boltBackend) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(b.path, 0600, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", b.path, err)
+	}
+	return db, nil
+}
+
+func (b boltBackend) ReadGroups() ([]Group, error) {
+	if _, err := os.Stat(b.path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	db, err := b.open(true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var groups []Group
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(groupsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var g Group
+			if err := json.Unmarshal(v, &g); err != nil {
+				return fmt.Errorf("invalid group %s: %w", k, err)
+			}
+			groups = append(groups, g)
+			return nil
+		})
+	})
+	return groups, err
+}
+
+func (b boltBackend) WriteGroups(groups []Group) error {
+	db, err := b.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(groupsBucket) != nil {
+			if err := tx.DeleteBucket(groupsBucket); err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket(groupsBucket)
+		if err != nil {
+			return err
+		}
+		for _, g := range groups {
+			data, err := json.Marshal(g)
+			if err != nil {
+				return fmt.Errorf("failed to encode group %s: %w", g.Name, err)
+			}
+			if err := bucket.Put([]byte(g.Name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
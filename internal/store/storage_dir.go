@@ -0,0 +1,112 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dirBackend keeps every group in its own YAML file, <dir>/<group>.yaml, so that teams can own
+// their file in git. Only files whose content changed are rewritten.
+type dirBackend struct {
+	dir string
+}
+
+func (b dirBackend) String() string {
+	return "directory " + b.dir
+}
+
+func (b dirBackend) Lock() (func(), error) {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", b.dir, err)
+	}
+	return lockConfig(filepath.Join(b.dir, ".ssm"))
+}
+
+// groupFile returns the file holding the named group
+func (b dirBackend) groupFile(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("group name %q cannot be used as a file name in %s", name, b.dir)
+	}
+	return filepath.Join(b.dir, name+".yaml"), nil
+}
+
+func (b dirBackend) Paths() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(b.dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (b dirBackend) ReadGroups() ([]Group, error) {
+	paths, err := b.Paths()
+	if err != nil {
+		return nil, err
+	}
+	var groups []Group
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		var g Group
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&g); err != nil {
+			return nil, fmt.Errorf("invalid group file %s: %w", path, err)
+		}
+		if g.Name == "" {
+			g.Name = strings.TrimSuffix(filepath.Base(path), ".yaml")
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func (b dirBackend) WriteGroups(groups []Group) error {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", b.dir, err)
+	}
+	keep := make(map[string]bool)
+	for _, g := range groups {
+		path, err := b.groupFile(g.Name)
+		if err != nil {
+			return err
+		}
+		keep[path] = true
+		data, err := yaml.Marshal(g)
+		if err != nil {
+			return fmt.Errorf("failed to render group %s: %w", g.Name, err)
+		}
+		if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return err
+		}
+	}
+
+	// Groups that no longer exist lose their file
+	paths, err := b.Paths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if !keep[path] {
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
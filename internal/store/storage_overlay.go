@@ -0,0 +1,66 @@
+package store
+
+import "slices"
+
+// overlayRepository merges a shared team file, which is never written, with the groups of .ssm.yaml.
+// It is the layered repository with the shared file as its only layer: a server in .ssm.yaml replaces
+// the server with the same alias in the same group and environment of the shared file, writes go to
+// .ssm.yaml, and deleting or moving a server that only exists in the shared file fails with ErrReadOnly.
+type overlayRepository struct {
+	*layeredRepository
+}
+
+// newOverlayRepository returns the overlay of .ssm.yaml over the shared file
+func newOverlayRepository(shared string) overlayRepository {
+	return overlayRepository{&layeredRepository{layers: []string{shared}, personal: fileRepository{}}}
+}
+
+// sharedServers returns the servers of the layer groups at the given location
+func sharedServers(groups []Group, at ServerLocation) []Server {
+	c := Config{Groups: groups}
+	if gi, ei := c.locate(at); ei >= 0 {
+		return groups[gi].Environment[ei].Servers
+	}
+	return nil
+}
+
+// mergeGroups lays the groups of a higher layer over the ones below. Servers are matched by alias, or by
+// hostname when they have no alias, within the same group and environment.
+func mergeGroups(lower, upper []Group) []Group {
+	merged := Config{Groups: cloneGroups(lower)}
+	for _, g := range upper {
+		for _, env := range g.Environment {
+			at := ServerLocation{Group: g.Name, Environment: env.Name}
+			gi, ei := merged.locate(at)
+			switch {
+			case gi < 0:
+				merged.Groups = append(merged.Groups, Group{Name: g.Name, User: g.User, Environment: []Env{{Name: env.Name, Servers: slices.Clone(env.Servers)}}})
+				continue
+			case ei < 0:
+				merged.Groups[gi].Environment = append(merged.Groups[gi].Environment, Env{Name: env.Name, Servers: slices.Clone(env.Servers)})
+				continue
+			}
+			target := &merged.Groups[gi].Environment[ei]
+			for _, s := range env.Servers {
+				if i := indexOf(target.Servers, s.Alias, s.HostName); i >= 0 {
+					target.Servers[i] = s
+				} else {
+					target.Servers = append(target.Servers, s)
+				}
+			}
+		}
+	}
+	return merged.Groups
+}
+
+// cloneGroups copies groups deep enough for their server lists to be changed
+func cloneGroups(groups []Group) []Group {
+	clone := slices.Clone(groups)
+	for gi := range clone {
+		clone[gi].Environment = slices.Clone(clone[gi].Environment)
+		for ei := range clone[gi].Environment {
+			clone[gi].Environment[ei].Servers = slices.Clone(clone[gi].Environment[ei].Servers)
+		}
+	}
+	return clone
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackendRepositories(t *testing.T) {
+	for _, storage := range []string{StorageDir, StorageBolt} {
+		t.Run(storage, func(t *testing.T) {
+			path := setupConfig(t)
+			location := filepath.Join(filepath.Dir(path), "inventory")
+			if storage == StorageBolt {
+				location += ".db"
+			}
+			repo, err := OpenStorage(StorageConfig{Type: storage, Path: location})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			web := ServerLocation{Group: "web", Environment: "dev"}
+			db := ServerLocation{Group: "db", Environment: "prod"}
+			if err := repo.Add(web, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w1", User: "root"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Add(db, Server{HostName: "db1", IP: "10.0.1.1", Alias: "d1", User: "root"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Add(web, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w2", User: "root"}); !errors.Is(err, ErrDuplicate) {
+				t.Errorf("expected ErrDuplicate, got %v", err)
+			}
+			if err := repo.Move("d1", db, web, Server{HostName: "db1", IP: "10.0.1.1", Alias: "d1", User: "postgres"}); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := repo.List(Filter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 2 || entries[1].Server.User != "postgres" || entries[1].ServerLocation != web {
+				t.Fatalf("unexpected entries: %+v", entries)
+			}
+
+			// .ssm.yaml only holds the settings
+			c, _, err := Parse(mustRead(t, path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(c.Groups) != 0 {
+				t.Errorf("expected no groups in .ssm.yaml, got %+v", c.Groups)
+			}
+			if storage == StorageDir {
+				files, _ := filepath.Glob(filepath.Join(location, "*.yaml"))
+				if len(files) != 1 || filepath.Base(files[0]) != "web.yaml" {
+					t.Errorf("expected only web.yaml once db was emptied, got %v", files)
+				}
+			}
+		})
+	}
+}
+
+func TestOverlayRepositoryKeepsSharedFileReadOnly(t *testing.T) {
+	path := setupConfig(t)
+	shared := filepath.Join(filepath.Dir(path), "team.yaml")
+	sharedData := []byte(`groups:
+  - name: web
+    environment:
+      - name: dev
+        servers:
+          - hostname: web1
+            ip: 10.0.0.1
+            alias: w1
+            user: ops
+          - hostname: web2
+            ip: 10.0.0.2
+            alias: w2
+            user: ops
+`)
+	if err := os.WriteFile(shared, sharedData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := OpenStorage(StorageConfig{Type: StorageOverlay, Path: shared})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev := ServerLocation{Group: "web", Environment: "dev"}
+
+	// A personal server with the same alias overrides the shared one
+	if err := repo.Upsert(dev, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w1", User: "me"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(dev, Server{HostName: "web2", Alias: "other", User: "me"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate for a shared hostname, got %v", err)
+	}
+	if err := repo.Delete(Entry{dev, Server{HostName: "web2", Alias: "w2"}}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly deleting a shared server, got %v", err)
+	}
+	if err := repo.Move("w2", dev, dev, Server{HostName: "web2", Alias: "renamed", User: "ops"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly moving a shared server, got %v", err)
+	}
+
+	entries, err := repo.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Server.User != "me" || entries[1].Server.User != "ops" {
+		t.Fatalf("unexpected merged entries: %+v", entries)
+	}
+	if got := mustRead(t, shared); string(got) != string(sharedData) {
+		t.Errorf("shared file was modified: %s", got)
+	}
+}
+
+func TestMigrateStorage(t *testing.T) {
+	path := setupConfig(t)
+	repo, err := Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Add(ServerLocation{Group: "web", Environment: "dev"}, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w1", User: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(filepath.Dir(path), "inventory")
+
+	if err := MigrateStorage(StorageConfig{Type: StorageDir, Path: dir}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Storage() != (StorageConfig{Type: StorageDir, Path: dir}) || len(c.Groups) != 0 {
+		t.Fatalf("expected .ssm.yaml to select the dir storage without groups, got %+v", c)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "web.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateStorage(StorageConfig{Type: StorageDir, Path: dir}); err == nil {
+		t.Error("expected migrating to the storage in use to fail")
+	}
+
+	if err := MigrateStorage(StorageConfig{Type: StorageYAML}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err = Load(); err != nil {
+		t.Fatal(err)
+	}
+	if c.StorageConfig != nil || len(c.Groups) != 1 || c.Groups[0].Environment[0].Servers[0].Alias != "w1" {
+		t.Fatalf("expected the servers back in .ssm.yaml, got %+v", c)
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFallbackRepositoryKeepsServersOutOfConfigFile(t *testing.T) {
+	path := setupConfig(t)
+	config := `version: 2
+storage:
+  type: dir
+  path: ~/inventory
+layers:
+  - ~/missing.yaml
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Open()
+	if err == nil {
+		t.Fatal("expected the missing layer to fail")
+	}
+	if err := FallbackRepository(err).Add(ServerLocation{Group: "web", Environment: "dev"}, Server{HostName: "web1", IP: "10.0.0.1", User: "root"}); err == nil {
+		t.Error("expected the server not to be added")
+	}
+	if data := mustRead(t, path); string(data) != config {
+		t.Errorf("expected .ssm.yaml unchanged, got:\n%s", data)
+	}
+
+	if err := os.WriteFile(path, []byte("version: 2\nlayers:\n  - ~/missing.yaml\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := FallbackRepository(err).(fileRepository); !ok {
+		t.Error("expected the file repository when servers are kept in .ssm.yaml")
+	}
+}
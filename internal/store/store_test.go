@@ -1,6 +1,7 @@
 package store
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -53,3 +54,205 @@ func TestCheckDuplicateServer(t *testing.T) {
 		t.Errorf("expected unique server to not be marked as duplicate")
 	}
 }
+
+func TestParseMigratesVersionZero(t *testing.T) {
+	legacy := `groups:
+    - name: atlanta
+      user: deploy
+      environment:
+        - name: dev
+          servers:
+            - hostname: web1
+              alias: w1
+              isrdp: true
+            - hostname: web2
+              alias: w2
+              user: root
+              keyrotatedat: 2024-05-01T10:00:00Z
+`
+	c, migrated, err := Parse([]byte(legacy))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !migrated {
+		t.Fatalf("expected version 0 file to be migrated")
+	}
+	if c.Version != CurrentVersion {
+		t.Errorf("expected version %d, got %d", CurrentVersion, c.Version)
+	}
+
+	servers := c.Groups[0].Environment[0].Servers
+	if c.Groups[0].User != "deploy" {
+		t.Errorf("expected group user to be kept, got %q", c.Groups[0].User)
+	}
+	if servers[0].User != "deploy" || !servers[0].IsRDP {
+		t.Errorf("expected web1 to inherit group user and keep isRDP, got %+v", servers[0])
+	}
+	if servers[1].User != "root" || servers[1].KeyRotatedAt.IsZero() {
+		t.Errorf("expected web2 to keep its user and rotation time, got %+v", servers[1])
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	config := `version: 1
+groups:
+    - name: atlanta
+      environment:
+        - name: dev
+          servers:
+            - hostnme: web1
+`
+	_, _, err := Parse([]byte(config))
+	if err == nil {
+		t.Fatalf("expected unknown key to be reported")
+	}
+	if !strings.Contains(err.Error(), "line 7") || !strings.Contains(err.Error(), "hostnme") {
+		t.Errorf("expected error to name the key and its line, got: %v", err)
+	}
+}
+
+func TestParseRejectsNewerVersion(t *testing.T) {
+	if _, _, err := Parse([]byte("version: 99\ngroups: []\n")); err == nil {
+		t.Fatalf("expected newer configuration version to be rejected")
+	}
+}
+
+func TestValidateAndDuplicateAliases(t *testing.T) {
+	c := &Config{Groups: []Group{
+		{Name: "web", Environment: []Env{{Name: "dev", Servers: []Server{{HostName: "a", User: "root", Alias: "app"}}}}},
+		{Name: "db", Environment: []Env{
+			{Name: "dev", Servers: []Server{{HostName: "b", User: "root", Alias: "app"}}},
+			{Name: "dev", Servers: []Server{{HostName: "", User: "root", Alias: "c"}}},
+		}},
+	}}
+
+	err := Validate(c)
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	if !strings.Contains(err.Error(), `environment "dev" is defined more than once`) || !strings.Contains(err.Error(), "has no hostname") {
+		t.Errorf("unexpected validation errors: %v", err)
+	}
+
+	duplicates := DuplicateAliases(c)
+	if len(duplicates) != 1 || len(duplicates["app"]) != 2 {
+		t.Errorf("expected alias app to be reported twice, got %v", duplicates)
+	}
+}
+
+func TestParseDeclaresEnvironmentsInUse(t *testing.T) {
+	// Migrated files keep their behaviour whatever the defaults of new files are
+	defaults := DefaultEnvironments
+	DefaultEnvironments = []EnvironmentDef{{Name: "dev"}, {Name: "staging"}, {Name: "prod", Protected: true}}
+	t.Cleanup(func() { DefaultEnvironments = defaults })
+
+	config := `version: 1
+groups:
+    - name: atlanta
+      environment:
+        - name: ppd
+          servers:
+            - hostname: web1
+              user: root
+        - name: prod
+          servers:
+            - hostname: web2
+              user: root
+`
+	c, migrated, err := Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !migrated || c.Version != CurrentVersion {
+		t.Fatalf("expected version 1 file to be migrated, got version %d", c.Version)
+	}
+	if got := strings.Join(c.EnvironmentNames(), ","); got != "dev,staging,prod,ppd" {
+		t.Errorf("expected default environments followed by ppd, got %s", got)
+	}
+	if def, _ := c.EnvironmentDef("prod"); def.Protected {
+		t.Errorf("expected prod to be migrated unprotected")
+	}
+	if err := Validate(c); err != nil {
+		t.Errorf("expected migrated configuration to be valid, got: %v", err)
+	}
+}
+
+func TestValidateRejectsUndeclaredEnvironments(t *testing.T) {
+	c := &Config{
+		Environments: []EnvironmentDef{{Name: "qa", Color: "#00ff00"}, {Name: "live", Color: "red"}, {Name: "qa"}},
+		Groups: []Group{
+			{Name: "web", Environment: []Env{{Name: "dev", Servers: []Server{{HostName: "a", User: "root"}}}}},
+		},
+	}
+	err := Validate(c)
+	if err == nil {
+		t.Fatalf("expected validation errors")
+	}
+	for _, want := range []string{`unknown environment "dev", allowed values are: qa, live, qa`, `invalid color "red"`, `environment "qa" is declared more than once`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in validation errors, got: %v", want, err)
+		}
+	}
+	if c.EnvironmentRank("live") != 1 || c.EnvironmentRank("dev") != 3 {
+		t.Errorf("unexpected environment ranks")
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	primary := Server{HostName: "pg1", Alias: "pg1", User: "postgres", Tags: []string{"postgres", "primary"}, Labels: map[string]string{"role": "db", "region": "us"}}
+	replica := Server{HostName: "pg2", Alias: "pg2", User: "postgres", Tags: []string{"postgres"}, Labels: map[string]string{"role": "db", "region": "eu"}}
+	web := Server{HostName: "web1", Alias: "web1", User: "root", IsRDP: true}
+
+	tests := []struct {
+		selector string
+		server   Server
+		env      string
+		want     bool
+	}{
+		{"", web, "dev", true},
+		{"role=db", primary, "prod", true},
+		{"role=db", web, "prod", false},
+		{"role=db,region!=eu", primary, "prod", true},
+		{"role=db,region!=eu", replica, "prod", false},
+		{"region!=eu", web, "prod", true},
+		{"postgres,primary,env=prod", primary, "prod", true},
+		{"postgres,primary,env=prod", primary, "dev", false},
+		{"postgres,!primary", replica, "prod", true},
+		{"tag=primary", replica, "prod", false},
+		{"tag!=primary", replica, "prod", true},
+		{"type=rdp,group=web", web, "dev", true},
+		{"alias=pg2, user=postgres", replica, "prod", true},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tt.selector, err)
+		}
+		if got := sel.Matches("web", tt.env, tt.server); got != tt.want {
+			t.Errorf("selector %q on %s in %s: got %v, want %v", tt.selector, tt.server.Alias, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectorRejectsMalformedTerms(t *testing.T) {
+	for _, s := range []string{"=db", "role=a=b", "!", "tag=", "role!=a!b"} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"role=db", "region = eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["role"] != "db" || labels["region"] != "eu" {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+	for _, bad := range []string{"role", "env=prod", "a,b=c"} {
+		if _, err := ParseLabels([]string{bad}); err == nil {
+			t.Errorf("expected label %q to be rejected", bad)
+		}
+	}
+}
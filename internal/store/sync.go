@@ -0,0 +1,207 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+)
+
+// Sync backends understood by OpenSync
+const (
+	SyncFirestore = "firestore"
+	SyncGit       = "git"
+	SyncDir       = "dir"
+	SyncS3        = "s3"
+)
+
+// SyncBackends lists the sync backends in the order they are documented in
+var SyncBackends = []string{SyncFirestore, SyncGit, SyncDir, SyncS3}
+
+// ErrNoSyncData is returned when nothing has been pushed yet
+var ErrNoSyncData = errors.New("no synchronised configuration found")
+
+// SyncConfig selects where ssm sync keeps the encrypted files
+//
+//	firestore  the SSM cloud, authenticated with --email (default)
+//	git        a commit per push in the git repository at git.remote
+//	dir        a file per push in the directory at dir.path, e.g. a NAS, Dropbox or USB mount
+//	s3         an object per push in an S3-compatible bucket
+type SyncConfig struct {
+	Backend string         `yaml:"backend,omitempty"`
+	Git     *GitSyncConfig `yaml:"git,omitempty"`
+	Dir     *DirSyncConfig `yaml:"dir,omitempty"`
+	S3      *S3SyncConfig  `yaml:"s3,omitempty"`
+	// Files changes which files are synchronised, see SyncFilesConfig
+	Files *SyncFilesConfig `yaml:"files,omitempty"`
+	// Passphrase encrypts the files of the firestore backend with a passphrase of their own instead of
+	// the account password. The other backends always use a passphrase.
+	Passphrase bool `yaml:"passphrase,omitempty"`
+}
+
+// GitSyncConfig configures the git sync backend
+type GitSyncConfig struct {
+	// Remote is any URL or path git can push to, e.g. git@github.com:me/ssm-sync.git or /mnt/usb/ssm.git
+	Remote string `yaml:"remote"`
+	// Branch defaults to main
+	Branch string `yaml:"branch,omitempty"`
+}
+
+// DirSyncConfig configures the directory sync backend
+type DirSyncConfig struct {
+	Path string `yaml:"path"`
+}
+
+// S3SyncConfig configures the S3-compatible sync backend. The credentials are read from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optional AWS_SESSION_TOKEN environment variables.
+type S3SyncConfig struct {
+	// Endpoint is the base URL of the service, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Endpoint string `yaml:"endpoint"`
+	Bucket   string `yaml:"bucket"`
+	// Region defaults to us-east-1
+	Region string `yaml:"region,omitempty"`
+	// Prefix is prepended to every object key, e.g. ssm/
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+// Payload is one push of the synchronised files
+type Payload struct {
+	// Files holds the encrypted files keyed by name, e.g. ssm_yaml or private
+	Files map[string]string `json:"files"`
+	// Hashes holds a keyed hash of the plaintext of each file, so that changes can be told apart
+	// without decrypting the files
+	Hashes map[string]string `json:"hashes,omitempty"`
+	// Revision counts the pushes; every push builds on the revision before it
+	Revision int `json:"revision,omitempty"`
+	// Host is the hostname of the machine that pushed
+	Host string `json:"host,omitempty"`
+	// Version is the version of ssm that pushed
+	Version string `json:"version,omitempty"`
+	// Envelope tells how the key encrypting the files is derived, nil for payloads encrypted with the
+	// version 1 key of earlier versions of ssm
+	Envelope *security.Envelope `json:"envelope,omitempty"`
+}
+
+// revision describes the push of p
+func (p Payload) revision(id string, t time.Time, message string) Revision {
+	return Revision{ID: id, Time: t, Message: message, Number: p.Revision, Host: p.Host, Version: p.Version, Hashes: p.Hashes}
+}
+
+// decodePayload reads a payload as JSON, accepting the flat map of encrypted files written by earlier versions
+func decodePayload(data []byte) (Payload, error) {
+	var p Payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, err
+	}
+	if p.Files == nil {
+		p = Payload{}
+		if err := json.Unmarshal(data, &p.Files); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// Revision is one pushed version of the synchronised files
+type Revision struct {
+	ID      string
+	Time    time.Time
+	Message string
+	// Number, Host, Version and Hashes are the ones of the pushed payload, empty for pushes of
+	// earlier versions of ssm
+	Number  int
+	Host    string
+	Version string
+	Hashes  map[string]string
+}
+
+// matchRevision returns the ID in ids that rev names: a full ID or any unique prefix of one
+func matchRevision(ids []string, rev string, where fmt.Stringer) (string, error) {
+	var matches []string
+	for _, candidate := range ids {
+		if strings.HasPrefix(candidate, rev) {
+			matches = append(matches, candidate)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return "", fmt.Errorf("revision %q not found in %s", rev, where)
+	case slices.Contains(matches, rev):
+		return rev, nil
+	case len(matches) > 1:
+		return "", fmt.Errorf("revision %q is ambiguous, it matches %s", rev, strings.Join(matches, ", "))
+	}
+	return matches[0], nil
+}
+
+// SyncBackend keeps the encrypted payloads pushed by ssm sync
+type SyncBackend interface {
+	// String describes the backend in messages
+	String() string
+	// StateKey identifies the backend, and the account on it, in the sync state of this machine, see
+	// LoadSyncState
+	StateKey() string
+	// Put stores payload as a new revision
+	Put(payload Payload, message string) (Revision, error)
+	// Get returns the payload of the given revision, or of the latest one when rev is empty.
+	// ErrNoSyncData is returned when nothing has been pushed yet.
+	Get(rev string) (Payload, error)
+	// List returns the stored revisions, newest first
+	List() ([]Revision, error)
+}
+
+// SyncSettings returns the sync configuration with its defaults applied
+func (c *Config) SyncSettings() SyncConfig {
+	s := SyncConfig{Backend: SyncFirestore}
+	if c.Sync != nil {
+		s = *c.Sync
+		if s.Backend == "" {
+			s.Backend = SyncFirestore
+		}
+	}
+	return s
+}
+
+// checkSync validates a sync configuration
+func checkSync(s SyncConfig) error {
+	switch {
+	case s.Backend != "" && !slices.Contains(SyncBackends, s.Backend):
+		return fmt.Errorf("unknown sync backend %q, allowed values are: %s", s.Backend, strings.Join(SyncBackends, ", "))
+	case s.Backend == SyncGit && (s.Git == nil || s.Git.Remote == ""):
+		return fmt.Errorf("sync backend %q needs git.remote", s.Backend)
+	case s.Backend == SyncDir && (s.Dir == nil || s.Dir.Path == ""):
+		return fmt.Errorf("sync backend %q needs dir.path", s.Backend)
+	case s.Backend == SyncS3 && (s.S3 == nil || s.S3.Endpoint == "" || s.S3.Bucket == ""):
+		return fmt.Errorf("sync backend %q needs s3.endpoint and s3.bucket", s.Backend)
+	}
+	_, err := s.SyncFiles()
+	return err
+}
+
+// OpenSync returns the sync backend selected by s. userID identifies the signed in user of the
+// firestore backend and is ignored by the others.
+func OpenSync(s SyncConfig, userID string) (SyncBackend, error) {
+	if err := checkSync(s); err != nil {
+		return nil, err
+	}
+	switch s.Backend {
+	case SyncGit:
+		return NewGitSync(*s.Git)
+	case SyncDir:
+		path, err := expandHome(s.Dir.Path)
+		if err != nil {
+			return nil, err
+		}
+		return &objectSync{store: dirObjects{dir: path}}, nil
+	case SyncS3:
+		return newS3Sync(*s.S3)
+	}
+	if userID == "" {
+		return nil, fmt.Errorf("the firestore sync backend needs a signed in user")
+	}
+	return firestoreSync{userID: userID}, nil
+}
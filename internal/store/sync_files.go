@@ -0,0 +1,135 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SyncFile is a file kept in sync, stored under Name in the payload
+type SyncFile struct {
+	Name string
+	// Path is relative to the home directory, with forward slashes
+	Path string
+	// Mode is the permissions the file is written with
+	Mode os.FileMode
+}
+
+// Sensitive reports whether the file is private to its owner, such as a private key. The contents of
+// sensitive files are never printed.
+func (f SyncFile) Sensitive() bool {
+	return f.Mode&0077 == 0
+}
+
+// DefaultSyncFiles are the files synchronised unless sync.files says otherwise
+var DefaultSyncFiles = []SyncFile{
+	{Name: "ssm_yaml", Path: ".ssm.yaml", Mode: 0644},
+	{Name: "public", Path: ".ssh/id_ed25519.pub", Mode: 0644},
+	{Name: "private", Path: ".ssh/id_ed25519", Mode: 0600},
+	{Name: "bashrc", Path: ".bashrc", Mode: 0644},
+	{Name: "zshrc", Path: ".zshrc", Mode: 0644},
+	{Name: "ssh_config", Path: ".ssh/config", Mode: 0644},
+	{Name: "tmux", Path: ".tmux.conf", Mode: 0644},
+	{Name: "vault", Path: ".ssm/vault.json", Mode: 0600},
+}
+
+// SyncFilesConfig changes the set of synchronised files
+//
+//	files:
+//	  exclude: [private]            # names or paths of default files to leave alone
+//	  include:
+//	    - path: ~/.gitconfig
+//	    - path: ~/.config/nvim/init.lua
+//	      mode: "0600"
+type SyncFilesConfig struct {
+	Include []SyncFileConfig `yaml:"include,omitempty"`
+	Exclude []string         `yaml:"exclude,omitempty"`
+}
+
+// SyncFileConfig adds a file to the synchronised files, or changes the mode of a default one
+type SyncFileConfig struct {
+	// Path is below the home directory, e.g. ~/.gitconfig
+	Path string `yaml:"path"`
+	// Name is the key of the file in the payload and defaults to its path below the home directory
+	Name string `yaml:"name,omitempty"`
+	// Mode is the octal permissions the file is written with on pull, 0644 by default
+	Mode string `yaml:"mode,omitempty"`
+}
+
+// homeRelative turns a path below the home directory, written as ~/file, file or the absolute path as
+// expanded by a shell, into the form of SyncFile.Path
+func homeRelative(p string) (string, error) {
+	rel := p
+	if home, err := os.UserHomeDir(); err == nil && filepath.IsAbs(p) {
+		if r, err := filepath.Rel(home, p); err == nil {
+			rel = r
+		}
+	}
+	rel = strings.TrimPrefix(strings.ReplaceAll(rel, `\`, "/"), "~/")
+	if rel == "" || path.IsAbs(rel) || strings.HasPrefix(rel, "~") || (len(rel) > 1 && rel[1] == ':') {
+		return "", fmt.Errorf("%q must be a path below the home directory, e.g. ~/.gitconfig", p)
+	}
+	rel = path.Clean(rel)
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%q must be a path below the home directory, e.g. ~/.gitconfig", p)
+	}
+	return rel, nil
+}
+
+// MatchSyncFile reports whether entry names f, by name or by path below the home directory
+func MatchSyncFile(f SyncFile, entry string) bool {
+	if entry == f.Name {
+		return true
+	}
+	rel, err := homeRelative(entry)
+	return err == nil && rel == f.Path
+}
+
+// SyncFiles returns the synchronised files: the DefaultSyncFiles without the excluded ones, followed
+// by the included ones
+func (s SyncConfig) SyncFiles() ([]SyncFile, error) {
+	files := slices.Clone(DefaultSyncFiles)
+	if s.Files == nil {
+		return files, nil
+	}
+	for _, c := range s.Files.Include {
+		rel, err := homeRelative(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("files.include: %w", err)
+		}
+		f := SyncFile{Name: c.Name, Path: rel, Mode: 0644}
+		if c.Mode != "" {
+			mode, err := strconv.ParseUint(c.Mode, 8, 32)
+			if err != nil || mode > 0777 {
+				return nil, fmt.Errorf("files.include: invalid mode %q of %s, expected octal permissions such as 0600", c.Mode, c.Path)
+			}
+			f.Mode = os.FileMode(mode)
+		}
+		if i := slices.IndexFunc(files, func(d SyncFile) bool { return d.Path == rel }); i >= 0 {
+			// A default file, only its mode can be changed
+			if c.Mode != "" {
+				files[i].Mode = f.Mode
+			}
+			continue
+		}
+		if f.Name == "" {
+			f.Name = rel
+		}
+		if slices.ContainsFunc(files, func(d SyncFile) bool { return d.Name == f.Name }) {
+			return nil, fmt.Errorf("files.include: name %q of %s is already used", f.Name, c.Path)
+		}
+		files = append(files, f)
+	}
+	for _, entry := range s.Files.Exclude {
+		i := slices.IndexFunc(files, func(f SyncFile) bool { return MatchSyncFile(f, entry) })
+		if i < 0 {
+			return nil, fmt.Errorf("files.exclude: %q is not a synchronised file", entry)
+		}
+		files = slices.Delete(files, i, i+1)
+	}
+	return files, nil
+}
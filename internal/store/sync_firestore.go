@@ -0,0 +1,182 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// firestoreSync keeps the latest payload in the configurations/<uid> document of the SSM cloud, and
+// every push in the revisions collection below it. Revision IDs are UTC timestamps like the ones of
+// the object stores.
+type firestoreSync struct {
+	userID string
+}
+
+// firestoreRevision is the ID of the document written by earlier versions of ssm, which kept
+// the latest push only
+const firestoreRevision = "latest"
+
+func (f firestoreSync) String() string {
+	return "the SSM cloud"
+}
+
+// StateKey keeps a state per account, as several may sign in on one machine. The state written by
+// earlier versions, under the description of the backend alone, is not used: it may be another account's.
+func (f firestoreSync) StateKey() string {
+	return "firestore " + f.userID
+}
+
+func (f firestoreSync) Put(payload Payload, message string) (Revision, error) {
+	if err := InitFirebaseOnce(); err != nil {
+		return Revision{}, err
+	}
+	client, err := App.Firestore(Ctx)
+	if err != nil {
+		return Revision{}, fmt.Errorf("error getting Firestore client: %w", err)
+	}
+	defer client.Close()
+
+	now := time.Now().UTC()
+	id := now.Format(syncRevisionIDFormat)
+	data := map[string]interface{}{
+		"files":    payload.Files,
+		"hashes":   payload.Hashes,
+		"revision": payload.Revision,
+		"host":     payload.Host,
+		"version":  payload.Version,
+		"time":     now,
+		"message":  message,
+	}
+	if payload.Envelope != nil {
+		envelope, err := json.Marshal(payload.Envelope)
+		if err != nil {
+			return Revision{}, err
+		}
+		data["envelope"] = string(envelope)
+	}
+	document := client.Collection("configurations").Doc(f.userID)
+	if _, err := document.Collection("revisions").Doc(id).Set(Ctx, data); err != nil {
+		return Revision{}, fmt.Errorf("error adding revision: %w", err)
+	}
+	if _, err := document.Set(Ctx, data); err != nil {
+		return Revision{}, fmt.Errorf("error adding configuration: %w", err)
+	}
+	return payload.revision(id, now, message), nil
+}
+
+// Get accepts a full revision ID or any unique prefix of one
+func (f firestoreSync) Get(rev string) (Payload, error) {
+	if err := InitFirebaseOnce(); err != nil {
+		return Payload{}, err
+	}
+	client, err := App.Firestore(Ctx)
+	if err != nil {
+		return Payload{}, fmt.Errorf("error getting Firestore client: %w", err)
+	}
+	defer client.Close()
+
+	document := client.Collection("configurations").Doc(f.userID)
+	if rev != "" && rev != firestoreRevision {
+		refs, err := document.Collection("revisions").DocumentRefs(Ctx).GetAll()
+		if err != nil {
+			return Payload{}, fmt.Errorf("error listing revisions: %w", err)
+		}
+		ids := make([]string, len(refs))
+		for i, ref := range refs {
+			ids[i] = ref.ID
+		}
+		id, err := matchRevision(ids, rev, f)
+		if err != nil {
+			return Payload{}, err
+		}
+		document = document.Collection("revisions").Doc(id)
+	}
+
+	snapshot, err := document.Get(Ctx)
+	if status.Code(err) == codes.NotFound || (err == nil && !snapshot.Exists()) {
+		return Payload{}, ErrNoSyncData
+	} else if err != nil {
+		return Payload{}, fmt.Errorf("error fetching configuration: %w", err)
+	}
+	return firestorePayload(snapshot.Data()), nil
+}
+
+// firestorePayload reads a payload from the fields of a document
+func firestorePayload(data map[string]interface{}) Payload {
+	files, ok := data["files"].(map[string]interface{})
+	if !ok {
+		// Earlier versions stored the encrypted files as the fields of the document
+		return Payload{Files: stringMap(data)}
+	}
+	payload := Payload{Files: stringMap(files)}
+	if hashes, ok := data["hashes"].(map[string]interface{}); ok {
+		payload.Hashes = stringMap(hashes)
+	}
+	if revision, ok := data["revision"].(int64); ok {
+		payload.Revision = int(revision)
+	}
+	payload.Host, _ = data["host"].(string)
+	payload.Version, _ = data["version"].(string)
+	if envelope, ok := data["envelope"].(string); ok {
+		var e security.Envelope
+		if json.Unmarshal([]byte(envelope), &e) == nil {
+			payload.Envelope = &e
+		}
+	}
+	return payload
+}
+
+// stringMap keeps the string values of a Firestore map
+func stringMap(m map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(m))
+	for key, value := range m {
+		if s, ok := value.(string); ok {
+			result[key] = s
+		}
+	}
+	return result
+}
+
+func (f firestoreSync) List() ([]Revision, error) {
+	if err := InitFirebaseOnce(); err != nil {
+		return nil, err
+	}
+	client, err := App.Firestore(Ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Firestore client: %w", err)
+	}
+	defer client.Close()
+
+	document := client.Collection("configurations").Doc(f.userID)
+	snapshots, err := document.Collection("revisions").Documents(Ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error listing revisions: %w", err)
+	}
+	var revisions []Revision
+	for _, snapshot := range snapshots {
+		data := snapshot.Data()
+		t, _ := data["time"].(time.Time)
+		message, _ := data["message"].(string)
+		revisions = append(revisions, firestorePayload(data).revision(snapshot.Ref.ID, t, message))
+	}
+	if len(revisions) > 0 {
+		slices.SortFunc(revisions, func(a, b Revision) int { return strings.Compare(b.ID, a.ID) })
+		return revisions, nil
+	}
+
+	// Pushed by an earlier version of ssm, only the latest push is kept
+	latest, err := document.Get(Ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching configuration: %w", err)
+	}
+	return []Revision{firestorePayload(latest.Data()).revision(firestoreRevision, latest.UpdateTime, "")}, nil
+}
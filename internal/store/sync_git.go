@@ -0,0 +1,256 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	gitSyncFile          = "ssm-sync.json"
+	gitSyncDefaultBranch = "main"
+)
+
+// GitSync keeps the encrypted payload in a git repository, one commit per push, so that earlier
+// revisions can be pulled again. It shells out to git and works on a private clone under
+// ~/.ssm/sync/git, which is reset to the remote branch before every operation.
+type GitSync struct {
+	Remote string
+	Branch string
+	// Dir is the working clone
+	Dir string
+}
+
+// NewGitSync returns the git sync backend for the given configuration
+func NewGitSync(c GitSyncConfig) (*GitSync, error) {
+	if c.Remote == "" {
+		return nil, fmt.Errorf("no git remote configured, set sync.git.remote in .ssm.yaml")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("the git sync backend needs git: %w", err)
+	}
+	remote, err := expandHome(c.Remote)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := DataDir()
+	if err != nil {
+		return nil, err
+	}
+	g := &GitSync{Remote: remote, Branch: c.Branch, Dir: filepath.Join(dir, "sync", "git")}
+	if g.Branch == "" {
+		g.Branch = gitSyncDefaultBranch
+	}
+	return g, nil
+}
+
+func (g *GitSync) String() string {
+	return "git " + g.Remote
+}
+
+func (g *GitSync) StateKey() string {
+	return g.String()
+}
+
+// git runs a git command in the working clone and returns its trimmed output
+func (g *GitSync) git(args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.Dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// lock serialises ssm processes using the working clone
+func (g *GitSync) lock() (func(), error) {
+	if err := os.MkdirAll(g.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", g.Dir, err)
+	}
+	return lockConfig(g.Dir)
+}
+
+// remoteRef is the remote-tracking ref of the sync branch
+func (g *GitSync) remoteRef() string {
+	return "refs/remotes/origin/" + g.Branch
+}
+
+// prepare creates the working clone if needed, fetches the remote and resets the clone to the remote
+// branch. It reports whether the remote branch exists yet.
+func (g *GitSync) prepare() (bool, error) {
+	if _, err := os.Stat(filepath.Join(g.Dir, ".git")); os.IsNotExist(err) {
+		if _, err := g.git("init", "-q"); err != nil {
+			return false, err
+		}
+		if _, err := g.git("remote", "add", "origin", g.Remote); err != nil {
+			return false, err
+		}
+	} else if _, err := g.git("remote", "set-url", "origin", g.Remote); err != nil {
+		return false, err
+	}
+
+	if _, err := g.git("fetch", "-q", "origin"); err != nil {
+		return false, err
+	}
+	if _, err := g.git("rev-parse", "-q", "--verify", g.remoteRef()); err != nil {
+		// Nothing pushed yet, the first commit starts the branch
+		_, err := g.git("symbolic-ref", "HEAD", "refs/heads/"+g.Branch)
+		return false, err
+	}
+	_, err := g.git("checkout", "-q", "-f", "-B", g.Branch, g.remoteRef())
+	return true, err
+}
+
+// Put commits payload with the given message and pushes it. An unchanged payload creates no commit
+// and returns the current revision.
+func (g *GitSync) Put(payload Payload, message string) (Revision, error) {
+	unlock, err := g.lock()
+	if err != nil {
+		return Revision{}, err
+	}
+	defer unlock()
+	if _, err := g.prepare(); err != nil {
+		return Revision{}, err
+	}
+	if err := g.commit(payload, message); err != nil {
+		return Revision{}, err
+	}
+	revisions, err := g.log("-1")
+	if err != nil || len(revisions) == 0 {
+		return Revision{}, err
+	}
+	return g.describe(revisions[0]), nil
+}
+
+// commit writes payload to the working clone, and commits and pushes it when it changed
+func (g *GitSync) commit(payload Payload, message string) error {
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(g.Dir, gitSyncFile), append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	if _, err := g.git("add", gitSyncFile); err != nil {
+		return err
+	}
+	if status, err := g.git("status", "--porcelain"); err != nil {
+		return err
+	} else if status == "" {
+		return nil
+	}
+
+	args := []string{"commit", "-q", "-m", message}
+	if email, _ := g.git("config", "user.email"); email == "" {
+		// Commits need an identity, fall back to one naming this machine
+		host, _ := os.Hostname()
+		args = append([]string{"-c", "user.name=ssm", "-c", "user.email=ssm@" + host}, args...)
+	}
+	if _, err := g.git(args...); err != nil {
+		return err
+	}
+	if _, err := g.git("push", "-q", "origin", g.Branch); err != nil {
+		return fmt.Errorf("%w (if another machine pushed in the meantime, run 'ssm sync pull' and push again)", err)
+	}
+	return nil
+}
+
+// Get returns the payload of the given revision, or of the latest push when rev is empty.
+// rev can be anything git understands that names a commit, such as a commit hash or HEAD~1.
+func (g *GitSync) Get(rev string) (Payload, error) {
+	unlock, err := g.lock()
+	if err != nil {
+		return Payload{}, err
+	}
+	defer unlock()
+	exists, err := g.prepare()
+	if err != nil {
+		return Payload{}, err
+	}
+	if !exists {
+		return Payload{}, ErrNoSyncData
+	}
+	if rev == "" {
+		rev = g.remoteRef()
+	}
+	// rev is given by the user: it must not be read as an option, and only the commit it names is shown
+	if strings.HasPrefix(rev, "-") {
+		return Payload{}, fmt.Errorf("invalid revision %q", rev)
+	}
+	commit, err := g.git("rev-parse", "-q", "--verify", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return Payload{}, fmt.Errorf("revision %q not found: %w", rev, err)
+	}
+	return g.payload(commit)
+}
+
+// payload reads the payload of the given revision from the working clone
+func (g *GitSync) payload(rev string) (Payload, error) {
+	data, err := g.git("show", rev+":"+gitSyncFile)
+	if err != nil {
+		return Payload{}, err
+	}
+	payload, err := decodePayload([]byte(data))
+	if err != nil {
+		return Payload{}, fmt.Errorf("invalid %s in revision %s: %w", gitSyncFile, rev, err)
+	}
+	return payload, nil
+}
+
+// describe adds the details recorded in the payload of a commit to its revision
+func (g *GitSync) describe(r Revision) Revision {
+	payload, err := g.payload(r.ID)
+	if err != nil {
+		return r
+	}
+	return payload.revision(r.ID, r.Time, r.Message)
+}
+
+// List returns the commits that changed the payload, newest first
+func (g *GitSync) List() ([]Revision, error) {
+	unlock, err := g.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	exists, err := g.prepare()
+	if err != nil || !exists {
+		return nil, err
+	}
+	revisions, err := g.log()
+	if err != nil {
+		return nil, err
+	}
+	for i := range revisions {
+		revisions[i] = g.describe(revisions[i])
+	}
+	return revisions, nil
+}
+
+// log parses git log of the payload on the current branch
+func (g *GitSync) log(args ...string) ([]Revision, error) {
+	out, err := g.git(append(append([]string{"log", "--format=%H%x1f%cI%x1f%s"}, args...), "--", gitSyncFile)...)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []Revision
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\x1f")
+		if len(fields) != 3 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid commit time %q: %w", fields[1], err)
+		}
+		revisions = append(revisions, Revision{ID: fields[0], Time: t, Message: fields[2]})
+	}
+	return revisions, nil
+}
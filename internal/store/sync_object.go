@@ -0,0 +1,175 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	syncRevisionPrefix   = "revisions/"
+	syncRevisionSuffix   = ".json"
+	syncRevisionIDFormat = "20060102-150405.000000"
+)
+
+// objectStore is a flat store of named objects, such as a directory or a bucket
+type objectStore interface {
+	String() string
+	// put creates or replaces the object at key
+	put(key string, data []byte) error
+	// get returns the object at key, or an error matching os.ErrNotExist
+	get(key string) ([]byte, error)
+	// list returns the keys starting with prefix
+	list(prefix string) ([]string, error)
+}
+
+// storedRevision is a revision as kept in an object store
+type storedRevision struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Payload
+}
+
+// objectSync implements SyncBackend on top of an objectStore, keeping every push as the object
+// revisions/<id>.json. Revision IDs are UTC timestamps, so they sort in push order.
+type objectSync struct {
+	store objectStore
+}
+
+func (o *objectSync) String() string {
+	return o.store.String()
+}
+
+func (o *objectSync) StateKey() string {
+	return o.String()
+}
+
+func (o *objectSync) Put(payload Payload, message string) (Revision, error) {
+	now := time.Now().UTC()
+	data, err := json.MarshalIndent(storedRevision{Time: now, Message: message, Payload: payload}, "", "  ")
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	id := now.Format(syncRevisionIDFormat)
+	if err := o.store.put(syncRevisionPrefix+id+syncRevisionSuffix, data); err != nil {
+		return Revision{}, err
+	}
+	return payload.revision(id, now, message), nil
+}
+
+// ids returns the stored revision IDs, newest first
+func (o *objectSync) ids() ([]string, error) {
+	keys, err := o.store.list(syncRevisionPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, key := range keys {
+		id, ok := strings.CutSuffix(strings.TrimPrefix(key, syncRevisionPrefix), syncRevisionSuffix)
+		if ok && id != "" && !strings.Contains(id, "/") {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	slices.Reverse(ids)
+	return ids, nil
+}
+
+// read returns the stored revision with the given ID
+func (o *objectSync) read(id string) (*storedRevision, error) {
+	data, err := o.store.get(syncRevisionPrefix + id + syncRevisionSuffix)
+	if err != nil {
+		return nil, err
+	}
+	var r storedRevision
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("invalid revision %s in %s: %w", id, o.store, err)
+	}
+	return &r, nil
+}
+
+// Get accepts a full revision ID or any unique prefix of one
+func (o *objectSync) Get(rev string) (Payload, error) {
+	ids, err := o.ids()
+	if err != nil {
+		return Payload{}, err
+	}
+	if len(ids) == 0 {
+		return Payload{}, ErrNoSyncData
+	}
+	id := ids[0]
+	if rev != "" {
+		if id, err = matchRevision(ids, rev, o.store); err != nil {
+			return Payload{}, err
+		}
+	}
+	r, err := o.read(id)
+	if err != nil {
+		return Payload{}, err
+	}
+	return r.Payload, nil
+}
+
+func (o *objectSync) List() ([]Revision, error) {
+	ids, err := o.ids()
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]Revision, 0, len(ids))
+	for _, id := range ids {
+		r, err := o.read(id)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r.revision(id, r.Time, r.Message))
+	}
+	return revisions, nil
+}
+
+// dirObjects keeps objects as files below a directory, e.g. on a NAS, a Dropbox folder or a USB stick
+type dirObjects struct {
+	dir string
+}
+
+func (d dirObjects) String() string {
+	return "directory " + d.dir
+}
+
+func (d dirObjects) path(key string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(key))
+}
+
+func (d dirObjects) put(key string, data []byte) error {
+	file := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(file), err)
+	}
+	return writeFileAtomic(file, data)
+}
+
+func (d dirObjects) get(key string) ([]byte, error) {
+	return os.ReadFile(d.path(key))
+}
+
+func (d dirObjects) list(prefix string) ([]string, error) {
+	dir, namePrefix := path.Split(prefix)
+	entries, err := os.ReadDir(d.path(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), namePrefix) {
+			keys = append(keys, dir+e.Name())
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SyncState records what a machine last pushed to or pulled from a sync backend. It is the common
+// base when both the machine and the backend changed since, and is kept in ~/.ssm/sync/state.
+type SyncState struct {
+	// Revision is the revision of the backend the local files were last synced with
+	Revision int `json:"revision"`
+	// Hashes are the hashes of the files of that revision
+	Hashes map[string]string `json:"hashes"`
+	// Base is the .ssm.yaml of that revision, the base of a three-way merge
+	Base []byte `json:"base,omitempty"`
+}
+
+// syncStatePath returns the state file of the given state key
+func syncStatePath(key string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, "sync", "state", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// LoadSyncState returns the state recorded under the state key of a backend, see SyncBackend.StateKey,
+// or an empty state when this machine has not synced with it yet
+func LoadSyncState(key string) (*SyncState, error) {
+	path, err := syncStatePath(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &SyncState{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state SyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid sync state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// SaveSyncState records state under the state key of a backend. Nothing is written in dry-run mode.
+func SaveSyncState(key string, state SyncState) error {
+	if DryRun {
+		return nil
+	}
+	path, err := syncStatePath(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// The base holds the plain .ssm.yaml, create the file private so that writeFileAtomic keeps the mode
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, data)
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Validate checks the configuration for missing required fields, malformed tags or labels, undeclared
+// environments and duplicate groups or environments
+func Validate(c *Config) error {
+	errs := validateEnvironmentDefs(c.Environments)
+	groupNames := make(map[string]bool)
+	for gi, g := range c.Groups {
+		if g.Name == "" {
+			errs = append(errs, fmt.Errorf("group #%d has no name", gi+1))
+		} else if groupNames[g.Name] {
+			errs = append(errs, fmt.Errorf("group %q is defined more than once", g.Name))
+		}
+		groupNames[g.Name] = true
+
+		envNames := make(map[string]bool)
+		for ei, env := range g.Environment {
+			if env.Name == "" {
+				errs = append(errs, fmt.Errorf("group %q: environment #%d has no name", g.Name, ei+1))
+			} else if envNames[env.Name] {
+				errs = append(errs, fmt.Errorf("group %q: environment %q is defined more than once", g.Name, env.Name))
+			} else if err := c.CheckEnvironment(env.Name); err != nil {
+				errs = append(errs, fmt.Errorf("group %q: %w", g.Name, err))
+			}
+			envNames[env.Name] = true
+
+			for si, s := range env.Servers {
+				if s.HostName == "" {
+					errs = append(errs, fmt.Errorf("group %q, environment %q: server #%d has no hostname", g.Name, env.Name, si+1))
+				}
+				if s.User == "" {
+					errs = append(errs, fmt.Errorf("group %q, environment %q: server %q has no user", g.Name, env.Name, s.HostName))
+				}
+				for _, tag := range s.Tags {
+					if err := checkTag(tag); err != nil {
+						errs = append(errs, fmt.Errorf("group %q, environment %q, server %q: %w", g.Name, env.Name, s.HostName, err))
+					}
+				}
+				for key, value := range s.Labels {
+					if err := checkLabel(key, value); err != nil {
+						errs = append(errs, fmt.Errorf("group %q, environment %q, server %q: %w", g.Name, env.Name, s.HostName, err))
+					}
+				}
+				if _, _, err := s.CredentialRef(ServerLocation{Group: g.Name, Environment: env.Name}); err != nil {
+					errs = append(errs, fmt.Errorf("group %q, environment %q, server %q: %w", g.Name, env.Name, s.HostName, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DuplicateAliases returns every alias used by more than one server, across all groups,
+// mapped to the group/environment/hostname of each server using it
+func DuplicateAliases(c *Config) map[string][]string {
+	seen := make(map[string][]string)
+	for _, g := range c.Groups {
+		for _, env := range g.Environment {
+			for _, s := range env.Servers {
+				if s.Alias == "" {
+					continue
+				}
+				seen[s.Alias] = append(seen[s.Alias], fmt.Sprintf("%s/%s/%s", g.Name, env.Name, s.HostName))
+			}
+		}
+	}
+	duplicates := make(map[string][]string)
+	for alias, locations := range seen {
+		if len(locations) > 1 {
+			sort.Strings(locations)
+			duplicates[alias] = locations
+		}
+	}
+	return duplicates
+}
@@ -0,0 +1,255 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+)
+
+const vaultFileName = "vault.json"
+
+// ErrNoVault is returned by LoadVault when this machine has no vault
+var ErrNoVault = errors.New("no vault on this machine, create one with 'ssm vault init'")
+
+// ErrVaultLocked is returned when the value of an entry is read or written while the vault is locked
+var ErrVaultLocked = errors.New("the vault is locked")
+
+// Vault is an encrypted file of credentials, kept in ~/.ssm/vault.json. The values are encrypted with
+// the data key of its envelope, which is wrapped under the vault passphrase. The names of the entries
+// are not encrypted, so that a credential can be found without unlocking the vault.
+type Vault struct {
+	Envelope security.Envelope `json:"envelope"`
+	// Entries holds the encrypted values by name, e.g. group_environment_host
+	Entries map[string]string `json:"entries"`
+
+	path string
+	// key is the data key, nil while the vault is locked
+	key []byte
+}
+
+// VaultPath returns the path of the vault file
+func VaultPath() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, vaultFileName), nil
+}
+
+// CreateVault creates an empty vault encrypted for passphrase. It fails when the vault exists.
+func CreateVault(passphrase string) (*Vault, error) {
+	path, err := VaultPath()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+	envelope, err := security.NewEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	key, err := security.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := envelope.Wrap(key, passphrase); err != nil {
+		return nil, err
+	}
+	v := &Vault{Envelope: envelope, Entries: map[string]string{}, path: path, key: key}
+	if DryRun {
+		return v, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	// Checked again under the lock, another command may have created it meanwhile
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+	return v, v.save()
+}
+
+// LoadVault reads the vault of this machine, locked. It returns ErrNoVault when there is none.
+func LoadVault() (*Vault, error) {
+	path, err := VaultPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoVault
+	} else if err != nil {
+		return nil, err
+	}
+	v := &Vault{path: path}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("invalid vault %s: %w", path, err)
+	}
+	if v.Entries == nil {
+		v.Entries = map[string]string{}
+	}
+	return v, nil
+}
+
+// Path returns the file the vault is kept in
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Has reports whether the vault holds a value for name, without unlocking it
+func (v *Vault) Has(name string) bool {
+	_, ok := v.Entries[name]
+	return ok
+}
+
+// Names returns the names of the entries, sorted
+func (v *Vault) Names() []string {
+	return slices.Sorted(maps.Keys(v.Entries))
+}
+
+// Locked reports whether the values cannot be read or written yet, see Unlock and Resume
+func (v *Vault) Locked() bool {
+	return v.key == nil
+}
+
+// Unlock opens the vault with passphrase. It returns security.ErrWrongSecret for a wrong passphrase.
+func (v *Vault) Unlock(passphrase string) error {
+	key, err := v.Envelope.Open(passphrase)
+	if err != nil {
+		return err
+	}
+	v.key = key
+	return nil
+}
+
+// ChangePassphrase wraps the data key under newPassphrase instead of passphrase and saves the vault.
+// The values are not encrypted again.
+func (v *Vault) ChangePassphrase(passphrase, newPassphrase string) error {
+	envelope, err := v.Envelope.Rewrap(passphrase, newPassphrase)
+	if err != nil {
+		return err
+	}
+	return v.update(func(latest *Vault) error {
+		latest.Envelope = envelope
+		return nil
+	})
+}
+
+// Get returns the value of name
+func (v *Vault) Get(name string) (string, error) {
+	if v.Locked() {
+		return "", ErrVaultLocked
+	}
+	encrypted, ok := v.Entries[name]
+	if !ok {
+		return "", fmt.Errorf("%s is not in the vault", name)
+	}
+	value, err := security.DecryptData(encrypted, v.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", name, err)
+	}
+	return string(value), nil
+}
+
+// Set stores value under name and saves the vault. Nothing is saved in dry-run mode.
+func (v *Vault) Set(name, value string) error {
+	if v.Locked() {
+		return ErrVaultLocked
+	}
+	if value == "" {
+		return fmt.Errorf("the value of %s cannot be empty", name)
+	}
+	encrypted := security.EncryptData([]byte(value), v.key)
+	return v.update(func(latest *Vault) error {
+		latest.Entries[name] = encrypted
+		return nil
+	})
+}
+
+// Delete removes name from the vault and saves it. Nothing is saved in dry-run mode.
+func (v *Vault) Delete(name string) error {
+	return v.update(func(latest *Vault) error {
+		if !latest.Has(name) {
+			return errUnchanged
+		}
+		delete(latest.Entries, name)
+		return nil
+	})
+}
+
+// errUnchanged is returned by the change of update to save nothing
+var errUnchanged = errors.New("unchanged")
+
+// update applies change to the latest vault on disk and saves it. The vault file is locked from the
+// read through the write, as the configuration file is by Update, so that concurrent commands do not
+// lose each other's entries. v is then the saved vault. Nothing is saved when change returns errUnchanged,
+// nor in dry-run mode, where change is applied to v alone.
+func (v *Vault) update(change func(latest *Vault) error) error {
+	if DryRun {
+		if err := change(v); err != nil && !errors.Is(err, errUnchanged) {
+			return err
+		}
+		return nil
+	}
+	unlock, err := lockConfig(v.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	latest := &Vault{Envelope: v.Envelope, Entries: maps.Clone(v.Entries), path: v.path, key: v.key}
+	data, err := os.ReadFile(v.path)
+	if err == nil {
+		var onDisk Vault
+		if err := json.Unmarshal(data, &onDisk); err != nil {
+			return fmt.Errorf("invalid vault %s: %w", v.path, err)
+		}
+		latest.Envelope, latest.Entries = onDisk.Envelope, onDisk.Entries
+		if latest.Entries == nil {
+			latest.Entries = map[string]string{}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := change(latest); errors.Is(err, errUnchanged) {
+		v.Envelope, v.Entries = latest.Envelope, latest.Entries
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := latest.save(); err != nil {
+		return err
+	}
+	v.Envelope, v.Entries = latest.Envelope, latest.Entries
+	return nil
+}
+
+// save writes the vault, private to its owner. The caller holds the lock of the vault file.
+func (v *Vault) save() error {
+	if DryRun {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Create the file private so that writeFileAtomic keeps the mode
+	if _, err := os.Stat(v.path); errors.Is(err, os.ErrNotExist) {
+		if err := os.WriteFile(v.path, nil, 0600); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(v.path, data)
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+)
+
+// DefaultVaultTimeout is how long an unlocked vault stays unlocked unless vaultTimeout says otherwise
+const DefaultVaultTimeout = 15 * time.Minute
+
+// vaultSession keeps the data key of an unlocked vault until it expires, like an agent, so that the
+// passphrase is asked once per session
+type vaultSession struct {
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires"`
+	// WrappedKey is the one of the vault the session was started for, a vault replaced since, e.g. by
+	// sync pull, has to be unlocked again
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// sessionName returns the name the session of the vault is kept under
+func (v *Vault) sessionName() string {
+	sum := sha256.Sum256([]byte(v.path))
+	return "vault-" + hex.EncodeToString(sum[:8])
+}
+
+// StartSession keeps the vault unlocked for timeout, for the commands that follow. The data key is
+// never written to disk, where it would sit next to the values it decrypts: it is kept by the kernel
+// keyring or the OS keyring, see security.StoreSession. Without either it returns
+// security.ErrNoSessionStore and the passphrase is asked for every time.
+func (v *Vault) StartSession(timeout time.Duration) error {
+	if v.Locked() {
+		return ErrVaultLocked
+	}
+	if timeout <= 0 {
+		return v.EndSession()
+	}
+	data, err := json.Marshal(vaultSession{
+		Key:        hex.EncodeToString(v.key),
+		Expires:    time.Now().Add(timeout),
+		WrappedKey: v.Envelope.WrappedKey,
+	})
+	if err != nil {
+		return err
+	}
+	return security.StoreSession(v.sessionName(), string(data), timeout)
+}
+
+// Resume unlocks the vault with the key of an unexpired session and reports whether it did. An expired
+// session is removed.
+func (v *Vault) Resume() bool {
+	s, ok := v.session()
+	if !ok {
+		return false
+	}
+	key, err := hex.DecodeString(s.Key)
+	if err != nil {
+		return false
+	}
+	v.key = key
+	return true
+}
+
+// SessionExpiry returns when the session of the vault expires, false when there is none
+func (v *Vault) SessionExpiry() (time.Time, bool) {
+	s, ok := v.session()
+	return s.Expires, ok
+}
+
+// EndSession locks the vault again for the commands that follow
+func (v *Vault) EndSession() error {
+	return security.DeleteSession(v.sessionName())
+}
+
+// session reads the session of the vault, removing it once expired
+func (v *Vault) session() (vaultSession, bool) {
+	var s vaultSession
+	data, ok := security.LoadSession(v.sessionName())
+	if !ok || json.Unmarshal([]byte(data), &s) != nil {
+		return s, false
+	}
+	if time.Now().After(s.Expires) {
+		_ = v.EndSession()
+		return s, false
+	}
+	return s, s.WrappedKey == v.Envelope.WrappedKey
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AshutoshPatole/ssm/internal/security"
+	"github.com/zalando/go-keyring"
+)
+
+func TestVault(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	// Sessions fall back to the OS keyring where the kernel keyring cannot be used
+	keyring.MockInit()
+
+	if _, err := LoadVault(); !errors.Is(err, ErrNoVault) {
+		t.Fatalf("expected ErrNoVault, got %v", err)
+	}
+	v, err := CreateVault("passphrase")
+	if err != nil {
+		t.Fatalf("CreateVault: %v", err)
+	}
+	if err := v.Set("web_prod_host1", "hunter2"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if info, err := os.Stat(v.Path()); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected a private vault file, got %v (err %v)", info.Mode(), err)
+	}
+	if _, err := CreateVault("other"); err == nil {
+		t.Fatalf("CreateVault replaced the existing vault")
+	}
+
+	loaded, err := LoadVault()
+	if err != nil {
+		t.Fatalf("LoadVault: %v", err)
+	}
+	if !loaded.Locked() || !loaded.Has("web_prod_host1") {
+		t.Fatalf("expected a locked vault holding web_prod_host1")
+	}
+	if _, err := loaded.Get("web_prod_host1"); !errors.Is(err, ErrVaultLocked) {
+		t.Fatalf("expected ErrVaultLocked, got %v", err)
+	}
+	if loaded.Resume() {
+		t.Fatalf("resumed without a session")
+	}
+	if err := loaded.Unlock("wrong"); !errors.Is(err, security.ErrWrongSecret) {
+		t.Fatalf("expected ErrWrongSecret, got %v", err)
+	}
+	if err := loaded.Unlock("passphrase"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if value, err := loaded.Get("web_prod_host1"); err != nil || value != "hunter2" {
+		t.Fatalf("expected hunter2, got %q (err %v)", value, err)
+	}
+
+	// A session unlocks the vault for the commands that follow, until it expires or ends
+	if err := loaded.StartSession(time.Minute); err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	// The data key is kept off the disk
+	if entries, err := os.ReadDir(filepath.Dir(v.Path())); err != nil || len(entries) != 2 || entries[1].Name() != vaultFileName+".lock" {
+		t.Fatalf("expected only the vault and its lock in %s, got %v (err %v)", filepath.Dir(v.Path()), entries, err)
+	}
+	next, _ := LoadVault()
+	if !next.Resume() {
+		t.Fatalf("the session did not unlock the vault")
+	}
+	if value, err := next.Get("web_prod_host1"); err != nil || value != "hunter2" {
+		t.Fatalf("expected hunter2 from the session, got %q (err %v)", value, err)
+	}
+	if err := next.EndSession(); err != nil {
+		t.Fatalf("EndSession: %v", err)
+	}
+	if next, _ := LoadVault(); next.Resume() {
+		t.Fatalf("resumed an ended session")
+	}
+	if err := loaded.StartSession(-time.Second); err != nil {
+		t.Fatalf("StartSession: %v", err)
+	}
+	if next, _ := LoadVault(); next.Resume() {
+		t.Fatalf("resumed an expired session")
+	}
+
+	if err := loaded.ChangePassphrase("passphrase", "new"); err != nil {
+		t.Fatalf("ChangePassphrase: %v", err)
+	}
+	changed, _ := LoadVault()
+	if err := changed.Unlock("new"); err != nil {
+		t.Fatalf("Unlock with the new passphrase: %v", err)
+	}
+	if value, err := changed.Get("web_prod_host1"); err != nil || value != "hunter2" {
+		t.Fatalf("expected hunter2 after changing the passphrase, got %q (err %v)", value, err)
+	}
+}
+
+func TestVaultConcurrentSetsAreNotLost(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if _, err := CreateVault("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every writer loaded the vault before any of them saved, like concurrent ssm creds set
+	const writers = 5
+	vaults := make([]*Vault, writers)
+	for i := range vaults {
+		v, err := LoadVault()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Unlock("passphrase"); err != nil {
+			t.Fatal(err)
+		}
+		vaults[i] = v
+	}
+	var wg sync.WaitGroup
+	for i, v := range vaults {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := v.Set(fmt.Sprintf("host%d", i), "hunter2"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, err := LoadVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := v.Names(); len(names) != writers {
+		t.Fatalf("expected %d entries, got %v", writers, names)
+	}
+	if err := vaults[0].Delete("host1"); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ = LoadVault(); len(v.Names()) != writers-1 || v.Has("host1") {
+		t.Fatalf("expected host1 alone deleted, got %v", v.Names())
+	}
+}
@@ -0,0 +1,261 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/AshutoshPatole/ssm/internal/diff"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// DryRun makes Update apply changes to an in-memory copy of the configuration only
+// and print a unified diff of what would be written instead of touching .ssm.yaml
+var DryRun bool
+
+// DryRunOutput is where dry-run diffs are printed
+var DryRunOutput io.Writer = os.Stdout
+
+var (
+	// dryRunState holds the in-memory configuration in dry-run mode so that
+	// successive mutations build on each other
+	dryRunState []byte
+	writeMutex  sync.Mutex
+)
+
+// Init selects the configuration file to use, ~/.ssm.yaml unless path is set.
+// The default file is created empty when it does not exist yet. A path naming a directory or a .db file
+// selects the dir or bolt storage for the servers instead, with the settings still read from ~/.ssm.yaml.
+func Init(path string) error {
+	storageOverride = nil
+	if info, err := os.Stat(path); path != "" && (err == nil && info.IsDir() || filepath.Ext(path) == ".db") {
+		s := StorageConfig{Type: StorageDir, Path: path}
+		if filepath.Ext(path) == ".db" {
+			s.Type = StorageBolt
+		}
+		storageOverride = &s
+		path = ""
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(home, ".ssm.yaml")
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := os.WriteFile(path, nil, 0600); err != nil {
+				return fmt.Errorf("failed to create %s: %w", path, err)
+			}
+		}
+	}
+	viper.SetConfigFile(path)
+	viper.SetConfigType("yaml")
+	return viper.ReadInConfig()
+}
+
+// ConfigPath returns the path of the active configuration file
+func ConfigPath() (string, error) {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return "", fmt.Errorf("no configuration file in use")
+	}
+	return path, nil
+}
+
+// Load reads the latest configuration from disk
+func Load() (*Config, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, migrated, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	if migrated && !DryRun {
+		// Persist the upgraded file, Update takes a backup of the old version first
+		if err := Update(func(*Config) error { return nil }); err != nil {
+			return nil, err
+		}
+		logrus.Infof("Upgraded %s to configuration version %d", path, CurrentVersion)
+	}
+	return c, nil
+}
+
+// Update applies fn to the latest configuration and persists the result.
+// The configuration file is locked for the duration of the update, re-read from disk,
+// snapshotted to ~/.ssm/backups and replaced atomically via a temporary file and rename.
+// If fn returns an error nothing is written.
+func Update(fn func(c *Config) error) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	c, migrated, err := Parse(current)
+	if err != nil {
+		return fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	before, err := encodeConfig(c)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(c); err != nil {
+		return err
+	}
+
+	after, err := encodeConfig(c)
+	if err != nil {
+		return err
+	}
+
+	if DryRun {
+		PrintDiff(path, before, after)
+		dryRunState = after
+		return nil
+	}
+
+	reason := "update"
+	if migrated {
+		reason = fmt.Sprintf("migrate to version %d", CurrentVersion)
+	} else if bytes.Equal(before, after) {
+		return nil
+	}
+	if _, err := Snapshot(reason, path); err != nil {
+		return fmt.Errorf("failed to back up configuration: %w", err)
+	}
+	return writeFileAtomic(path, after)
+}
+
+// Replace overwrites the configuration file with data, e.g. when pulling it from the cloud.
+// The same locking and atomic rename rules as Update apply. Callers are expected to take
+// a Snapshot of the files they are about to replace beforehand.
+func Replace(data []byte) error {
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	if _, _, err := Parse(data); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	return viper.ReadInConfig()
+}
+
+// lockConfig takes an advisory lock next to the configuration file and returns a function releasing it
+func lockConfig(path string) (func(), error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(lock); err != nil {
+		_ = lock.Close()
+		return nil, fmt.Errorf("failed to lock configuration: %w", err)
+	}
+	return func() {
+		_ = unlockFile(lock)
+		_ = lock.Close()
+	}, nil
+}
+
+// PrintDiff prints a unified diff of a pending change to name on DryRunOutput
+func PrintDiff(name string, before, after []byte) {
+	d := diff.Unified(name+" (current)", name+" (dry-run)", before, after)
+	if d == "" {
+		_, _ = fmt.Fprintf(DryRunOutput, "No changes to %s\n", name)
+		return
+	}
+	_, _ = fmt.Fprint(DryRunOutput, d)
+}
+
+func readConfigFile(path string) ([]byte, error) {
+	if DryRun && dryRunState != nil {
+		return dryRunState, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	return data, nil
+}
+
+func encodeConfig(c *Config) ([]byte, error) {
+	c.Version = CurrentVersion
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render configuration: %w", err)
+	}
+	return data, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path, syncs it and renames it over path
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		_ = os.Remove(tmpName)
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return syncDir(dir)
+}
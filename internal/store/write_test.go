@@ -0,0 +1,324 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// setupConfig points viper at an empty configuration file inside a temporary home directory
+func setupConfig(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	path := filepath.Join(home, ".ssm.yaml")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Reset()
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(viper.Reset)
+	systemLayers := SystemLayers
+	SystemLayers = ""
+	t.Cleanup(func() { SystemLayers = systemLayers })
+	return path
+}
+
+func TestUpdateConcurrentWritesAreNotLost(t *testing.T) {
+	path := setupConfig(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := Update(func(c *Config) error {
+				return addServer(c, "web", "dev", Server{HostName: fmt.Sprintf("host%d", i), Alias: fmt.Sprintf("h%d", i), User: "root"})
+			})
+			if err != nil {
+				t.Errorf("update %d failed: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.Groups[0].Environment[0].Servers); got != 20 {
+		t.Fatalf("expected 20 servers, got %d", got)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected file mode to be preserved, got %v", info.Mode().Perm())
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first write starts from an empty file, so there is nothing to back up
+	if len(backups) != 19 {
+		t.Fatalf("expected 19 backups, got %d", len(backups))
+	}
+}
+
+func TestUpdateErrorLeavesFileUntouched(t *testing.T) {
+	path := setupConfig(t)
+	if err := os.WriteFile(path, []byte("groups: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Update(func(c *Config) error {
+		addServer(c, "web", "dev", Server{HostName: "host", Alias: "h"})
+		return fmt.Errorf("boom")
+	})
+	if err == nil {
+		t.Fatal("expected error from mutation to be returned")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "groups: []\n" {
+		t.Fatalf("configuration was modified: %q", data)
+	}
+}
+
+func TestSnapshotPrunesOldBackups(t *testing.T) {
+	path := setupConfig(t)
+	if err := os.WriteFile(path, []byte("groups: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < MaxBackups+5; i++ {
+		if _, err := Snapshot("test", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != MaxBackups {
+		t.Fatalf("expected %d backups, got %d", MaxBackups, len(backups))
+	}
+}
+
+func TestRestoreSnapshotsCurrentFiles(t *testing.T) {
+	path := setupConfig(t)
+	original := []byte("groups:\n    - name: web\n")
+	if err := os.WriteFile(path, original, 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Snapshot("test", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("groups: []\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := FindBackup(b.ID[:8])
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := Restore(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(original) {
+		t.Fatalf("restored content mismatch: %q", data)
+	}
+	if previous == nil {
+		t.Fatal("expected the overwritten file to be snapshotted")
+	}
+	saved, err := previous.ReadFile(previous.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "groups: []\n" {
+		t.Fatalf("unexpected pre-restore snapshot: %q", saved)
+	}
+}
+
+func TestRepositoryMoveRenamesAndMoves(t *testing.T) {
+	setupConfig(t)
+	repo := NewFileRepository()
+	dev := ServerLocation{Group: "web", Environment: "dev"}
+	prod := ServerLocation{Group: "db", Environment: "prod"}
+	for _, e := range []Entry{
+		{dev, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w1", User: "root"}},
+		{dev, Server{HostName: "web2", IP: "10.0.0.2", Alias: "w2", User: "root"}},
+		{prod, Server{HostName: "db1", IP: "10.0.1.1", Alias: "d1", User: "postgres"}},
+	} {
+		if err := repo.Upsert(e.ServerLocation, e.Server); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Renaming in place keeps the IP and the position
+	if err := repo.Move("w1", dev, dev, Server{HostName: "web1", IP: "10.0.0.1", Alias: "frontend", User: "deploy"}); err != nil {
+		t.Fatal(err)
+	}
+	// Taking an alias that is already used in the environment is rejected
+	if err := repo.Move("frontend", dev, dev, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w2", User: "deploy"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate, got %v", err)
+	}
+	// Undeclared environments are rejected
+	if err := repo.Move("w2", dev, ServerLocation{Group: "web", Environment: "qa"}, Server{HostName: "web2", IP: "10.0.0.2", Alias: "w2", User: "root"}); err == nil {
+		t.Errorf("expected undeclared environment to be rejected")
+	}
+	if err := repo.Move("missing", dev, prod, Server{HostName: "x", User: "root"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	// Moving the last server out of a group removes the group
+	if err := repo.Move("d1", prod, dev, Server{HostName: "db1", IP: "10.0.1.1", Alias: "d1", User: "postgres"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := repo.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Groups) != 1 {
+		t.Fatalf("expected the emptied db group to be removed, got %+v", c.Groups)
+	}
+	servers := c.Groups[0].Environment[0].Servers
+	if len(servers) != 3 || servers[0].Alias != "frontend" || servers[0].User != "deploy" || servers[0].IP != "10.0.0.1" || servers[2].Alias != "d1" {
+		t.Fatalf("unexpected servers after edits: %+v", servers)
+	}
+
+	if e, err := repo.Get("d1", ServerLocation{}); err != nil || e.ServerLocation != dev {
+		t.Errorf("expected d1 to be found in %s, got %+v, %v", dev, e, err)
+	}
+	if _, err := repo.Get("missing", ServerLocation{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRepositoryUpsertDeleteAndList(t *testing.T) {
+	setupConfig(t)
+	repo := NewFileRepository()
+	dev := ServerLocation{Group: "web", Environment: "dev"}
+	prod := ServerLocation{Group: "web", Environment: "prod"}
+
+	if err := repo.Upsert(prod, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w1", User: "root"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert(dev, Server{HostName: "web2", IP: "10.0.0.2", Alias: "w2", User: "root", Tags: []string{"canary"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Upserting the same alias replaces the server
+	if err := repo.Upsert(prod, Server{HostName: "web1", IP: "10.0.0.1", Alias: "w1", User: "deploy"}); err != nil {
+		t.Fatal(err)
+	}
+	// Add never replaces and reports duplicates
+	if err := repo.Add(prod, Server{HostName: "web3", IP: "10.0.0.1", Alias: "w3", User: "root"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected ErrDuplicate for a duplicate IP, got %v", err)
+	}
+
+	entries, err := repo.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dev is declared before prod, so it is listed first
+	if len(entries) != 2 || entries[0].Server.Alias != "w2" || entries[1].Server.User != "deploy" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	selector, _ := ParseSelector("canary")
+	if entries, _ := repo.List(Filter{Selector: selector}); len(entries) != 1 || entries[0].Server.Alias != "w2" {
+		t.Fatalf("unexpected entries for selector: %+v", entries)
+	}
+
+	if err := repo.Delete(Entry{dev, Server{HostName: "web2", Alias: "w2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(Entry{dev, Server{HostName: "web2", Alias: "w2"}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	c, err := repo.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Groups) != 1 || len(c.Groups[0].Environment) != 1 || c.Groups[0].Environment[0].Name != "prod" {
+		t.Fatalf("expected the emptied dev environment to be removed, got %+v", c.Groups)
+	}
+}
+
+func TestWriteServerResolvesOutsideUpdate(t *testing.T) {
+	c := &Config{Groups: []Group{{Name: "web", Environment: []Env{{Name: "dev", Servers: []Server{
+		{HostName: "old.invalid", IP: "10.0.0.1", Alias: "web1", User: "root"},
+	}}}}}}
+	var calls int
+	update := func(fn func(c *Config) error) error {
+		calls++
+		return fn(c)
+	}
+
+	// The hostname changes, so the IP it carries is stale and the new hostname has to be resolved
+	server := Server{HostName: "new.invalid", IP: "10.0.0.1", Alias: "web1", User: "root"}
+	err := writeServer(update, server, func(c *Config, ips hostIPs) error {
+		return c.upsertServer(ServerLocation{Group: "web", Environment: "dev"}, server, ips)
+	})
+	if err != nil {
+		t.Fatalf("writeServer: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the write to run again once the hostname was resolved, ran %d times", calls)
+	}
+	// Unresolvable hostnames are used as the IP
+	if got := c.Groups[0].Environment[0].Servers[0]; got.HostName != "new.invalid" || got.IP != "new.invalid" {
+		t.Errorf("expected the new hostname and its IP, got %+v", got)
+	}
+}
+
+func TestWriteServerResolvesMovedHostname(t *testing.T) {
+	c := &Config{Groups: []Group{{Name: "web", Environment: []Env{{Name: "dev", Servers: []Server{
+		{HostName: "old.invalid", IP: "10.0.0.1", Alias: "web1", User: "root"},
+	}}}}}}
+	var calls int
+	update := func(fn func(c *Config) error) error {
+		calls++
+		return fn(c)
+	}
+
+	from, to := ServerLocation{Group: "web", Environment: "dev"}, ServerLocation{Group: "web", Environment: "prod"}
+	server := Server{HostName: "new.invalid", IP: "10.0.0.1", Alias: "web1", User: "root"}
+	err := writeServer(update, server, func(c *Config, ips hostIPs) error {
+		return c.moveServer("web1", from, to, server, ips)
+	})
+	if err != nil {
+		t.Fatalf("writeServer: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected the move to run again once the hostname was resolved, ran %d times", calls)
+	}
+	entry, err := c.Find("web1", to)
+	if err != nil || entry.Server.IP != "new.invalid" {
+		t.Errorf("expected web1 in %s with the IP of its new hostname, got %+v, %v", to, entry, err)
+	}
+}